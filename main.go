@@ -1,23 +1,31 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"runtime"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"connectrpc.com/connect"
 	"github.com/99designs/keyring"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -33,10 +41,21 @@ import (
 	userpb "github.com/humanlogio/api/go/svc/user/v1"
 	"github.com/humanlogio/api/go/svc/user/v1/userv1connect"
 	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/bucket"
+	"github.com/humanlogio/apictl/pkg/catalog"
+	"github.com/humanlogio/apictl/pkg/dryrun"
+	"github.com/humanlogio/apictl/pkg/github"
+	"github.com/humanlogio/apictl/pkg/progress"
+	"github.com/humanlogio/apictl/pkg/release"
 	"github.com/humanlogio/apictl/pkg/selfupdate"
+	"github.com/humanlogio/apictl/pkg/signing"
+	"github.com/humanlogio/apictl/pkg/store"
+	"github.com/humanlogio/apictl/pkg/versions"
 	"github.com/humanlogio/humanlog/pkg/auth"
 	"github.com/mattn/go-colorable"
 	"github.com/urfave/cli"
+	"golang.org/x/term"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -83,7 +102,7 @@ func main() {
 
 	prefix := rgbterm.FgString(app.Name+"> ", 99, 99, 99)
 
-	log.SetOutput(colorable.NewColorableStderr())
+	log.SetOutput(progress.LogWriter(colorable.NewColorableStderr()))
 	log.SetFlags(0)
 	log.SetPrefix(prefix)
 	err := app.Run(os.Args)
@@ -92,10 +111,30 @@ func main() {
 	}
 }
 
+const envSigningKeyPassword = "SIGNING_KEY_PASSWORD"
+
+const envStoreToken = "STORE_TOKEN"
+
+// exitConflict is the exit code of `--idempotent` creates that find an
+// existing object with different fields.
+const exitConflict = 3
+
+// exit codes of `version compare` and `version satisfies`, so that scripts
+// can branch on them.
+const (
+	exitVersionLess    = 10
+	exitVersionGreater = 11
+	exitNotSatisfied   = 12
+)
+
+const defaultPlatforms = "darwin/amd64,darwin/arm64,linux/amd64,linux/arm64"
+
 const (
 	flagAPIURL         = "api.url"
 	flagHMACKeyID      = "hmac.key_id"
 	flagHMACPrivateKey = "hmac.private_key"
+	flagDryRun         = "dry-run"
+	flagProgress       = "progress"
 )
 
 func newApp() *cli.App {
@@ -120,15 +159,32 @@ func newApp() *cli.App {
 			Value:  "",
 			EnvVar: "HMAC_PRIVATE_KEY",
 		},
+		cli.BoolFlag{
+			Name:  flagDryRun,
+			Usage: "print the requests that mutating commands would send, without sending them",
+		},
+		cli.StringFlag{
+			Name:   flagProgress,
+			Value:  string(progress.Auto),
+			EnvVar: "APICTL_PROGRESS",
+			Usage:  "how transfers report progress: tty draws a live line, log prints a line every 10s, auto picks tty on terminals, or off",
+		},
 	}
 
 	var (
 		ctx    context.Context
 		cancel context.CancelFunc
 		client *http.Client
+		dryRun bool
 	)
 	app.Before = func(cctx *cli.Context) error {
 		ctx, cancel = signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+		dryRun = cctx.GlobalBool(flagDryRun)
+		mode, err := progress.ParseMode(cctx.GlobalString(flagProgress))
+		if err != nil {
+			return err
+		}
+		progress.DefaultMode = mode
 		client = &http.Client{
 			Transport: hmachttp.RoundTripper(
 				http.DefaultTransport,
@@ -171,26 +227,67 @@ func newApp() *cli.App {
 		flagS3UsePathStyle          = "s3.use_path_style"
 		flagS3ACL                   = "s3.acl"
 		flagS3CacheControl          = "s3.cache_control"
+		flagS3PartSize              = "s3.part_size_mib"
+		flagS3Parallelism           = "s3.parallelism"
+		flagS3StateFile             = "s3.state_file"
+		flagS3KeyTemplate           = "s3.key"
+		flagS3Profile               = "s3.profile"
+		flagURLTemplate             = "url.template"
+		flagOnFailure               = "on-failure"
+		flagPresign                 = "presign"
+		flagExpires                 = "expires"
+		flagWithin                  = "within"
+		flagStore                   = "store"
+		flagStorePublicURL          = "store.public_url"
+		flagStoreKey                = "key"
+		flagMirrorFrom              = "from"
+		flagMirrorFromPublicURL     = "from.public_url"
+		flagMirrorTo                = "to"
+		flagMirrorToPublicURL       = "to.public_url"
+		flagRegister                = "register"
+		flagContentAddressed        = "content-addressed"
+		flagPreid                   = "preid"
+		flagReverse                 = "reverse"
+		flagJSON                    = "json"
+		flagMatch                   = "match"
+		flagBump                    = "bump"
+		flagPreScheme               = "pre-scheme"
+		flagBuildScheme             = "build-scheme"
+		flagArchiveBaseURL          = "archive-base-url"
+		flagListen                  = "listen"
+		flagDir                     = "dir"
 		flagFilepath                = "filepath"
+		flagDistDir                 = "dist"
+		flagDistExtraDir            = "dist-extra"
+		flagGithubOwner             = "github.owner"
+		flagGithubAPIURL            = "github.api_url"
+		flagChecksums               = "checksums"
+		flagIdempotent              = "idempotent"
+		flagManifest                = "file"
+		flagPrune                   = "prune"
+		flagFromChannel             = "from"
+		flagToChannel               = "to"
+		flagPlatforms               = "platforms"
+		flagSigningPublicKey        = "signing.public_key"
+		flagConcurrency             = "concurrency"
+		flagSigningPublicKeyFile    = "signing.public_key_file"
+		flagSigningSecretKeyFile    = "signing.secret_key_file"
+		flagSigningKeyring          = "signing.keyring"
+		flagSigningKeyringItem      = "signing.keyring_item"
+		flagSigningEncrypt          = "signing.encrypt"
+		flagSigningTrustedComment   = "signing.trusted_comment"
+		flagKeepLatest              = "keep-latest"
+		flagPrereleasePrefix        = "prerelease"
+		flagS3Delete                = "s3.delete"
+		flagS3PublicURL             = "s3.public_url"
+		flagS3Prefix                = "s3.prefix"
+		flagMinAge                  = "min-age"
+		flagDelete                  = "delete"
 	)
 
 	parseVersion := func(cctx *cli.Context) (*typesv1.Version, error) {
 		if v := cctx.String(flagVersion); v != "" {
-			v = strings.TrimPrefix(v, "v")
-			vv, err := semver.Parse(v)
-			if err != nil {
-				return nil, err
-			}
-			out := &typesv1.Version{
-				Major: int32(vv.Major),
-				Minor: int32(vv.Minor),
-				Patch: int32(vv.Patch),
-			}
-			for _, pre := range vv.Pre {
-				out.Prereleases = append(out.Prereleases, pre.String())
-			}
-			out.Build = strings.Join(vv.Build, ".")
-			return out, nil
+			return versions.Parse(v)
 		}
 		out := &typesv1.Version{
 			Major: int32(cctx.Int(flagVersionMajor)),
@@ -207,37 +304,262 @@ func newApp() *cli.App {
 		}
 		return out, nil
 	}
+	versionFlags := []cli.Flag{
+		cli.StringFlag{Name: flagVersion},
+		cli.IntFlag{Name: flagVersionMajor},
+		cli.IntFlag{Name: flagVersionMinor},
+		cli.IntFlag{Name: flagVersionPatch},
+		cli.StringSliceFlag{Name: flagVersionPrereleases},
+		cli.StringFlag{Name: flagVersionBuild},
+	}
+	// versionFlagsSet tells if a version was given by flags.
+	versionFlagsSet := func(cctx *cli.Context) bool {
+		for _, name := range []string{flagVersion, flagVersionMajor, flagVersionMinor, flagVersionPatch, flagVersionPrereleases, flagVersionBuild} {
+			if cctx.IsSet(name) {
+				return true
+			}
+		}
+		return false
+	}
+	// readVersion parses the version flags, or the JSON of `version to-json`
+	// on stdin if none is set.
+	readVersion := func(cctx *cli.Context) (*typesv1.Version, error) {
+		if versionFlagsSet(cctx) {
+			return parseVersion(cctx)
+		}
+		input := new(typesv1.Version)
+		if err := json.NewDecoder(os.Stdin).Decode(input); err != nil {
+			return nil, fmt.Errorf("decoding version from stdin: %w", err)
+		}
+		return input, nil
+	}
+	newPlanPrinter := func(target, auth string) *dryrun.Printer {
+		return &dryrun.Printer{W: os.Stdout, Target: target, Auth: auth}
+	}
+	newReleaseClient := func(cctx *cli.Context) releasev1connect.ReleaseServiceClient {
+		apiURL := cctx.GlobalString(flagAPIURL)
+		releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+		if !dryRun {
+			return releaseClient
+		}
+		auth := "none"
+		if keyID := cctx.GlobalString(flagHMACKeyID); keyID != "" {
+			auth = fmt.Sprintf("hmac (key id %q)", keyID)
+		}
+		return dryrun.ReleaseClient(releaseClient, newPlanPrinter(apiURL, auth))
+	}
+	logDone := func(what string) {
+		if dryRun {
+			log.Printf("dry-run, nothing %s", what)
+			return
+		}
+		log.Print(what)
+	}
+	planCatalog := func(cctx *cli.Context) (*catalog.Plan, error) {
+		manifest, err := catalog.Load(cctx.String(flagManifest))
+		if err != nil {
+			return nil, err
+		}
+		apiURL := cctx.GlobalString(flagAPIURL)
+		updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
+		state, err := catalog.Observe(ctx, newReleaseClient(cctx), updateClient, manifest)
+		if err != nil {
+			return nil, fmt.Errorf("observing current state: %w", err)
+		}
+		plan := catalog.Diff(manifest, state, cctx.Bool(flagPrune))
+		for _, warning := range plan.Warnings {
+			log.Printf("warning: %s", warning)
+		}
+		if len(plan.Actions) == 0 {
+			log.Printf("no changes")
+		}
+		for _, action := range plan.Actions {
+			log.Printf("%s", action)
+		}
+		return plan, nil
+	}
+	s3Flags := func(required bool) []cli.Flag {
+		return []cli.Flag{
+			cli.StringFlag{Name: flagS3Profile, Usage: "shared AWS config profile, defaults to $AWS_PROFILE"},
+			cli.StringFlag{Name: flagS3AccessKey, Usage: "overrides the default AWS credential chain, along with --" + flagS3SecretKey},
+			cli.StringFlag{Name: flagS3SecretKey},
+			cli.StringFlag{Name: flagS3Endpoint, Usage: "defaults to the endpoint of the AWS config"},
+			cli.StringFlag{Name: flagS3Region, Usage: "defaults to the region of the AWS config"},
+			cli.StringFlag{Name: flagS3Bucket, Required: required},
+			cli.BoolFlag{Name: flagS3UsePathStyle},
+		}
+	}
+	// newS3ClientFor configures a client from the s3 flags, unless `override`
+	// says otherwise. Static credentials are ignored if it names a profile.
+	newS3ClientFor := func(cctx *cli.Context, override store.S3Config) (*s3.Client, error) {
+		var opts []func(*config.LoadOptions) error
+		profile := cmp.Or(override.Profile, cctx.String(flagS3Profile))
+		if profile != "" {
+			opts = append(opts, config.WithSharedConfigProfile(profile))
+		}
+		if region := cmp.Or(override.Region, cctx.String(flagS3Region)); region != "" {
+			opts = append(opts, config.WithRegion(region))
+		}
+		accessKey, secretKey := cctx.String(flagS3AccessKey), cctx.String(flagS3SecretKey)
+		if override.Profile == "" && (accessKey != "" || secretKey != "") {
+			if accessKey == "" || secretKey == "" {
+				return nil, fmt.Errorf("--%s and --%s must be given together", flagS3AccessKey, flagS3SecretKey)
+			}
+			opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")))
+		}
+		cfg, err := config.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config: %w", err)
+		}
+		return s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if endpoint := cmp.Or(override.Endpoint, cctx.String(flagS3Endpoint)); endpoint != "" {
+				o.BaseEndpoint = &endpoint
+			}
+			if override.PathStyle || cctx.Bool(flagS3UsePathStyle) {
+				o.UsePathStyle = true
+			}
+		}), nil
+	}
+	newS3Client := func(cctx *cli.Context) (*s3.Client, error) {
+		return newS3ClientFor(cctx, store.S3Config{})
+	}
+	newS3PlanPrinter := func(cctx *cli.Context) *dryrun.Printer {
+		target := cctx.String(flagS3Endpoint)
+		if target == "" {
+			target = "endpoint of the AWS config"
+		}
+		auth := "AWS default credential chain"
+		if accessKey := cctx.String(flagS3AccessKey); accessKey != "" {
+			auth = fmt.Sprintf("static (access key %q)", accessKey)
+		} else if profile := cctx.String(flagS3Profile); profile != "" {
+			auth = fmt.Sprintf("AWS default credential chain (profile %q)", profile)
+		}
+		return newPlanPrinter(target, auth)
+	}
+	storeFlags := []cli.Flag{
+		cli.StringFlag{Name: flagStore, Usage: "where artifacts are stored: s3://<bucket>/<prefix>[?profile=&region=&endpoint=&path_style=], file://<dir>, or the http(s) URL of a WebDAV server authenticated with $" + envStoreToken + "; defaults to the bucket of the s3 flags"},
+		cli.StringFlag{Name: flagStorePublicURL, Usage: "URL at which the store's objects are served"},
+	}
+	openStoreURL := func(cctx *cli.Context, storeURL, publicURL, acl string) (store.ArtifactStore, *dryrun.Printer, error) {
+		partSize := int64(cctx.Int(flagS3PartSize)) << 20
+		if partSize == 0 {
+			partSize = 16 << 20
+		}
+		var statePath func(string) string
+		if p := cctx.String(flagS3StateFile); p != "" {
+			statePath = func(string) string { return p }
+		}
+		st, err := store.Open(storeURL, store.Options{
+			PublicURL:       publicURL,
+			S3Client:        func(cfg store.S3Config) (*s3.Client, error) { return newS3ClientFor(cctx, cfg) },
+			ACL:             acl,
+			PartSize:        partSize,
+			PartConcurrency: cctx.Int(flagS3Parallelism),
+			StatePath:       statePath,
+			Token:           os.Getenv(envStoreToken),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		printer := newS3PlanPrinter(cctx)
+		if _, ok := st.(*store.S3Store); !ok {
+			auth := "none"
+			if os.Getenv(envStoreToken) != "" {
+				auth = "bearer token from $" + envStoreToken
+			}
+			printer = newPlanPrinter(storeURL, auth)
+		}
+		return st, printer, nil
+	}
+	openStore := func(cctx *cli.Context, acl string) (store.ArtifactStore, *dryrun.Printer, error) {
+		storeURL := cctx.String(flagStore)
+		if storeURL == "" {
+			if cctx.String(flagS3Bucket) == "" {
+				return nil, nil, fmt.Errorf("need --%s or --%s", flagStore, flagS3Bucket)
+			}
+			storeURL = "s3://" + cctx.String(flagS3Bucket)
+		}
+		return openStoreURL(cctx, storeURL, cmp.Or(cctx.String(flagStorePublicURL), cctx.String(flagS3PublicURL)), acl)
+	}
+	contentAddressedFlag := cli.BoolFlag{
+		Name:  flagContentAddressed,
+		Usage: "skip files whose content is already uploaded, never overwrite an object, and default the key to " + bucket.ContentAddressedKey,
+	}
+	idempotentFlag := cli.BoolFlag{Name: flagIdempotent, Usage: fmt.Sprintf("succeed if an identical object already exists, exit with code %d if it differs", exitConflict)}
+	checkExisting := func(err error) error {
+		var conflict *release.ConflictError
+		if errors.As(err, &conflict) {
+			return cli.NewExitError(conflict.Error(), exitConflict)
+		} else if err != nil {
+			return fmt.Errorf("checking existing object: %w", err)
+		}
+		log.Print("already exists and is identical")
+		return nil
+	}
+	newGithubClient := func(cctx *cli.Context) *github.Client {
+		return &github.Client{BaseURL: cctx.String(flagGithubAPIURL), Token: github.TokenFromEnv(), HTTP: http.DefaultClient}
+	}
+	openKeyring := func(serviceName string) (keyring.Keyring, error) {
+		return keyring.Open(keyring.Config{
+			ServiceName:            serviceName,
+			KeychainSynchronizable: true,
+			FileDir:                defaultAuthTokenPath,
+			FilePasswordFunc: func(s string) (pwd string, err error) {
+				return "", nil
+			},
+		})
+	}
 	getTokenSource := func(cctx *cli.Context, serviceNameFlagName string) *auth.UserRefreshableTokenSource {
 		return auth.NewRefreshableTokenSource(func() (keyring.Keyring, error) {
-			return keyring.Open(keyring.Config{
-				ServiceName:            cctx.String(serviceNameFlagName),
-				KeychainSynchronizable: true,
-				FileDir:                defaultAuthTokenPath,
-				FilePasswordFunc: func(s string) (pwd string, err error) {
-					return "", nil
-				},
-			})
+			return openKeyring(cctx.String(serviceNameFlagName))
 		})
 	}
+	signingKeyPassword := func() ([]byte, error) {
+		if pwd := os.Getenv(envSigningKeyPassword); pwd != "" {
+			return []byte(pwd), nil
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("$%s is not set and stdin is not a terminal", envSigningKeyPassword)
+		}
+		fmt.Fprint(os.Stderr, "signing key password: ")
+		defer fmt.Fprintln(os.Stderr)
+		return term.ReadPassword(int(os.Stdin.Fd()))
+	}
+	loadSigningKey := func(cctx *cli.Context) (*signing.SecretKey, error) {
+		var data []byte
+		if path := cctx.String(flagSigningSecretKeyFile); path != "" {
+			var err error
+			if data, err = os.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("reading secret key: %w", err)
+			}
+		} else if service := cctx.String(flagSigningKeyring); service != "" {
+			ring, err := openKeyring(service)
+			if err != nil {
+				return nil, fmt.Errorf("opening keyring: %w", err)
+			}
+			item, err := ring.Get(cctx.String(flagSigningKeyringItem))
+			if err != nil {
+				return nil, fmt.Errorf("getting secret key from keyring: %w", err)
+			}
+			data = item.Data
+		} else {
+			return nil, fmt.Errorf("need either --%s or --%s", flagSigningSecretKeyFile, flagSigningKeyring)
+		}
+		return signing.ParseSecretKey(string(data), signingKeyPassword)
+	}
 
 	app.Commands = append(app.Commands, cli.Command{
 		Name: "get",
 		Subcommands: cli.Commands{
 			{
 				Name: "next-update",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{Name: flagProjectName, Required: true},
 					cli.IntFlag{Name: flagEnvironmentId, Required: true},
 					cli.IntFlag{Name: flagMachineId, Required: true},
-					cli.StringFlag{Name: flagVersion},
-					cli.IntFlag{Name: flagVersionMajor},
-					cli.IntFlag{Name: flagVersionMinor},
-					cli.IntFlag{Name: flagVersionPatch},
-					cli.StringSliceFlag{Name: flagVersionPrereleases},
-					cli.StringFlag{Name: flagVersionBuild},
 					cli.StringFlag{Name: flagArtifactArchitecture, Required: true},
 					cli.StringFlag{Name: flagArtifactOperatingSystem, Required: true},
-				},
+				}, versionFlags...),
 				Action: func(cctx *cli.Context) error {
 					apiURL := cctx.GlobalString(flagAPIURL)
 					updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
@@ -293,39 +615,36 @@ func newApp() *cli.App {
 					cli.StringFlag{Name: flagProjectName, Required: true},
 					cli.StringFlag{Name: flagChannelName, Required: true},
 					cli.IntFlag{Name: flagChannelPriority, Required: true},
+					idempotentFlag,
 				},
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+					releaseClient := newReleaseClient(cctx)
 					req := &releasepb.CreateReleaseChannelRequest{
 						ProjectName:     cctx.String(flagProjectName),
 						ChannelName:     cctx.String(flagChannelName),
 						ChannelPriority: int32(cctx.Int(flagChannelPriority)),
 					}
 					res, err := releaseClient.CreateReleaseChannel(ctx, connect.NewRequest(req))
+					if cctx.Bool(flagIdempotent) && release.IsAlreadyExists(err) {
+						return checkExisting(release.CheckExistingReleaseChannel(ctx, releaseClient, req))
+					}
 					if err != nil {
 						return err
 					}
 					_ = res
-					log.Printf("created")
+					logDone("created")
 					return nil
 				},
 			},
 			{
 				Name: "published-version",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{Name: flagProjectName, Required: true},
 					cli.StringFlag{Name: flagChannelName, Required: true},
-					cli.StringFlag{Name: flagVersion},
-					cli.IntFlag{Name: flagVersionMajor},
-					cli.IntFlag{Name: flagVersionMinor},
-					cli.IntFlag{Name: flagVersionPatch},
-					cli.StringSliceFlag{Name: flagVersionPrereleases},
-					cli.StringFlag{Name: flagVersionBuild},
-				},
+					idempotentFlag,
+				}, versionFlags...),
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+					releaseClient := newReleaseClient(cctx)
 					version, err := parseVersion(cctx)
 					if err != nil {
 						return err
@@ -336,95 +655,221 @@ func newApp() *cli.App {
 						Version:            version,
 					}
 					res, err := releaseClient.PublishVersion(ctx, connect.NewRequest(req))
+					if cctx.Bool(flagIdempotent) && release.IsAlreadyExists(err) {
+						updateClient := cliupdatev1connect.NewUpdateServiceClient(client, cctx.GlobalString(flagAPIURL))
+						return checkExisting(release.CheckExistingPublication(ctx, releaseClient, updateClient, req))
+					}
 					if err != nil {
 						return err
 					}
 					_ = res
-					log.Printf("created")
+					logDone("created")
 					return nil
 				},
 			},
 			{
-				Name: "s3-artifact",
-				Flags: []cli.Flag{
-					cli.StringFlag{Name: flagFilepath, Required: true},
-					cli.StringFlag{Name: flagS3AccessKey, Required: true},
-					cli.StringFlag{Name: flagS3SecretKey, Required: true},
-					cli.StringFlag{Name: flagS3Endpoint, Required: true},
-					cli.StringFlag{Name: flagS3Region, Required: true},
-					cli.StringFlag{Name: flagS3Bucket, Required: true},
-					cli.StringFlag{Name: flagS3Directory, Required: true},
-					cli.BoolFlag{Name: flagS3UsePathStyle},
+				Name:  "s3-artifact",
+				Usage: "upload files to an artifact store, the S3 bucket of the s3 flags unless --" + flagStore + " says otherwise",
+				Flags: append(append([]cli.Flag{
+					cli.StringSliceFlag{Name: flagFilepath, Required: true, Usage: "file, glob or directory to upload, can be repeated"},
+					cli.StringFlag{Name: flagS3Directory, Usage: "key of the object, when uploading a single file without --" + flagS3KeyTemplate},
+					cli.StringFlag{Name: flagS3KeyTemplate, Usage: "Go template of the object keys, e.g. {{.Project}}/{{.Version}}/{{.Filename}}, which can also use {{.Path}} relative to an uploaded directory"},
+					cli.StringFlag{Name: flagProjectName, Usage: "project given to the key template"},
+					cli.StringFlag{Name: flagVersion, Usage: "version given to the key template"},
+					cli.StringFlag{Name: flagS3PublicURL, Usage: "URL at which the bucket's objects are served, to list the public URL of each upload; same as --" + flagStorePublicURL},
 					cli.StringFlag{Name: flagS3ACL, Value: string(types.ObjectCannedACLPublicRead)},
 					cli.StringFlag{Name: flagS3CacheControl, Value: `max-age=9999,public`},
-				},
+					cli.IntFlag{Name: flagConcurrency, Value: 4, Usage: "how many files are uploaded at once"},
+					cli.IntFlag{Name: flagS3PartSize, Value: 16, Usage: "files larger than this are uploaded in parts of this size"},
+					cli.IntFlag{Name: flagS3Parallelism, Value: 4, Usage: "how many parts of a file are uploaded at once"},
+					cli.StringFlag{Name: flagS3StateFile, Usage: "where multipart upload progress is saved, defaults to a hidden file next to the uploaded file"},
+					contentAddressedFlag,
+				}, storeFlags...), s3Flags(false)...),
 				Action: func(cctx *cli.Context) error {
-					accessKey := cctx.String(flagS3AccessKey)
-					secretKey := cctx.String(flagS3SecretKey)
-					endpoint := cctx.String(flagS3Endpoint)
-					region := cctx.String(flagS3Region)
-					bucket := cctx.String(flagS3Bucket)
-					directory := cctx.String(flagS3Directory)
-					usePathStyle := cctx.Bool(flagS3UsePathStyle)
-					acl := cctx.String(flagS3ACL)
-					cacheControl := cctx.String(flagS3CacheControl)
-					filepath := cctx.String(flagFilepath)
+					files, err := bucket.ExpandFiles(cctx.StringSlice(flagFilepath))
+					if err != nil {
+						return err
+					}
+					contentAddressed := cctx.Bool(flagContentAddressed)
+					tmpl := cctx.String(flagS3KeyTemplate)
+					if tmpl == "" && contentAddressed {
+						tmpl = bucket.ContentAddressedKey
+					}
+					var keyFor func(f bucket.File, sum string) (string, error)
+					if tmpl != "" {
+						kt, err := bucket.ParseKeyTemplate(tmpl)
+						if err != nil {
+							return err
+						}
+						keyFor = func(f bucket.File, sum string) (string, error) {
+							return kt.Key(bucket.KeyData{
+								Project:  cctx.String(flagProjectName),
+								Version:  cctx.String(flagVersion),
+								Filename: path.Base(f.Rel),
+								Path:     f.Rel,
+								Ext:      bucket.Ext(f.Rel),
+								Sha256:   sum,
+							})
+						}
+					} else if directory := cctx.String(flagS3Directory); directory != "" && len(files) == 1 {
+						keyFor = func(bucket.File, string) (string, error) { return directory, nil }
+					} else {
+						return fmt.Errorf("need --%s, or --%s when uploading a single file", flagS3KeyTemplate, flagS3Directory)
+					}
+					statePath := cctx.String(flagS3StateFile)
+					if statePath != "" && len(files) > 1 {
+						return fmt.Errorf("--%s can only be used when uploading a single file", flagS3StateFile)
+					}
 
-					client := s3.New(s3.Options{
-						Region:       region,
-						BaseEndpoint: &endpoint,
-						UsePathStyle: usePathStyle,
-						Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
-							accessKey,
-							secretKey,
-							"",
-						)),
-					})
+					// content addressed keys need the sums up front, they're
+					// computed while uploading otherwise
+					var (
+						keys   = make([]string, 0, len(files))
+						sums   = make([]string, 0, len(files))
+						unique = files[:0]
+						byKey  = make(map[string]string, len(files))
+					)
+					for _, f := range files {
+						var sum string
+						if contentAddressed {
+							if sum, err = release.FileSHA256(f.Path); err != nil {
+								return err
+							}
+						}
+						key, err := keyFor(f, sum)
+						if err != nil {
+							return err
+						}
+						if other, ok := byKey[key]; ok && contentAddressed {
+							log.Printf("- skipping %s, same content as %s", f.Path, other)
+							continue
+						} else if ok {
+							return fmt.Errorf("%q and %q would both be uploaded to %q", other, f.Path, key)
+						}
+						byKey[key] = f.Path
+						keys = append(keys, key)
+						sums = append(sums, sum)
+						unique = append(unique, f)
+					}
+					files = unique
 
-					file, err := os.Open(filepath)
+					st, printer, err := openStore(cctx, cctx.String(flagS3ACL))
 					if err != nil {
-						return fmt.Errorf("opening filepath %q: %v", filepath, err)
+						return err
+					}
+					putOpts := func(f bucket.File) store.PutOptions {
+						return store.PutOptions{
+							Size:         -1,
+							ContentType:  bucket.ContentType(f.Path),
+							CacheControl: cctx.String(flagS3CacheControl),
+							IfAbsent:     contentAddressed,
+						}
+					}
+					if dryRun {
+						for i, f := range files {
+							if err := printer.JSON("Put", map[string]any{"key": keys[i], "options": putOpts(f)}, f.Path); err != nil {
+								return err
+							}
+						}
+						logDone("created in object storage")
+						return nil
 					}
-					defer file.Close()
 
-					output, err := client.PutObject(ctx, &s3.PutObjectInput{
-						Bucket:       aws.String(bucket),
-						Key:          aws.String(directory),
-						Body:         file,
-						CacheControl: aws.String(cacheControl),
-						ACL:          types.ObjectCannedACL(acl),
-					})
-					if err != nil {
-						return fmt.Errorf("putting object %q: %v", filepath, err)
+					var total int64
+					for _, f := range files {
+						if fi, err := os.Stat(f.Path); err == nil {
+							total += fi.Size()
+						}
 					}
-					enc := json.NewEncoder(os.Stdout)
-					enc.SetIndent("", "  ")
-					if err := enc.Encode(output); err != nil {
-						log.Printf("operation succeeded but error printing result: %v", err)
+					name := fmt.Sprintf("uploading %d files", len(files))
+					if len(files) == 1 {
+						name = "uploading " + filepath.Base(files[0].Path)
+					}
+					p := progress.New(name, total)
+					defer p.Done()
+
+					upload := func(f bucket.File, key, sum string) (*bucket.PutResult, error) {
+						res := &bucket.PutResult{Path: f.Path, Key: key, URL: st.URL(key), Sha256: sum}
+						var err error
+						if res.Sha256 == "" {
+							if res.Sha256, err = release.FileSHA256(f.Path); err != nil {
+								return nil, err
+							}
+						}
+						file, err := os.Open(f.Path)
+						if err != nil {
+							return nil, err
+						}
+						defer file.Close()
+						fi, err := file.Stat()
+						if err != nil {
+							return nil, err
+						}
+						res.Size = fi.Size()
+						opts := putOpts(f)
+						opts.Size, opts.Sha256, opts.Progress = res.Size, res.Sha256, p
+						if contentAddressed {
+							res.Existed, err = store.PutIfAbsent(ctx, st, key, file, opts)
+						} else {
+							err = st.Put(ctx, key, file, opts)
+						}
+						if err != nil {
+							return nil, err
+						}
+						return res, nil
+					}
+					var (
+						wg     sync.WaitGroup
+						mu     sync.Mutex
+						failed int
+						sem    = make(chan struct{}, max(cctx.Int(flagConcurrency), 1))
+						enc    = json.NewEncoder(os.Stdout)
+					)
+					for i, f := range files {
+						wg.Add(1)
+						sem <- struct{}{}
+						go func() {
+							defer func() { <-sem; wg.Done() }()
+							res, err := upload(f, keys[i], sums[i])
+							mu.Lock()
+							defer mu.Unlock()
+							if err != nil {
+								log.Printf("- failed %s: %v", f.Path, err)
+								failed++
+								return
+							}
+							if res.Existed {
+								log.Printf("- %s already uploaded to %q", f.Path, res.Key)
+							} else {
+								log.Printf("- uploaded %s to %q", f.Path, res.Key)
+							}
+							if err := enc.Encode(res); err != nil {
+								log.Printf("operation succeeded but error printing result: %v", err)
+							}
+						}()
+					}
+					wg.Wait()
+					p.Done()
+					if failed > 0 {
+						return fmt.Errorf("%d/%d files failed to upload", failed, len(files))
 					}
 					log.Printf("created in object storage")
-					return err
+					return nil
 				},
 			},
 			{
 				Name: "version-artifact",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{Name: flagProjectName, Required: true},
-					cli.StringFlag{Name: flagVersion},
-					cli.IntFlag{Name: flagVersionMajor},
-					cli.IntFlag{Name: flagVersionMinor},
-					cli.IntFlag{Name: flagVersionPatch},
-					cli.StringSliceFlag{Name: flagVersionPrereleases},
-					cli.StringFlag{Name: flagVersionBuild},
 					cli.StringFlag{Name: flagArtifactUrl, Required: true},
 					cli.StringFlag{Name: flagArtifactSha256, Required: true},
 					cli.StringFlag{Name: flagArtifactSignature, Required: false},
 					cli.StringFlag{Name: flagArtifactArchitecture, Required: true},
 					cli.StringFlag{Name: flagArtifactOperatingSystem, Required: true},
-				},
+					idempotentFlag,
+				}, versionFlags...),
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+					releaseClient := newReleaseClient(cctx)
 					version, err := parseVersion(cctx)
 					if err != nil {
 						return err
@@ -441,11 +886,14 @@ func newApp() *cli.App {
 						},
 					}
 					res, err := releaseClient.CreateVersionArtifact(ctx, connect.NewRequest(req))
+					if cctx.Bool(flagIdempotent) && release.IsAlreadyExists(err) {
+						return checkExisting(release.CheckExistingVersionArtifact(ctx, releaseClient, req))
+					}
 					if err != nil {
 						return err
 					}
 					_ = res
-					log.Printf("created")
+					logDone("created")
 					// TODO: do something
 					return nil
 				},
@@ -457,19 +905,12 @@ func newApp() *cli.App {
 		Subcommands: cli.Commands{
 			{
 				Name: "published-version",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{Name: flagProjectName, Required: true},
 					cli.StringFlag{Name: flagChannelName, Required: true},
-					cli.StringFlag{Name: flagVersion},
-					cli.IntFlag{Name: flagVersionMajor},
-					cli.IntFlag{Name: flagVersionMinor},
-					cli.IntFlag{Name: flagVersionPatch},
-					cli.StringSliceFlag{Name: flagVersionPrereleases},
-					cli.StringFlag{Name: flagVersionBuild},
-				},
+				}, versionFlags...),
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+					releaseClient := newReleaseClient(cctx)
 					version, err := parseVersion(cctx)
 					if err != nil {
 						return err
@@ -484,29 +925,22 @@ func newApp() *cli.App {
 						return err
 					}
 					_ = res
-					log.Printf("deleted")
+					logDone("deleted")
 					return nil
 				},
 			},
 			{
 				Name: "version-artifact",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{Name: flagProjectName, Required: true},
-					cli.StringFlag{Name: flagVersion},
-					cli.IntFlag{Name: flagVersionMajor},
-					cli.IntFlag{Name: flagVersionMinor},
-					cli.IntFlag{Name: flagVersionPatch},
-					cli.StringSliceFlag{Name: flagVersionPrereleases},
-					cli.StringFlag{Name: flagVersionBuild},
 					cli.StringFlag{Name: flagArtifactUrl, Required: true},
 					cli.StringFlag{Name: flagArtifactSha256, Required: true},
 					cli.StringFlag{Name: flagArtifactSignature, Required: true},
 					cli.StringFlag{Name: flagArtifactArchitecture, Required: true},
 					cli.StringFlag{Name: flagArtifactOperatingSystem, Required: true},
-				},
+				}, versionFlags...),
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+					releaseClient := newReleaseClient(cctx)
 					version, err := parseVersion(cctx)
 					if err != nil {
 						return err
@@ -527,7 +961,7 @@ func newApp() *cli.App {
 						return err
 					}
 					_ = res
-					log.Printf("deleted")
+					logDone("deleted")
 					return nil
 				},
 			},
@@ -544,8 +978,7 @@ func newApp() *cli.App {
 					cli.Int64Flag{Name: flagLimit},
 				},
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+					releaseClient := newReleaseClient(cctx)
 					var cursor *typesv1.Cursor
 					if opaque := cctx.String(flagCursor); opaque != "" {
 						cursor = &typesv1.Cursor{Opaque: []byte(opaque)}
@@ -580,8 +1013,7 @@ func newApp() *cli.App {
 					cli.Int64Flag{Name: flagLimit},
 				},
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					releaseClient := releasev1connect.NewReleaseServiceClient(client, apiURL)
+					releaseClient := newReleaseClient(cctx)
 					var cursor *typesv1.Cursor
 					if opaque := cctx.String(flagCursor); opaque != "" {
 						cursor = &typesv1.Cursor{Opaque: []byte(opaque)}
@@ -687,127 +1119,1359 @@ func newApp() *cli.App {
 	})
 
 	app.Commands = append(app.Commands, cli.Command{
-		Name: "version",
+		Name: "release",
 		Subcommands: cli.Commands{
 			{
-				Name: "check",
+				Name:  "publish",
+				Usage: "register the archives of a goreleaser run and publish the version",
 				Flags: []cli.Flag{
-					cli.IntFlag{Name: flagMachineId, Value: -1},
+					cli.StringFlag{Name: flagProjectName, Usage: "defaults to the project name in goreleaser's metadata"},
+					cli.StringFlag{Name: flagChannelName, Value: "main", EnvVar: "CHANNEL"},
+					cli.StringFlag{Name: flagDistDir, Value: "dist"},
+					cli.StringFlag{Name: flagDistExtraDir, Value: "dist-extra"},
+					cli.StringFlag{Name: flagGithubOwner, Value: "humanlogio"},
+					cli.StringFlag{Name: flagGithubAPIURL, Value: github.DefaultBaseURL, EnvVar: "GITHUB_API_URL", Usage: "GitHub REST API used to find release assets, authenticated with $GITHUB_TOKEN or $GH_TOKEN"},
+					cli.StringFlag{Name: flagChecksums, Usage: "sha256sum formatted checksums that the archives must match, defaults to the checksums file listed in goreleaser's artifacts"},
 				},
 				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
-					machineId := cctx.Int64(flagMachineId)
-					res, err := updateClient.GetNextUpdate(ctx, connect.NewRequest(&cliupdatepb.GetNextUpdateRequest{
-						ProjectName:            "apictl",
-						CurrentVersion:         version,
-						MachineArchitecture:    runtime.GOARCH,
-						MachineOperatingSystem: runtime.GOOS,
-						Meta: &typesv1.ReqMeta{
-							MachineId: machineId,
-						},
-					}))
+					releaseClient := newReleaseClient(cctx)
+					dist, err := release.LoadDist(cctx.String(flagDistDir), cctx.String(flagDistExtraDir))
 					if err != nil {
-						return err
+						return fmt.Errorf("loading goreleaser dist: %w", err)
 					}
-					msg := res.Msg
-					meta := msg.Meta
-					if machineId != meta.MachineId {
-						log.Printf("a machine id was assigned: %d", meta.MachineId)
+					project := cctx.String(flagProjectName)
+					if project == "" {
+						project = dist.Metadata.ProjectName
 					}
-
-					currentSV, err := version.AsSemver()
-					if err != nil {
-						return err
+					publisher := &release.Publisher{
+						Client:  releaseClient,
+						Project: project,
+						Channel: cctx.String(flagChannelName),
+						URLFor:  release.DefaultURLFor(dist, newGithubClient(cctx), cctx.String(flagGithubOwner)),
 					}
-					nextSV, err := msg.NextVersion.AsSemver()
-					if err != nil {
-						return err
+					checksumsPath := cctx.String(flagChecksums)
+					if checksumsPath == "" {
+						checksumsPath, _ = dist.ChecksumsPath()
 					}
-					if currentSV.GTE(nextSV) {
-						log.Printf("you're already running the latest version: v%v", semverVersion.String())
-						return nil
+					if checksumsPath != "" {
+						if publisher.Checksums, err = release.LoadChecksums(checksumsPath); err != nil {
+							return fmt.Errorf("loading checksums: %w", err)
+						}
+						log.Printf("checking archives against %q", checksumsPath)
 					}
-					log.Printf("you are running v%s", currentSV)
-					log.Printf("a newer version v%s is available here:", nextSV)
-					log.Printf("- url: %s", msg.NextArtifact.Url)
-					log.Printf("- sha256: %s", msg.NextArtifact.Sha256)
-					log.Printf("- sig: %s", msg.NextArtifact.Signature)
-					log.Printf("run `apictl version update` to update")
-					return nil
-				},
-			},
-			{
-				Name: "update",
-				Flags: []cli.Flag{
-					cli.IntFlag{Name: flagMachineId, Value: -1},
-				},
-				Action: func(cctx *cli.Context) error {
-					apiURL := cctx.GlobalString(flagAPIURL)
-					updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
-					machineId := cctx.Int64(flagMachineId)
-					res, err := updateClient.GetNextUpdate(ctx, connect.NewRequest(&cliupdatepb.GetNextUpdateRequest{
-						ProjectName:            "apictl",
-						CurrentVersion:         version,
-						MachineArchitecture:    runtime.GOARCH,
-						MachineOperatingSystem: runtime.GOOS,
-						Meta: &typesv1.ReqMeta{
-							MachineId: machineId,
-						},
-					}))
+					version, err := dist.Version()
 					if err != nil {
 						return err
 					}
-					msg := res.Msg
-					meta := msg.Meta
-					if machineId != meta.MachineId {
-						log.Printf("a machine id was assigned: %d", meta.MachineId)
-					}
-
-					currentSV, err := version.AsSemver()
-					if err != nil {
-						return err
+					log.Printf("publishing %s v%s on channel %q", project, versions.String(version), publisher.Channel)
+					results, err := publisher.Publish(ctx, dist)
+					enc := json.NewEncoder(os.Stdout)
+					for _, res := range results {
+						if res.Err != nil {
+							log.Printf("- failed %s: %v", res.Name, res.Err)
+						} else {
+							log.Printf("- registered %s", res.Name)
+						}
+						if err := enc.Encode(res); err != nil {
+							log.Printf("can't encode result to stdout: %v", err)
+						}
 					}
-					nextSV, err := msg.NextVersion.AsSemver()
 					if err != nil {
 						return err
 					}
-					if currentSV.GTE(nextSV) {
-						log.Printf("you're already running the latest version: v%v", semverVersion.String())
-						return nil
-					}
-					return selfupdate.UpgradeInPlace(ctx, "apictl", os.Stdout, os.Stderr, os.Stdin)
-				},
-			},
-			{
-				Name: "to-json",
-				Flags: []cli.Flag{
-					cli.StringFlag{Name: flagVersion},
-					cli.IntFlag{Name: flagVersionMajor},
-					cli.IntFlag{Name: flagVersionMinor},
-					cli.IntFlag{Name: flagVersionPatch},
-					cli.StringSliceFlag{Name: flagVersionPrereleases},
-					cli.StringFlag{Name: flagVersionBuild},
-				},
-				Action: func(cctx *cli.Context) error {
-					version, err := parseVersion(cctx)
-					if err != nil {
-						return fmt.Errorf("parsing version flag: %w", err)
-					}
-					if err := json.NewEncoder(os.Stdout).Encode(version); err != nil {
-						return fmt.Errorf("encoding to stdout: %w", err)
-					}
+					logDone("published")
 					return nil
 				},
 			},
-			{
-				Name: "from-json",
-				Action: func(cctx *cli.Context) error {
-					input := new(typesv1.Version)
-					if err := json.NewDecoder(os.Stdin).Decode(input); err != nil {
-						return fmt.Errorf("decoding version from stdin: %w", err)
-					}
-					sv, err := input.AsSemver()
+		},
+	})
+
+	catalogFlags := []cli.Flag{
+		cli.StringFlag{Name: flagManifest + ", f", Required: true, Usage: "path to a YAML or JSON manifest, or `-` for stdin"},
+		cli.BoolFlag{Name: flagPrune, Usage: "delete and unpublish what the manifest doesn't declare"},
+	}
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "diff",
+		Usage: "show what `apply` would change to converge to a release catalog manifest",
+		Flags: catalogFlags,
+		Action: func(cctx *cli.Context) error {
+			plan, err := planCatalog(cctx)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(plan); err != nil {
+				return fmt.Errorf("encoding plan to stdout: %w", err)
+			}
+			return nil
+		},
+	})
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "apply",
+		Usage: "converge the release catalog of a project to a manifest",
+		Flags: catalogFlags,
+		Action: func(cctx *cli.Context) error {
+			plan, err := planCatalog(cctx)
+			if err != nil {
+				return err
+			}
+			err = plan.Apply(ctx, newReleaseClient(cctx), func(action *catalog.Action) {
+				log.Printf("done: %s", action)
+			})
+			if err != nil {
+				return err
+			}
+			logDone("applied")
+			return nil
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "promote",
+		Usage: "publish on a channel a version currently served on another one",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{Name: flagProjectName, Required: true},
+			cli.StringFlag{Name: flagFromChannel, Required: true},
+			cli.StringFlag{Name: flagToChannel, Required: true},
+			cli.StringFlag{Name: flagPlatforms, Value: defaultPlatforms, Usage: "comma separated `os/arch` pairs the version must have artifacts for"},
+		}, versionFlags...),
+		Action: func(cctx *cli.Context) error {
+			apiURL := cctx.GlobalString(flagAPIURL)
+			releaseClient := newReleaseClient(cctx)
+			updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
+			version, err := parseVersion(cctx)
+			if err != nil {
+				return err
+			}
+			platforms, err := release.ParsePlatforms([]string{cctx.String(flagPlatforms)})
+			if err != nil {
+				return err
+			}
+			promotion := &release.Promotion{
+				Project:   cctx.String(flagProjectName),
+				Version:   version,
+				From:      cctx.String(flagFromChannel),
+				To:        cctx.String(flagToChannel),
+				Platforms: platforms,
+			}
+			log.Printf("promoting %s from %q to %q", versions.String(version), promotion.From, promotion.To)
+			if err := promotion.Run(ctx, releaseClient, updateClient); err != nil {
+				return err
+			}
+			logDone("promoted")
+			return nil
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "rollback",
+		Usage: "unpublish a version from a channel and verify what each platform receives instead",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{Name: flagProjectName, Required: true},
+			cli.StringFlag{Name: flagChannelName, Required: true},
+		}, versionFlags...),
+		Action: func(cctx *cli.Context) error {
+			apiURL := cctx.GlobalString(flagAPIURL)
+			releaseClient := newReleaseClient(cctx)
+			updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
+			version, err := parseVersion(cctx)
+			if err != nil {
+				return err
+			}
+			rollback := &release.Rollback{
+				Project: cctx.String(flagProjectName),
+				Channel: cctx.String(flagChannelName),
+				Version: version,
+			}
+			platforms, err := rollback.Platforms(ctx, releaseClient)
+			if err != nil {
+				return err
+			}
+			log.Printf("rolling back %s from channel %q", versions.String(version), rollback.Channel)
+			if err := rollback.Unpublish(ctx, releaseClient); err != nil {
+				return err
+			}
+			if dryRun {
+				// the channel still serves the version, checking it would
+				// only report it as stuck
+				log.Printf("dry-run, skipping the check of what %d platforms receive instead", len(platforms))
+				logDone("unpublished")
+				return nil
+			}
+			resolutions, err := rollback.Verify(ctx, updateClient, platforms)
+			enc := json.NewEncoder(os.Stdout)
+			for _, res := range resolutions {
+				if res.Version == nil {
+					log.Printf("- %s now receives nothing", res.Platform)
+				} else {
+					log.Printf("- %s now receives %s", res.Platform, versions.String(res.Version))
+				}
+				if err := enc.Encode(res); err != nil {
+					log.Printf("can't encode result to stdout: %v", err)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			log.Printf("rolled back")
+			return nil
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name: "verify",
+		Subcommands: cli.Commands{
+			{
+				Name:  "version-artifact",
+				Usage: "download the artifacts of a version and check their sha256 and signature",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{Name: flagProjectName, Required: true},
+					cli.StringFlag{Name: flagSigningPublicKey, EnvVar: "SIGNING_PUBLIC_KEY", Usage: "minisign public key, or path to it; signatures are left unchecked without it"},
+					cli.IntFlag{Name: flagConcurrency, Value: 4},
+				}, versionFlags...),
+				Action: func(cctx *cli.Context) error {
+					releaseClient := newReleaseClient(cctx)
+					version, err := parseVersion(cctx)
+					if err != nil {
+						return err
+					}
+					verifier := &release.ArtifactVerifier{
+						Client:      http.DefaultClient,
+						Concurrency: cctx.Int(flagConcurrency),
+					}
+					if pk := cctx.String(flagSigningPublicKey); pk != "" {
+						if verifier.PublicKey, err = signing.LoadPublicKey(pk); err != nil {
+							return fmt.Errorf("loading public key: %w", err)
+						}
+					} else {
+						log.Printf("no public key configured, signatures won't be checked")
+					}
+					items, err := release.ListAllVersionArtifacts(ctx, releaseClient, cctx.String(flagProjectName))
+					if err != nil {
+						return err
+					}
+					item := release.FindVersion(items, version)
+					if item == nil || len(item.Artifacts) == 0 {
+						return fmt.Errorf("version %s has no artifacts", versions.String(version))
+					}
+					log.Printf("verifying %d artifacts of version %s", len(item.Artifacts), versions.String(version))
+					verifier.Progress = progress.New(fmt.Sprintf("downloading %d artifacts", len(item.Artifacts)), -1)
+					checks := verifier.Verify(ctx, item.Artifacts)
+					verifier.Progress.Done()
+					var failed int
+					enc := json.NewEncoder(os.Stdout)
+					for _, check := range checks {
+						if check.OK() {
+							log.Printf("- pass %s: sha256 matches, signature %s", check.Platform, check.Signature)
+						} else {
+							failed++
+							log.Printf("- FAIL %s: sha256 matches=%v, signature %s: %s", check.Platform, check.Sha256OK, check.Signature, check.Error)
+						}
+						if err := enc.Encode(check); err != nil {
+							log.Printf("can't encode result to stdout: %v", err)
+						}
+					}
+					if failed > 0 {
+						return fmt.Errorf("%d/%d artifacts failed verification", failed, len(item.Artifacts))
+					}
+					log.Printf("all artifacts verified")
+					return nil
+				},
+			},
+		},
+	})
+
+	secretKeyFlags := []cli.Flag{
+		cli.StringFlag{Name: flagSigningSecretKeyFile, EnvVar: "SIGNING_SECRET_KEY_FILE", Usage: "path to a minisign secret key"},
+		cli.StringFlag{Name: flagSigningKeyring, Usage: "keyring service holding the secret key, used if no secret key file is given"},
+		cli.StringFlag{Name: flagSigningKeyringItem, Value: "apictl-signing-key"},
+	}
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "sign",
+		Usage: "sign artifacts with minisign compatible ed25519 keys",
+		Subcommands: cli.Commands{
+			{
+				Name:  "keygen",
+				Usage: "generate a signing key pair",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{Name: flagSigningPublicKeyFile, Usage: "where to write the public key, which is printed either way"},
+					cli.BoolFlag{Name: flagSigningEncrypt, Usage: "encrypt the secret key with a password, read from $" + envSigningKeyPassword + " or prompted"},
+				}, secretKeyFlags...),
+				Action: func(cctx *cli.Context) error {
+					sk, err := signing.GenerateKey()
+					if err != nil {
+						return fmt.Errorf("generating key: %w", err)
+					}
+					var password []byte
+					if cctx.Bool(flagSigningEncrypt) {
+						if password, err = signingKeyPassword(); err != nil {
+							return err
+						}
+					}
+					encoded, err := sk.Marshal(password)
+					if err != nil {
+						return fmt.Errorf("encoding secret key: %w", err)
+					}
+					if path := cctx.String(flagSigningSecretKeyFile); path != "" {
+						f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+						if err != nil {
+							return fmt.Errorf("creating secret key file: %w", err)
+						}
+						if _, err := f.WriteString(encoded); err != nil {
+							_ = f.Close()
+							return fmt.Errorf("writing secret key file: %w", err)
+						}
+						if err := f.Close(); err != nil {
+							return fmt.Errorf("writing secret key file: %w", err)
+						}
+						log.Printf("secret key written to %q", path)
+					} else if service := cctx.String(flagSigningKeyring); service != "" {
+						ring, err := openKeyring(service)
+						if err != nil {
+							return fmt.Errorf("opening keyring: %w", err)
+						}
+						err = ring.Set(keyring.Item{
+							Key:   cctx.String(flagSigningKeyringItem),
+							Data:  []byte(encoded),
+							Label: "apictl signing key " + sk.KeyID.String(),
+						})
+						if err != nil {
+							return fmt.Errorf("storing secret key in keyring: %w", err)
+						}
+						log.Printf("secret key stored in keyring %q", service)
+					} else {
+						return fmt.Errorf("need either --%s or --%s", flagSigningSecretKeyFile, flagSigningKeyring)
+					}
+					pk := sk.Public().String()
+					if path := cctx.String(flagSigningPublicKeyFile); path != "" {
+						if err := os.WriteFile(path, []byte(pk), 0644); err != nil {
+							return fmt.Errorf("writing public key file: %w", err)
+						}
+						log.Printf("public key written to %q", path)
+					}
+					_, err = os.Stdout.WriteString(pk)
+					return err
+				},
+			},
+			{
+				Name:      "file",
+				Usage:     "sign files, writing each signature next to them as `<file>.sig`",
+				ArgsUsage: "<file>...",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{Name: flagSigningTrustedComment, Usage: "defaults to the timestamp and filename, like minisign"},
+				}, secretKeyFlags...),
+				Action: func(cctx *cli.Context) error {
+					if !cctx.Args().Present() {
+						log.Printf("no file to sign")
+						return cli.ShowSubcommandHelp(cctx)
+					}
+					sk, err := loadSigningKey(cctx)
+					if err != nil {
+						return err
+					}
+					for _, path := range cctx.Args() {
+						trustedComment := cctx.String(flagSigningTrustedComment)
+						if trustedComment == "" {
+							trustedComment = signing.DefaultTrustedComment(path)
+						}
+						f, err := os.Open(path)
+						if err != nil {
+							return err
+						}
+						sig, err := sk.Sign(f, trustedComment)
+						_ = f.Close()
+						if err != nil {
+							return fmt.Errorf("signing %q: %w", path, err)
+						}
+						if err := os.WriteFile(path+".sig", []byte(sig.String()), 0644); err != nil {
+							return fmt.Errorf("writing signature of %q: %w", path, err)
+						}
+						log.Printf("signed %q", path)
+						if _, err := os.Stdout.WriteString(sig.String()); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+		},
+	})
+	app.Commands = append(app.Commands, cli.Command{
+		Name:      "verify-signature",
+		Usage:     "check a file against a minisign signature",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: flagSigningPublicKey, EnvVar: "SIGNING_PUBLIC_KEY", Required: true, Usage: "minisign public key, or path to it"},
+			cli.StringFlag{Name: flagArtifactSignature, Usage: "signature as stored in a version artifact, or path to it; defaults to `<file>.sig`"},
+		},
+		Action: func(cctx *cli.Context) error {
+			path := cctx.Args().First()
+			if path == "" {
+				log.Printf("no file to verify")
+				return cli.ShowCommandHelp(cctx, cctx.Command.Name)
+			}
+			pk, err := signing.LoadPublicKey(cctx.String(flagSigningPublicKey))
+			if err != nil {
+				return fmt.Errorf("loading public key: %w", err)
+			}
+			rawSig := cctx.String(flagArtifactSignature)
+			if rawSig == "" {
+				rawSig = path + ".sig"
+			}
+			sig, err := signing.ParseSignature(rawSig)
+			if err != nil {
+				data, rerr := os.ReadFile(rawSig)
+				if rerr != nil {
+					return fmt.Errorf("not a signature (%v), nor a readable file: %w", err, rerr)
+				}
+				if sig, err = signing.ParseSignature(string(data)); err != nil {
+					return fmt.Errorf("parsing signature: %w", err)
+				}
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := signing.Verify(pk, f, sig); err != nil {
+				return fmt.Errorf("%q: %w", path, err)
+			}
+			log.Printf("signature and comment signature verified")
+			log.Printf("trusted comment: %s", sig.TrustedComment)
+			return nil
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name: "prune",
+		Subcommands: cli.Commands{
+			{
+				Name:  "version-artifact",
+				Usage: "delete the artifacts of old versions, keeping the most recent ones and whatever channels serve",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{Name: flagProjectName, Required: true},
+					cli.IntFlag{Name: flagKeepLatest, Required: true},
+					cli.StringFlag{Name: flagPrereleasePrefix, Usage: "only prune versions whose prerelease starts with this, e.g. `next`"},
+					cli.BoolFlag{Name: flagS3Delete, Usage: "also delete the objects backing the artifacts"},
+					cli.StringFlag{Name: flagS3PublicURL, Usage: "URL at which the bucket's objects are served, to map artifact URLs to object keys"},
+				}, s3Flags(false)...),
+				Action: func(cctx *cli.Context) error {
+					apiURL := cctx.GlobalString(flagAPIURL)
+					releaseClient := newReleaseClient(cctx)
+					updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
+					project := cctx.String(flagProjectName)
+
+					var (
+						s3Store    *store.S3Store
+						bucketName = cctx.String(flagS3Bucket)
+						publicURL  = cctx.String(flagS3PublicURL)
+					)
+					if cctx.Bool(flagS3Delete) {
+						if bucketName == "" || publicURL == "" {
+							return fmt.Errorf("--%s requires --%s and --%s", flagS3Delete, flagS3Bucket, flagS3PublicURL)
+						}
+						s3Client, err := newS3Client(cctx)
+						if err != nil {
+							return err
+						}
+						s3Store = &store.S3Store{Client: s3Client, Bucket: bucketName, PublicURL: publicURL}
+					}
+
+					items, err := release.ListAllVersionArtifacts(ctx, releaseClient, project)
+					if err != nil {
+						return err
+					}
+					retention := &release.Retention{
+						KeepLatest:       cctx.Int(flagKeepLatest),
+						PrereleasePrefix: cctx.String(flagPrereleasePrefix),
+					}
+					expired := retention.Expired(items)
+					if len(expired) == 0 {
+						log.Printf("nothing to prune")
+						return nil
+					}
+					heads, err := release.ChannelHeads(ctx, releaseClient, updateClient, project, release.PlatformsOf(items))
+					if err != nil {
+						return err
+					}
+					for _, item := range expired {
+						if servedOn, ok := heads[versions.String(item.Version)]; ok {
+							log.Printf("keeping %s, it's the head of %s", versions.String(item.Version), strings.Join(servedOn, ", "))
+						}
+					}
+					prunable := release.Unserved(expired, heads)
+					if s3Store != nil {
+						// refuse before deleting anything, rather than leave
+						// objects behind
+						var unmapped []string
+						for _, item := range prunable {
+							for _, artifact := range item.Artifacts {
+								if _, ok := store.KeyForURL(s3Store, artifact.Url); !ok && store.Serves(s3Store, artifact.Url) {
+									unmapped = append(unmapped, artifact.Url)
+								}
+							}
+						}
+						if len(unmapped) > 0 {
+							for _, u := range unmapped {
+								log.Printf("- can't map %q to an object key", u)
+							}
+							return fmt.Errorf("%d artifact URLs point at the bucket but can't be mapped to object keys, check --%s", len(unmapped), flagS3PublicURL)
+						}
+					}
+					var deleted, kept int
+					for _, item := range prunable {
+						version := versions.String(item.Version)
+						for _, artifact := range item.Artifacts {
+							log.Printf("pruning %s %s (%s)", version, release.PlatformOf(artifact), artifact.Url)
+							_, err := releaseClient.DeleteVersionArtifact(ctx, connect.NewRequest(&releasepb.DeleteVersionArtifactRequest{
+								ProjectName: project,
+								Version:     item.Version,
+								Artifact:    artifact,
+							}))
+							if err != nil {
+								return fmt.Errorf("deleting version artifact: %w", err)
+							}
+							deleted++
+							if s3Store == nil {
+								continue
+							}
+							key, ok := store.KeyForURL(s3Store, artifact.Url)
+							if !ok {
+								log.Printf("- not deleting object, %q isn't in the bucket", artifact.Url)
+								kept++
+								continue
+							}
+							input := &s3.DeleteObjectInput{Bucket: aws.String(bucketName), Key: aws.String(key)}
+							if dryRun {
+								if err := newS3PlanPrinter(cctx).JSON("DeleteObject", input, ""); err != nil {
+									return err
+								}
+								continue
+							}
+							if _, err := s3Store.Client.DeleteObject(ctx, input); err != nil {
+								return fmt.Errorf("deleting object %q: %w", key, err)
+							}
+							log.Printf("- deleted object %q", key)
+						}
+					}
+					if dryRun {
+						log.Printf("dry-run, would have pruned %d artifacts", deleted)
+					} else {
+						log.Printf("pruned %d artifacts", deleted)
+					}
+					if kept > 0 {
+						log.Printf("%d artifacts point outside the bucket, their objects were kept", kept)
+					}
+					return nil
+				},
+			},
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name: "gc",
+		Subcommands: cli.Commands{
+			{
+				Name:  "s3",
+				Usage: "find, and optionally delete, objects that no version artifact points to",
+				Flags: append([]cli.Flag{
+					cli.StringSliceFlag{Name: flagProjectName, Usage: "projects whose version artifacts are stored in the bucket, can be repeated"},
+					cli.StringFlag{Name: flagS3Prefix, Required: true, Usage: "only consider objects under this prefix"},
+					cli.StringFlag{Name: flagS3PublicURL, Required: true, Usage: "URL at which the bucket's objects are served, to map artifact URLs to object keys"},
+					cli.DurationFlag{Name: flagMinAge, Value: 24 * time.Hour, Usage: "never collect objects modified more recently than this"},
+					cli.BoolFlag{Name: flagDelete, Usage: "delete the unreferenced objects instead of only reporting them"},
+				}, s3Flags(true)...),
+				Action: func(cctx *cli.Context) error {
+					releaseClient := newReleaseClient(cctx)
+					s3Client, err := newS3Client(cctx)
+					if err != nil {
+						return err
+					}
+					bucketName := cctx.String(flagS3Bucket)
+					prefix := cctx.String(flagS3Prefix)
+					publicURL := cctx.String(flagS3PublicURL)
+					projects := cctx.StringSlice(flagProjectName)
+					if len(projects) == 0 {
+						return fmt.Errorf("need at least one --%s", flagProjectName)
+					}
+
+					s3Store := &store.S3Store{Client: s3Client, Bucket: bucketName, PublicURL: publicURL}
+					referenced, unmapped, err := release.ReferencedKeys(ctx, releaseClient, projects, prefix,
+						func(url string) (string, bool) { return store.KeyForURL(s3Store, url) },
+						func(url string) bool { return store.Serves(s3Store, url) },
+					)
+					if err != nil {
+						return err
+					}
+					for _, u := range unmapped {
+						log.Printf("- can't map %q to an object key", u)
+					}
+					objects, err := bucket.ListObjects(ctx, s3Client, bucketName, prefix)
+					if err != nil {
+						return err
+					}
+					log.Printf("%d objects under %q, %d referenced by version artifacts", len(objects), prefix, len(referenced))
+					if cctx.Bool(flagDelete) {
+						if len(unmapped) > 0 {
+							return fmt.Errorf("%d artifact URLs point at the bucket but can't be mapped to object keys, refusing to delete what they may reference; check --%s", len(unmapped), flagS3PublicURL)
+						}
+						if len(referenced) == 0 {
+							return fmt.Errorf("no version artifact points under %q, refusing to delete everything; check --%s", prefix, flagS3PublicURL)
+						}
+					}
+
+					orphans, young := bucket.Orphans(objects, referenced, cctx.Duration(flagMinAge), time.Now())
+					for _, obj := range young {
+						log.Printf("- skipping %q, modified %s", aws.ToString(obj.Key), aws.ToTime(obj.LastModified).Format(time.RFC3339))
+					}
+					var size int64
+					enc := json.NewEncoder(os.Stdout)
+					for _, obj := range orphans {
+						size += aws.ToInt64(obj.Size)
+						if err := enc.Encode(obj); err != nil {
+							log.Printf("can't encode object to stdout: %v", err)
+						}
+					}
+					log.Printf("%d unreferenced objects (%d bytes)", len(orphans), size)
+					if !cctx.Bool(flagDelete) {
+						return nil
+					}
+					for _, obj := range orphans {
+						input := &s3.DeleteObjectInput{Bucket: aws.String(bucketName), Key: obj.Key}
+						if dryRun {
+							if err := newS3PlanPrinter(cctx).JSON("DeleteObject", input, ""); err != nil {
+								return err
+							}
+							continue
+						}
+						if _, err := s3Client.DeleteObject(ctx, input); err != nil {
+							return fmt.Errorf("deleting object %q: %w", aws.ToString(obj.Key), err)
+						}
+						log.Printf("- deleted %q", aws.ToString(obj.Key))
+					}
+					logDone("deleted")
+					return nil
+				},
+			},
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "upload-and-register",
+		Usage: "upload an artifact to a store and register it as a version artifact",
+		Flags: append(append(append([]cli.Flag{
+			cli.StringFlag{Name: flagFilepath, Required: true},
+			cli.StringFlag{Name: flagProjectName, Required: true},
+			cli.StringFlag{Name: flagArtifactOperatingSystem, Required: true},
+			cli.StringFlag{Name: flagArtifactArchitecture, Required: true},
+			cli.StringFlag{Name: flagArtifactSignature, Usage: "defaults to the content of the .sig file next to the artifact"},
+			cli.StringFlag{Name: flagS3KeyTemplate, Value: "{{.Project}}/{{.Version}}/{{.Filename}}", Usage: "Go template of the object key, which can use {{.Project}}, {{.Version}}, {{.Filename}}, {{.OS}} and {{.Arch}}"},
+			cli.StringFlag{Name: flagURLTemplate, Usage: "Go template of the public URL of the object, e.g. https://cdn.example.com/{{.Key}}, which can use the same fields as the key; defaults to the URL of the object in the store"},
+			cli.DurationFlag{Name: flagPresign, Usage: "register a presigned URL valid for this long instead of a public URL, and upload privately unless --" + flagS3ACL + " is set; S3 stores only"},
+			cli.StringFlag{Name: flagOnFailure, Value: "ask", Usage: "what to do with the uploaded object if registration fails: ask, delete or keep"},
+			cli.StringFlag{Name: flagS3ACL, Value: string(types.ObjectCannedACLPublicRead)},
+			cli.StringFlag{Name: flagS3CacheControl, Value: `max-age=9999,public`},
+			cli.IntFlag{Name: flagS3PartSize, Value: 16, Usage: "files larger than this are uploaded in parts of this size"},
+			cli.IntFlag{Name: flagS3Parallelism, Value: 4, Usage: "how many parts are uploaded at once"},
+			contentAddressedFlag,
+		}, versionFlags...), storeFlags...), s3Flags(false)...),
+		Action: func(cctx *cli.Context) error {
+			onFailure := cctx.String(flagOnFailure)
+			switch onFailure {
+			case "ask", "delete", "keep":
+			default:
+				return fmt.Errorf("--%s must be ask, delete or keep, not %q", flagOnFailure, onFailure)
+			}
+			localPath := cctx.String(flagFilepath)
+			version, err := parseVersion(cctx)
+			if err != nil {
+				return err
+			}
+			contentAddressed := cctx.Bool(flagContentAddressed)
+			tmpl := cctx.String(flagS3KeyTemplate)
+			if contentAddressed && !cctx.IsSet(flagS3KeyTemplate) {
+				tmpl = bucket.ContentAddressedKey
+			}
+			keyTmpl, err := bucket.ParseKeyTemplate(tmpl)
+			if err != nil {
+				return err
+			}
+			presign := cctx.Duration(flagPresign)
+			var urlTmpl *bucket.URLTemplate
+			if tmpl := cctx.String(flagURLTemplate); tmpl != "" {
+				if urlTmpl, err = bucket.ParseURLTemplate(tmpl); err != nil {
+					return err
+				}
+			}
+			data := bucket.KeyData{
+				Project:  cctx.String(flagProjectName),
+				Version:  versions.String(version),
+				Filename: filepath.Base(localPath),
+				Path:     filepath.Base(localPath),
+				OS:       cctx.String(flagArtifactOperatingSystem),
+				Arch:     cctx.String(flagArtifactArchitecture),
+				Ext:      bucket.Ext(localPath),
+			}
+			sum, err := release.FileSHA256(localPath)
+			if err != nil {
+				return err
+			}
+			data.Sha256 = sum
+			key, err := keyTmpl.Key(data)
+			if err != nil {
+				return err
+			}
+			sig := cctx.String(flagArtifactSignature)
+			if sig == "" {
+				if sig, err = release.ReadSignature(localPath); err != nil {
+					return err
+				}
+			}
+
+			acl := cctx.String(flagS3ACL)
+			if presign != 0 && !cctx.IsSet(flagS3ACL) {
+				acl = string(types.ObjectCannedACLPrivate)
+			}
+			st, printer, err := openStore(cctx, acl)
+			if err != nil {
+				return err
+			}
+			var url string
+			switch {
+			case presign != 0:
+				s3Store, ok := st.(*store.S3Store)
+				if !ok {
+					return fmt.Errorf("--%s needs an S3 store", flagPresign)
+				}
+				var expires time.Time
+				if url, expires, err = s3Store.Presign(ctx, key, presign); err != nil {
+					return err
+				}
+				log.Printf("registering a presigned URL, valid until %s", expires.Format(time.RFC3339))
+			case urlTmpl != nil:
+				if url, err = urlTmpl.URL(bucket.URLData{KeyData: data, Key: key}); err != nil {
+					return err
+				}
+			default:
+				if url = st.URL(key); url == "" {
+					return fmt.Errorf("can't tell the URL of %q, need --%s, --%s or --%s", key, flagURLTemplate, flagStorePublicURL, flagPresign)
+				}
+			}
+
+			putOpts := store.PutOptions{
+				Size:         -1,
+				Sha256:       sum,
+				ContentType:  bucket.ContentType(localPath),
+				CacheControl: cctx.String(flagS3CacheControl),
+				IfAbsent:     contentAddressed,
+			}
+			if dryRun {
+				if err := printer.JSON("Put", map[string]any{"key": key, "options": putOpts}, localPath); err != nil {
+					return err
+				}
+			} else {
+				f, err := os.Open(localPath)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				if fi, err := f.Stat(); err == nil {
+					putOpts.Size = fi.Size()
+				}
+				putOpts.Progress = progress.New("uploading "+filepath.Base(localPath), putOpts.Size)
+				var existed bool
+				if contentAddressed {
+					existed, err = store.PutIfAbsent(ctx, st, key, f, putOpts)
+				} else {
+					err = st.Put(ctx, key, f, putOpts)
+				}
+				putOpts.Progress.Done()
+				if err != nil {
+					return err
+				}
+				if existed {
+					// someone else's object, keep it if registration fails
+					onFailure = "keep"
+					log.Printf("%s already uploaded to %q", localPath, key)
+				} else {
+					log.Printf("uploaded %s to %q", localPath, key)
+				}
+			}
+
+			artifact := &typesv1.VersionArtifact{
+				Url:             url,
+				Sha256:          sum,
+				Signature:       sig,
+				Architecture:    data.Arch,
+				OperatingSystem: data.OS,
+			}
+			_, err = newReleaseClient(cctx).CreateVersionArtifact(ctx, connect.NewRequest(&releasepb.CreateVersionArtifactRequest{
+				ProjectName: data.Project,
+				Version:     version,
+				Artifact:    artifact,
+			}))
+			if err != nil {
+				err = fmt.Errorf("registering version artifact: %w", err)
+				if dryRun {
+					return err
+				}
+				if onFailure == "ask" {
+					onFailure = "keep"
+					if term.IsTerminal(int(os.Stdin.Fd())) {
+						log.Print(err)
+						fmt.Fprintf(os.Stderr, "delete uploaded object %q? [y/N] ", key)
+						answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+						if strings.EqualFold(strings.TrimSpace(answer), "y") {
+							onFailure = "delete"
+						}
+					}
+				}
+				if onFailure == "keep" {
+					log.Printf("kept uploaded object %q", key)
+					return err
+				}
+				if derr := st.Delete(context.Background(), key); derr != nil {
+					return errors.Join(err, fmt.Errorf("rolling back upload of %q: %w", key, derr))
+				}
+				log.Printf("rolled back, deleted uploaded object %q", key)
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(artifact); err != nil {
+				log.Printf("operation succeeded but error printing result: %v", err)
+			}
+			logDone("uploaded and registered")
+			return nil
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name:  "store",
+		Usage: "manage the objects of an artifact store",
+		Subcommands: cli.Commands{
+			{
+				Name:  "put",
+				Usage: "upload a file",
+				Flags: append(append([]cli.Flag{
+					cli.StringFlag{Name: flagFilepath, Required: true},
+					cli.StringFlag{Name: flagStoreKey, Usage: "defaults to the name of the file"},
+					cli.StringFlag{Name: flagS3ACL, Value: string(types.ObjectCannedACLPublicRead)},
+					cli.StringFlag{Name: flagS3CacheControl, Value: `max-age=9999,public`},
+					cli.IntFlag{Name: flagS3PartSize, Value: 16, Usage: "files larger than this are uploaded in parts of this size"},
+					contentAddressedFlag,
+				}, storeFlags...), s3Flags(false)...),
+				Action: func(cctx *cli.Context) error {
+					localPath := cctx.String(flagFilepath)
+					contentAddressed := cctx.Bool(flagContentAddressed)
+					st, printer, err := openStore(cctx, cctx.String(flagS3ACL))
+					if err != nil {
+						return err
+					}
+					sum, err := release.FileSHA256(localPath)
+					if err != nil {
+						return err
+					}
+					key := cctx.String(flagStoreKey)
+					switch {
+					case key != "":
+					case contentAddressed:
+						kt, err := bucket.ParseKeyTemplate(bucket.ContentAddressedKey)
+						if err != nil {
+							return err
+						}
+						if key, err = kt.Key(bucket.KeyData{Path: localPath, Sha256: sum, Ext: bucket.Ext(localPath)}); err != nil {
+							return err
+						}
+					default:
+						key = filepath.Base(localPath)
+					}
+					putOpts := store.PutOptions{
+						Size:         -1,
+						Sha256:       sum,
+						ContentType:  bucket.ContentType(localPath),
+						CacheControl: cctx.String(flagS3CacheControl),
+						IfAbsent:     contentAddressed,
+					}
+					if dryRun {
+						if err := printer.JSON("Put", map[string]any{"key": key, "options": putOpts}, localPath); err != nil {
+							return err
+						}
+						logDone("uploaded")
+						return nil
+					}
+					f, err := os.Open(localPath)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					if fi, err := f.Stat(); err == nil {
+						putOpts.Size = fi.Size()
+					}
+					putOpts.Progress = progress.New("uploading "+filepath.Base(localPath), putOpts.Size)
+					var existed bool
+					if contentAddressed {
+						existed, err = store.PutIfAbsent(ctx, st, key, f, putOpts)
+					} else {
+						err = st.Put(ctx, key, f, putOpts)
+					}
+					putOpts.Progress.Done()
+					if err != nil {
+						return err
+					}
+					obj, err := st.Head(ctx, key)
+					if err != nil {
+						return err
+					}
+					out := struct {
+						*store.Object
+						URL     string `json:"url,omitempty"`
+						Existed bool   `json:"existed,omitempty"`
+					}{Object: obj, URL: st.URL(key), Existed: existed}
+					if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+						log.Printf("operation succeeded but error printing result: %v", err)
+					}
+					if existed {
+						log.Printf("already uploaded")
+						return nil
+					}
+					logDone("uploaded")
+					return nil
+				},
+			},
+			{
+				Name:      "head",
+				Usage:     "describe objects",
+				ArgsUsage: "<key>...",
+				Flags:     append(append([]cli.Flag{}, storeFlags...), s3Flags(false)...),
+				Action: func(cctx *cli.Context) error {
+					st, _, err := openStore(cctx, "")
+					if err != nil {
+						return err
+					}
+					enc := json.NewEncoder(os.Stdout)
+					for _, key := range cctx.Args() {
+						obj, err := st.Head(ctx, key)
+						if err != nil {
+							return fmt.Errorf("%q: %w", key, err)
+						}
+						if err := enc.Encode(obj); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "ls",
+				Usage:     "list objects",
+				ArgsUsage: "[prefix]",
+				Flags:     append(append([]cli.Flag{}, storeFlags...), s3Flags(false)...),
+				Action: func(cctx *cli.Context) error {
+					st, _, err := openStore(cctx, "")
+					if err != nil {
+						return err
+					}
+					objects, err := st.List(ctx, cctx.Args().First())
+					if err != nil {
+						return err
+					}
+					enc := json.NewEncoder(os.Stdout)
+					for _, obj := range objects {
+						if err := enc.Encode(obj); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "rm",
+				Usage:     "delete objects",
+				ArgsUsage: "<key>...",
+				Flags:     append(append([]cli.Flag{}, storeFlags...), s3Flags(false)...),
+				Action: func(cctx *cli.Context) error {
+					st, printer, err := openStore(cctx, "")
+					if err != nil {
+						return err
+					}
+					for _, key := range cctx.Args() {
+						if dryRun {
+							if err := printer.JSON("Delete", map[string]string{"key": key}, ""); err != nil {
+								return err
+							}
+							continue
+						}
+						if err := st.Delete(ctx, key); err != nil {
+							return fmt.Errorf("%q: %w", key, err)
+						}
+						log.Printf("- deleted %q", key)
+					}
+					logDone("deleted")
+					return nil
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "serve the objects of a local directory store over HTTP, read-only",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: flagDir, Required: true},
+					cli.StringFlag{Name: flagListen, Value: "127.0.0.1:8090"},
+				},
+				Action: func(cctx *cli.Context) error {
+					srv := &http.Server{
+						Addr:    cctx.String(flagListen),
+						Handler: http.FileServer(http.Dir(cctx.String(flagDir))),
+					}
+					go func() {
+						<-ctx.Done()
+						srv.Close()
+					}()
+					log.Printf("serving %q on http://%s", cctx.String(flagDir), srv.Addr)
+					if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						return err
+					}
+					return nil
+				},
+			},
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name: "s3",
+		Subcommands: cli.Commands{
+			{
+				Name:      "presign",
+				Usage:     "print presigned GET URLs of objects",
+				ArgsUsage: "<key>...",
+				Flags: append([]cli.Flag{
+					cli.DurationFlag{Name: flagExpires, Value: 24 * time.Hour, Usage: fmt.Sprintf("how long the URLs are valid for, at most %v", bucket.MaxPresignExpiry)},
+				}, s3Flags(true)...),
+				Action: func(cctx *cli.Context) error {
+					if !cctx.Args().Present() {
+						return fmt.Errorf("need at least one object key")
+					}
+					s3Client, err := newS3Client(cctx)
+					if err != nil {
+						return err
+					}
+					enc := json.NewEncoder(os.Stdout)
+					for _, key := range cctx.Args() {
+						url, expires, err := bucket.Presign(ctx, s3Client, cctx.String(flagS3Bucket), key, cctx.Duration(flagExpires))
+						if err != nil {
+							return err
+						}
+						err = enc.Encode(map[string]any{"key": key, "url": url, "expires": expires})
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "mirror",
+				Usage: "copy the objects referenced by a project's version artifacts from a store to another",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{Name: flagProjectName, Required: true},
+					cli.StringFlag{Name: flagMirrorFrom, Required: true, Usage: "store to copy from, see --" + flagStore + " of upload-and-register"},
+					cli.StringFlag{Name: flagMirrorFromPublicURL, Usage: "URL at which the source store serves its objects, to recognize them in artifact URLs"},
+					cli.StringFlag{Name: flagMirrorTo, Required: true, Usage: "store to copy to, e.g. s3://backup-bucket?profile=backup"},
+					cli.StringFlag{Name: flagMirrorToPublicURL, Usage: "URL at which the destination store serves its objects"},
+					cli.StringFlag{Name: flagRegister, Value: "none", Usage: "what to do with the URLs of the copies: none, or rewrite the existing artifacts to them; a platform has a single artifact per version, so copies can't be added alongside"},
+					cli.StringFlag{Name: flagS3ACL, Value: string(types.ObjectCannedACLPublicRead)},
+					cli.StringFlag{Name: flagS3CacheControl, Value: `max-age=9999,public`},
+					cli.IntFlag{Name: flagS3PartSize, Value: 16, Usage: "objects larger than this are copied in parts of this size"},
+				}, s3Flags(false)...),
+				Action: func(cctx *cli.Context) error {
+					register := cctx.String(flagRegister)
+					switch register {
+					case "none", "rewrite":
+					default:
+						return fmt.Errorf("--%s must be none or rewrite, not %q", flagRegister, register)
+					}
+					src, _, err := openStoreURL(cctx, cctx.String(flagMirrorFrom), cctx.String(flagMirrorFromPublicURL), "")
+					if err != nil {
+						return err
+					}
+					dst, printer, err := openStoreURL(cctx, cctx.String(flagMirrorTo), cctx.String(flagMirrorToPublicURL), cctx.String(flagS3ACL))
+					if err != nil {
+						return err
+					}
+					releaseClient := newReleaseClient(cctx)
+					project := cctx.String(flagProjectName)
+					items, err := release.ListAllVersionArtifacts(ctx, releaseClient, project)
+					if err != nil {
+						return err
+					}
+
+					type mirrorResult struct {
+						Version  string           `json:"version"`
+						Platform release.Platform `json:"platform"`
+						Key      string           `json:"key,omitempty"`
+						URL      string           `json:"url,omitempty"`
+						Status   string           `json:"status"`
+						Error    string           `json:"error,omitempty"`
+					}
+					// copy streams an object from the source to the destination,
+					// unless the destination already has it
+					mirrorObject := func(key string, a *typesv1.VersionArtifact) (string, error) {
+						if obj, err := dst.Head(ctx, key); err == nil && obj.Sha256 == a.Sha256 {
+							return "skipped", nil
+						} else if err != nil && !errors.Is(err, store.ErrNotExist) {
+							return "", err
+						}
+						opts := store.PutOptions{
+							Size:         -1,
+							Sha256:       a.Sha256,
+							ContentType:  bucket.ContentType(key),
+							CacheControl: cctx.String(flagS3CacheControl),
+						}
+						if dryRun {
+							return "copied", printer.JSON("Put", map[string]any{"key": key, "options": opts}, src.URL(key))
+						}
+						r, obj, err := src.Get(ctx, key)
+						if err != nil {
+							return "", fmt.Errorf("reading source: %w", err)
+						}
+						defer r.Close()
+						opts.Size = obj.Size
+						if obj.ContentType != "" {
+							opts.ContentType = obj.ContentType
+						}
+						opts.Progress = progress.New("mirroring "+path.Base(key), obj.Size)
+						err = dst.Put(ctx, key, r, opts)
+						opts.Progress.Done()
+						if err != nil {
+							return "", err
+						}
+						return "copied", nil
+					}
+
+					var (
+						enc    = json.NewEncoder(os.Stdout)
+						failed int
+					)
+					for _, item := range items {
+						for _, a := range item.Artifacts {
+							res := mirrorResult{Version: versions.String(item.Version), Platform: release.PlatformOf(a)}
+							err := func() error {
+								key, ok := store.KeyForURL(src, a.Url)
+								if !ok {
+									return fmt.Errorf("%q isn't an URL of the source store", a.Url)
+								}
+								res.Key = key
+								status, err := mirrorObject(key, a)
+								if err != nil {
+									return err
+								}
+								res.Status = status
+								if register == "none" {
+									return nil
+								}
+								if res.URL = dst.URL(key); res.URL == "" {
+									return fmt.Errorf("can't tell the URL of the copy, need --%s", flagMirrorToPublicURL)
+								}
+								if res.URL == a.Url {
+									return nil
+								}
+								mirrored := proto.Clone(a).(*typesv1.VersionArtifact)
+								mirrored.Url = res.URL
+								return release.ReplaceVersionArtifact(ctx, releaseClient, project, item.Version, a, mirrored)
+							}()
+							if err != nil {
+								if ctx.Err() != nil {
+									return ctx.Err()
+								}
+								failed++
+								res.Status, res.Error = "failed", err.Error()
+								log.Printf("- %s %s: %v", res.Version, res.Platform, err)
+							} else {
+								log.Printf("- %s %s: %s %q", res.Version, res.Platform, res.Status, res.Key)
+							}
+							if err := enc.Encode(res); err != nil {
+								return err
+							}
+						}
+					}
+					if failed > 0 {
+						return fmt.Errorf("%d artifacts failed to mirror", failed)
+					}
+					logDone("mirrored")
+					return nil
+				},
+			},
+			{
+				Name:  "refresh-urls",
+				Usage: "re-sign the presigned URLs of a project's version artifacts that expire soon, and register them again",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{Name: flagProjectName, Required: true},
+					cli.DurationFlag{Name: flagWithin, Value: 48 * time.Hour, Usage: "refresh URLs expiring within this long"},
+					cli.DurationFlag{Name: flagExpires, Value: bucket.MaxPresignExpiry, Usage: fmt.Sprintf("how long the new URLs are valid for, at most %v", bucket.MaxPresignExpiry)},
+				}, s3Flags(true)...),
+				Action: func(cctx *cli.Context) error {
+					releaseClient := newReleaseClient(cctx)
+					s3Client, err := newS3Client(cctx)
+					if err != nil {
+						return err
+					}
+					var (
+						project    = cctx.String(flagProjectName)
+						bucketName = cctx.String(flagS3Bucket)
+						deadline   = time.Now().Add(cctx.Duration(flagWithin))
+						refreshed  int
+					)
+					items, err := release.ListAllVersionArtifacts(ctx, releaseClient, project)
+					if err != nil {
+						return err
+					}
+					for _, item := range items {
+						vs := versions.String(item.Version)
+						for _, a := range item.Artifacts {
+							presigned, ok := bucket.ParsePresignedURL(a.Url, bucketName)
+							if !ok || presigned.Expires.After(deadline) {
+								continue
+							}
+							url, expires, err := bucket.Presign(ctx, s3Client, bucketName, presigned.Key, cctx.Duration(flagExpires))
+							if err != nil {
+								return err
+							}
+							refreshedArtifact := proto.Clone(a).(*typesv1.VersionArtifact)
+							refreshedArtifact.Url = url
+							if err := release.ReplaceVersionArtifact(ctx, releaseClient, project, item.Version, a, refreshedArtifact); err != nil {
+								return err
+							}
+							refreshed++
+							log.Printf("- refreshed %s %s (%q), was valid until %s, now until %s", vs, release.PlatformOf(a), presigned.Key,
+								presigned.Expires.Format(time.RFC3339), expires.Format(time.RFC3339))
+						}
+					}
+					log.Printf("%d URLs expiring before %s", refreshed, deadline.Format(time.RFC3339))
+					logDone("refreshed")
+					return nil
+				},
+			},
+		},
+	})
+
+	app.Commands = append(app.Commands, cli.Command{
+		Name: "version",
+		Subcommands: cli.Commands{
+			{
+				Name: "check",
+				Flags: []cli.Flag{
+					cli.IntFlag{Name: flagMachineId, Value: -1},
+				},
+				Action: func(cctx *cli.Context) error {
+					apiURL := cctx.GlobalString(flagAPIURL)
+					updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
+					machineId := cctx.Int64(flagMachineId)
+					res, err := updateClient.GetNextUpdate(ctx, connect.NewRequest(&cliupdatepb.GetNextUpdateRequest{
+						ProjectName:            "apictl",
+						CurrentVersion:         version,
+						MachineArchitecture:    runtime.GOARCH,
+						MachineOperatingSystem: runtime.GOOS,
+						Meta: &typesv1.ReqMeta{
+							MachineId: machineId,
+						},
+					}))
+					if err != nil {
+						return err
+					}
+					msg := res.Msg
+					meta := msg.Meta
+					if machineId != meta.MachineId {
+						log.Printf("a machine id was assigned: %d", meta.MachineId)
+					}
+
+					currentSV, err := version.AsSemver()
+					if err != nil {
+						return err
+					}
+					nextSV, err := msg.NextVersion.AsSemver()
+					if err != nil {
+						return err
+					}
+					if currentSV.GTE(nextSV) {
+						log.Printf("you're already running the latest version: v%v", semverVersion.String())
+						return nil
+					}
+					log.Printf("you are running v%s", currentSV)
+					log.Printf("a newer version v%s is available here:", nextSV)
+					log.Printf("- url: %s", msg.NextArtifact.Url)
+					log.Printf("- sha256: %s", msg.NextArtifact.Sha256)
+					log.Printf("- sig: %s", msg.NextArtifact.Signature)
+					log.Printf("run `apictl version update` to update")
+					return nil
+				},
+			},
+			{
+				Name: "update",
+				Flags: []cli.Flag{
+					cli.IntFlag{Name: flagMachineId, Value: -1},
+				},
+				Action: func(cctx *cli.Context) error {
+					apiURL := cctx.GlobalString(flagAPIURL)
+					updateClient := cliupdatev1connect.NewUpdateServiceClient(client, apiURL)
+					machineId := cctx.Int64(flagMachineId)
+					res, err := updateClient.GetNextUpdate(ctx, connect.NewRequest(&cliupdatepb.GetNextUpdateRequest{
+						ProjectName:            "apictl",
+						CurrentVersion:         version,
+						MachineArchitecture:    runtime.GOARCH,
+						MachineOperatingSystem: runtime.GOOS,
+						Meta: &typesv1.ReqMeta{
+							MachineId: machineId,
+						},
+					}))
+					if err != nil {
+						return err
+					}
+					msg := res.Msg
+					meta := msg.Meta
+					if machineId != meta.MachineId {
+						log.Printf("a machine id was assigned: %d", meta.MachineId)
+					}
+
+					currentSV, err := version.AsSemver()
+					if err != nil {
+						return err
+					}
+					nextSV, err := msg.NextVersion.AsSemver()
+					if err != nil {
+						return err
+					}
+					if currentSV.GTE(nextSV) {
+						log.Printf("you're already running the latest version: v%v", semverVersion.String())
+						return nil
+					}
+					p := progress.New(fmt.Sprintf("downloading install script for v%s", nextSV), -1)
+					defer p.Done()
+					return selfupdate.UpgradeInPlace(ctx, "apictl", os.Stdout, os.Stderr, os.Stdin, p)
+				},
+			},
+			{
+				Name:  "to-json",
+				Flags: versionFlags,
+				Action: func(cctx *cli.Context) error {
+					version, err := parseVersion(cctx)
+					if err != nil {
+						return fmt.Errorf("parsing version flag: %w", err)
+					}
+					if err := json.NewEncoder(os.Stdout).Encode(version); err != nil {
+						return fmt.Errorf("encoding to stdout: %w", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name: "from-json",
+				Action: func(cctx *cli.Context) error {
+					input := new(typesv1.Version)
+					if err := json.NewDecoder(os.Stdin).Decode(input); err != nil {
+						return fmt.Errorf("decoding version from stdin: %w", err)
+					}
+					sv, err := input.AsSemver()
 					if err != nil {
 						return fmt.Errorf("converting to semver: %v", err)
 					}
@@ -815,6 +2479,268 @@ func newApp() *cli.App {
 					return err
 				},
 			},
+			{
+				Name:      "bump",
+				Usage:     "bump a version following semver, e.g. `bump minor prerelease --preid rc` turns 1.2.3 into 1.3.0-rc.1",
+				ArgsUsage: "<major|minor|patch|prerelease>...",
+				Description: "Bumps are applied in order, to the version given by flags or as JSON on stdin.\n" +
+					"`major`, `minor` and `patch` reset the lower fields and drop prereleases, or only drop the prereleases\n" +
+					"of a prerelease of what they'd produce: 2.0.0-rc.1 bumps to 2.0.0 with `major`.\n" +
+					"`prerelease` increments the last numeric prerelease identifier, e.g. rc.1 to rc.2. A release\n" +
+					"gets its patch bumped and `<preid>.1` appended, unless a previous bump already moved it. If that\n" +
+					"bump only dropped prereleases, they are incremented: `minor prerelease` turns 1.3.0-rc.2 into 1.3.0-rc.3.\n" +
+					"Build metadata is dropped.",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{Name: flagPreid, Usage: "identifier of new prereleases, e.g. rc; a different one restarts the prereleases, e.g. beta.3 to rc.1"},
+				}, versionFlags...),
+				Action: func(cctx *cli.Context) error {
+					if cctx.NArg() == 0 {
+						log.Printf("no bump specified")
+						return cli.ShowSubcommandHelp(cctx)
+					}
+					bumps := make([]versions.Bump, 0, cctx.NArg())
+					for _, arg := range cctx.Args() {
+						bump, err := versions.ParseBump(arg)
+						if err != nil {
+							return err
+						}
+						bumps = append(bumps, bump)
+					}
+					version, err := readVersion(cctx)
+					if err != nil {
+						return err
+					}
+					bumper := &versions.Bumper{Preid: cctx.String(flagPreid)}
+					for _, bump := range bumps {
+						if version, err = bumper.Bump(version, bump); err != nil {
+							return err
+						}
+					}
+					if err := json.NewEncoder(os.Stdout).Encode(version); err != nil {
+						return fmt.Errorf("encoding result to stdout: %v", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "compare",
+				Usage:     fmt.Sprintf("compare two versions, printing lt, eq or gt and exiting with %d, 0 or %d", exitVersionLess, exitVersionGreater),
+				ArgsUsage: "[<a>] <b>",
+				Description: "Each argument is a semver or the JSON of `version to-json`. If only `<b>` is given,\n" +
+					"`<a>` is the version given by flags or as JSON on stdin. Build metadata is ignored.",
+				Flags: versionFlags,
+				Action: func(cctx *cli.Context) error {
+					var (
+						a, b *typesv1.Version
+						err  error
+					)
+					switch cctx.NArg() {
+					case 1:
+						if a, err = readVersion(cctx); err != nil {
+							return err
+						}
+					case 2:
+						if a, err = versions.ParseAny(cctx.Args().First()); err != nil {
+							return err
+						}
+					default:
+						log.Printf("need one or two versions")
+						return cli.ShowSubcommandHelp(cctx)
+					}
+					if b, err = versions.ParseAny(cctx.Args().Get(cctx.NArg() - 1)); err != nil {
+						return err
+					}
+					order, err := versions.Compare(a, b)
+					if err != nil {
+						return err
+					}
+					switch {
+					case order < 0:
+						fmt.Println("lt")
+						return cli.NewExitError("", exitVersionLess)
+					case order > 0:
+						fmt.Println("gt")
+						return cli.NewExitError("", exitVersionGreater)
+					}
+					fmt.Println("eq")
+					return nil
+				},
+			},
+			{
+				Name:      "sort",
+				Usage:     "sort versions by semver precedence",
+				ArgsUsage: "[<version>...]",
+				Description: "Sorts the versions given as arguments, or else one per line on stdin, each a semver\n" +
+					"or the JSON of `version to-json`. A version given by flags is sorted along. Versions\n" +
+					"are printed as they were given, equal ones in their original order.",
+				Flags: append([]cli.Flag{
+					cli.BoolFlag{Name: flagReverse, Usage: "print the highest version first"},
+					cli.BoolFlag{Name: flagJSON, Usage: "print versions as JSON, one per line"},
+				}, versionFlags...),
+				Action: func(cctx *cli.Context) error {
+					inputs := []string(cctx.Args())
+					if len(inputs) == 0 {
+						sc := bufio.NewScanner(os.Stdin)
+						sc.Buffer(nil, 1<<20)
+						for sc.Scan() {
+							if line := strings.TrimSpace(sc.Text()); line != "" {
+								inputs = append(inputs, line)
+							}
+						}
+						if err := sc.Err(); err != nil {
+							return fmt.Errorf("reading versions from stdin: %w", err)
+						}
+					}
+					type entry struct {
+						text    string
+						version *typesv1.Version
+						sv      semver.Version
+					}
+					entries := make([]entry, 0, len(inputs)+1)
+					add := func(text string, v *typesv1.Version) error {
+						sv, err := v.AsSemver()
+						if err != nil {
+							return fmt.Errorf("invalid version %s: %w", text, err)
+						}
+						entries = append(entries, entry{text: text, version: v, sv: sv})
+						return nil
+					}
+					if versionFlagsSet(cctx) {
+						v, err := parseVersion(cctx)
+						if err != nil {
+							return fmt.Errorf("parsing version flag: %w", err)
+						}
+						if err := add(versions.String(v), v); err != nil {
+							return err
+						}
+					}
+					for _, in := range inputs {
+						v, err := versions.ParseAny(in)
+						if err != nil {
+							return err
+						}
+						if err := add(in, v); err != nil {
+							return err
+						}
+					}
+					reverse := cctx.Bool(flagReverse)
+					slices.SortStableFunc(entries, func(a, b entry) int {
+						if reverse {
+							return b.sv.Compare(a.sv)
+						}
+						return a.sv.Compare(b.sv)
+					})
+					enc := json.NewEncoder(os.Stdout)
+					for _, e := range entries {
+						if cctx.Bool(flagJSON) {
+							if err := enc.Encode(e.version); err != nil {
+								return fmt.Errorf("encoding to stdout: %w", err)
+							}
+						} else {
+							fmt.Println(e.text)
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "satisfies",
+				Usage:     fmt.Sprintf("check that a version is in a semver range, exiting with %d if it isn't", exitNotSatisfied),
+				ArgsUsage: "<range>",
+				Description: "The version is given by flags or as JSON on stdin. Ranges are conditions like\n" +
+					"`>=0.7.0 <0.8.0`, where spaces mean and, and `||` means or. Build metadata is ignored.",
+				Flags: versionFlags,
+				Action: func(cctx *cli.Context) error {
+					if cctx.NArg() != 1 {
+						log.Printf("need exactly one range")
+						return cli.ShowSubcommandHelp(cctx)
+					}
+					v, err := readVersion(cctx)
+					if err != nil {
+						return err
+					}
+					ok, err := versions.Satisfies(v, cctx.Args().First())
+					if err != nil {
+						return err
+					}
+					if !ok {
+						return cli.NewExitError(fmt.Sprintf("%s doesn't satisfy %q", versions.String(v), cctx.Args().First()), exitNotSatisfied)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "from-git",
+				Usage: "derive the version of HEAD from the nearest version tag, e.g. 0.7.1-devel.3+abc1234 three commits after v0.7.0",
+				Description: "On a tag, the version is the tag's. Past a release tag, it's the tag bumped by --bump with the\n" +
+					"prereleases of --pre-scheme; past a prerelease tag, these are appended to the tag's, e.g.\n" +
+					"0.8.0-rc.1.devel.3. Schemes are Go templates that can refer to .Tag, .Count (commits since the tag),\n" +
+					".ShortCommit, .CommitTimestamp, .CommitDate and .Date (YYYYMMDD, UTC), e.g. `nightly.{{.Date}}`.\n" +
+					"The version is printed as JSON, and written as `version.json` in --dist-extra if set, like\n" +
+					"script/write_version_info.sh does.",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: flagDir, Value: ".", Usage: "path to the git repository"},
+					cli.StringFlag{Name: flagMatch, Value: "v[0-9]*", Usage: "glob of the version tags"},
+					cli.StringFlag{Name: flagBump, Value: string(versions.BumpPatch), Usage: "bump of release tags: major, minor or patch"},
+					cli.StringFlag{Name: flagPreScheme, Value: "devel.{{.Count}}", Usage: "template of the prereleases past a tag, can be empty"},
+					cli.StringFlag{Name: flagBuildScheme, Value: "{{.ShortCommit}}", Usage: "template of the build metadata, can be empty"},
+					cli.StringFlag{Name: flagDistExtraDir, Usage: "directory to write `version.json` in"},
+					cli.StringFlag{Name: flagArchiveBaseURL, Usage: "`archive_base_url` of `version.json`, a template that can also refer to .Version"},
+				},
+				Action: func(cctx *cli.Context) error {
+					bump, err := versions.ParseBump(cctx.String(flagBump))
+					if err != nil {
+						return err
+					}
+					if bump == versions.BumpPrerelease {
+						return fmt.Errorf("--%s can't be %q, prereleases come from --%s", flagBump, bump, flagPreScheme)
+					}
+					info, err := versions.ReadGit(ctx, cctx.String(flagDir), cctx.String(flagMatch))
+					if err != nil {
+						return fmt.Errorf("reading git repository: %w", err)
+					}
+					scheme := &versions.GitScheme{
+						Bump:  bump,
+						Pre:   cctx.String(flagPreScheme),
+						Build: cctx.String(flagBuildScheme),
+					}
+					version, err := scheme.Version(info)
+					if err != nil {
+						return err
+					}
+					if info.Tag == "" {
+						log.Printf("no tag matches %q, counting %d commits from the root", cctx.String(flagMatch), info.Count)
+					} else {
+						log.Printf("%d commits since %s", info.Count, info.Tag)
+					}
+					if dir := cctx.String(flagDistExtraDir); dir != "" {
+						tmpl, err := template.New("archive base url").Option("missingkey=error").Parse(cctx.String(flagArchiveBaseURL))
+						if err != nil {
+							return fmt.Errorf("parsing --%s: %w", flagArchiveBaseURL, err)
+						}
+						buf := new(strings.Builder)
+						err = tmpl.Execute(buf, struct {
+							*versions.GitInfo
+							Version string
+						}{info, versions.String(version)})
+						if err != nil {
+							return fmt.Errorf("rendering --%s: %w", flagArchiveBaseURL, err)
+						}
+						if dryRun {
+							log.Printf("dry-run, would have written %q", filepath.Join(dir, "version.json"))
+						} else {
+							if err := release.WriteVersionInfo(dir, release.NewVersionInfo(version, buf.String())); err != nil {
+								return fmt.Errorf("writing version info: %w", err)
+							}
+							log.Printf("wrote %q", filepath.Join(dir, "version.json"))
+						}
+					}
+					if err := json.NewEncoder(os.Stdout).Encode(version); err != nil {
+						return fmt.Errorf("encoding to stdout: %w", err)
+					}
+					return nil
+				},
+			},
 			{
 				Name:  "math",
 				Usage: "<lhs> <operator> [<rhs>]",
@@ -0,0 +1,46 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ListObjects lists every object under `prefix`, following continuation
+// tokens.
+func ListObjects(ctx context.Context, client *s3.Client, bucket, prefix string) ([]types.Object, error) {
+	var out []types.Object
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing objects under %q: %w", prefix, err)
+		}
+		out = append(out, page.Contents...)
+	}
+	return out, nil
+}
+
+// Orphans returns the objects that aren't referenced and were last modified
+// at least `minAge` ago. Younger unreferenced objects are returned apart, as
+// they may belong to uploads still in flight.
+func Orphans(objects []types.Object, referenced map[string]bool, minAge time.Duration, now time.Time) (orphans, young []types.Object) {
+	for _, obj := range objects {
+		if referenced[aws.ToString(obj.Key)] {
+			continue
+		}
+		if obj.LastModified != nil && now.Sub(*obj.LastModified) < minAge {
+			young = append(young, obj)
+			continue
+		}
+		orphans = append(orphans, obj)
+	}
+	return orphans, young
+}
@@ -0,0 +1,89 @@
+package bucket
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestOrphans(t *testing.T) {
+	now := time.Date(2025, 10, 17, 12, 0, 0, 0, time.UTC)
+	object := func(key string, age time.Duration) types.Object {
+		return types.Object{Key: aws.String(key), LastModified: aws.Time(now.Add(-age))}
+	}
+	keys := func(objects []types.Object) []string {
+		var out []string
+		for _, obj := range objects {
+			out = append(out, aws.ToString(obj.Key))
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		objects     []types.Object
+		referenced  map[string]bool
+		minAge      time.Duration
+		wantOrphans []string
+		wantYoung   []string
+	}{
+		{
+			name:        "referenced objects are kept",
+			objects:     []types.Object{object("a", 48*time.Hour), object("b", 48*time.Hour)},
+			referenced:  map[string]bool{"a": true},
+			minAge:      24 * time.Hour,
+			wantOrphans: []string{"b"},
+		},
+		{
+			name:        "younger than the minimum age",
+			objects:     []types.Object{object("old", 25*time.Hour), object("new", time.Hour), object("ref", time.Hour)},
+			referenced:  map[string]bool{"ref": true},
+			minAge:      24 * time.Hour,
+			wantOrphans: []string{"old"},
+			wantYoung:   []string{"new"},
+		},
+		{
+			name:        "exactly the minimum age",
+			objects:     []types.Object{object("a", 24*time.Hour), object("b", 24*time.Hour-time.Second)},
+			minAge:      24 * time.Hour,
+			wantOrphans: []string{"a"},
+			wantYoung:   []string{"b"},
+		},
+		{
+			name:      "modified in the future",
+			objects:   []types.Object{object("a", -time.Hour)},
+			minAge:    24 * time.Hour,
+			wantYoung: []string{"a"},
+		},
+		{
+			name:        "no minimum age",
+			objects:     []types.Object{object("a", 0), object("b", time.Hour)},
+			wantOrphans: []string{"a", "b"},
+		},
+		{
+			name:        "unknown modification time",
+			objects:     []types.Object{{Key: aws.String("a")}},
+			minAge:      24 * time.Hour,
+			wantOrphans: []string{"a"},
+		},
+		{
+			name:       "everything referenced",
+			objects:    []types.Object{object("a", 48*time.Hour)},
+			referenced: map[string]bool{"a": true, "gone": true},
+			minAge:     24 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orphans, young := Orphans(tt.objects, tt.referenced, tt.minAge, now)
+			if got := keys(orphans); !slices.Equal(got, tt.wantOrphans) {
+				t.Errorf("orphans %q, want %q", got, tt.wantOrphans)
+			}
+			if got := keys(young); !slices.Equal(got, tt.wantYoung) {
+				t.Errorf("young %q, want %q", got, tt.wantYoung)
+			}
+		})
+	}
+}
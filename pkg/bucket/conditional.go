@@ -0,0 +1,110 @@
+package bucket
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Sha256MetadataKey is the user metadata holding the hex encoded sha256 of
+// an object, since S3 only knows the checksums of the parts of multipart
+// objects.
+const Sha256MetadataKey = "sha256"
+
+// ContentAddressedKey is the default key template of content addressed
+// uploads.
+const ContentAddressedKey = "sha256/{{.Sha256}}{{.Ext}}"
+
+// Ext is the extension of a file name, keeping both of `.tar.gz`.
+func Ext(name string) string {
+	if strings.HasSuffix(strings.ToLower(name), ".tar.gz") {
+		return name[len(name)-len(".tar.gz"):]
+	}
+	return filepath.Ext(name)
+}
+
+// ObjectConflictError is returned when an object is already at a key, with
+// different content.
+type ObjectConflictError struct {
+	Key        string
+	HaveSha256 string
+	WantSha256 string
+	HaveSize   int64
+	WantSize   int64
+}
+
+func (e *ObjectConflictError) Error() string {
+	if e.HaveSha256 != "" {
+		return fmt.Sprintf("object %q already exists with sha256 %s instead of %s", e.Key, e.HaveSha256, e.WantSha256)
+	}
+	return fmt.Sprintf("object %q already exists with %d bytes instead of %d", e.Key, e.HaveSize, e.WantSize)
+}
+
+// IsNotFound tells if an S3 error says the object doesn't exist.
+func IsNotFound(err error) bool {
+	return hasErrorCode(err, "NotFound", "NoSuchKey")
+}
+
+// IsPreconditionFailed tells if a conditional write was refused.
+func IsPreconditionFailed(err error) bool {
+	return hasErrorCode(err, "PreconditionFailed", "ConditionalRequestConflict")
+}
+
+func hasErrorCode(err error, codes ...string) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.ErrorCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ObjectSha256 is the hex encoded sha256 of an object, from its checksum or
+// its metadata, or "" if neither tells.
+func ObjectSha256(head *s3.HeadObjectOutput) string {
+	if sum, err := base64.StdEncoding.DecodeString(aws.ToString(head.ChecksumSHA256)); err == nil && len(sum) > 0 {
+		return hex.EncodeToString(sum)
+	}
+	return head.Metadata[Sha256MetadataKey]
+}
+
+// SameObject tells if an object with the given size and hex encoded sha256 is
+// at `key`. It returns an *ObjectConflictError if another one is.
+func SameObject(ctx context.Context, client *s3.Client, bucket, key string, size int64, sha256hex string) (bool, error) {
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("checking existing object %q: %w", key, err)
+	}
+	conflict := &ObjectConflictError{Key: key, WantSha256: sha256hex, WantSize: size, HaveSize: aws.ToInt64(head.ContentLength)}
+	if conflict.HaveSha256 = ObjectSha256(head); conflict.HaveSha256 == "" {
+		if conflict.HaveSize != size {
+			return false, conflict
+		}
+		log.Printf("server didn't report a sha256 for existing object %q, assuming it's the same since it has the same size", key)
+		return true, nil
+	}
+	if conflict.HaveSha256 != sha256hex {
+		return false, conflict
+	}
+	return true, nil
+}
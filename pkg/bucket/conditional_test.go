@@ -0,0 +1,273 @@
+package bucket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExt(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "apictl_linux_amd64.tar.gz", want: ".tar.gz"},
+		{name: "APICTL.TAR.GZ", want: ".TAR.GZ"},
+		{name: "apictl_windows_amd64.zip", want: ".zip"},
+		{name: "checksums.txt", want: ".txt"},
+		{name: "apictl.tgz", want: ".tgz"},
+		{name: "dir/apictl.gz", want: ".gz"},
+		{name: "apictl", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Ext(tt.name); got != tt.want {
+			t.Errorf("Ext(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentAddressedKey(t *testing.T) {
+	kt, err := ParseKeyTemplate(ContentAddressedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256Hex([]byte("archive"))
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "apictl_linux_amd64.tar.gz", want: "sha256/" + sum + ".tar.gz"},
+		{name: "apictl_windows_amd64.zip", want: "sha256/" + sum + ".zip"},
+		{name: "apictl", want: "sha256/" + sum},
+	}
+	for _, tt := range tests {
+		got, err := kt.Key(KeyData{Filename: tt.name, Path: tt.name, Sha256: sum, Ext: Ext(tt.name)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("key of %q is %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestObjectSha256(t *testing.T) {
+	sum := sha256.Sum256([]byte("archive"))
+	tests := []struct {
+		name string
+		head *s3.HeadObjectOutput
+		want string
+	}{
+		{
+			name: "checksum",
+			head: &s3.HeadObjectOutput{ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sum[:]))},
+			want: hex.EncodeToString(sum[:]),
+		},
+		{
+			name: "checksum over metadata",
+			head: &s3.HeadObjectOutput{
+				ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+				Metadata:       map[string]string{Sha256MetadataKey: "other"},
+			},
+			want: hex.EncodeToString(sum[:]),
+		},
+		{
+			name: "composite checksum falls back to metadata",
+			head: &s3.HeadObjectOutput{
+				ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sum[:]) + "-3"),
+				Metadata:       map[string]string{Sha256MetadataKey: hex.EncodeToString(sum[:])},
+			},
+			want: hex.EncodeToString(sum[:]),
+		},
+		{
+			name: "metadata",
+			head: &s3.HeadObjectOutput{Metadata: map[string]string{Sha256MetadataKey: hex.EncodeToString(sum[:])}},
+			want: hex.EncodeToString(sum[:]),
+		},
+		{
+			name: "neither",
+			head: &s3.HeadObjectOutput{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ObjectSha256(tt.head); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameObject(t *testing.T) {
+	content := []byte("archive")
+	tests := []struct {
+		name        string
+		object      []byte
+		metadata    map[string]string
+		noChecksums bool
+		size        int64
+		want        bool
+		wantErr     string
+	}{
+		{
+			name: "absent",
+			size: int64(len(content)),
+		},
+		{
+			name:   "same checksum",
+			object: content,
+			size:   int64(len(content)),
+			want:   true,
+		},
+		{
+			name:    "other checksum",
+			object:  []byte("another"),
+			size:    int64(len(content)),
+			wantErr: `object "key" already exists with sha256 ` + sha256Hex([]byte("another")) + " instead of " + sha256Hex(content),
+		},
+		{
+			name:        "same metadata",
+			object:      content,
+			metadata:    map[string]string{Sha256MetadataKey: sha256Hex(content)},
+			noChecksums: true,
+			size:        int64(len(content)),
+			want:        true,
+		},
+		{
+			name:        "other metadata",
+			object:      content,
+			metadata:    map[string]string{Sha256MetadataKey: sha256Hex([]byte("another"))},
+			noChecksums: true,
+			size:        int64(len(content)),
+			wantErr:     `object "key" already exists with sha256 ` + sha256Hex([]byte("another")) + " instead of " + sha256Hex(content),
+		},
+		{
+			name:        "no sha256, same size",
+			object:      []byte("another"),
+			noChecksums: true,
+			size:        int64(len(content)),
+			want:        true,
+		},
+		{
+			name:        "no sha256, other size",
+			object:      []byte("other archive"),
+			noChecksums: true,
+			size:        int64(len(content)),
+			wantErr:     `object "key" already exists with 13 bytes instead of 7`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeS3(t)
+			f.noChecksums = tt.noChecksums
+			if tt.object != nil {
+				f.putObject("key", tt.object, tt.metadata)
+			}
+			got, err := SameObject(context.Background(), client, testBucket, "key", tt.size, sha256Hex(content))
+			if tt.wantErr != "" {
+				conflict := new(ObjectConflictError)
+				if !errors.As(err, &conflict) || err.Error() != tt.wantErr {
+					t.Fatalf("error %v, want conflict %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	content := []byte("archive")
+	tests := []struct {
+		name string
+		// existing is the object already at the key, if any
+		existing []byte
+		// raced is put by a concurrent upload right before ours, if set
+		raced []byte
+		// refusals is how many puts are refused while no object is there
+		refusals    int
+		wantExisted bool
+		wantPuts    int
+		wantErr     string
+	}{
+		{name: "absent", wantPuts: 1},
+		{name: "same content", existing: content, wantExisted: true},
+		{
+			name:     "other content",
+			existing: []byte("another"),
+			wantErr:  `object "sha256/x.tar.gz" already exists with sha256 ` + sha256Hex([]byte("another")) + " instead of " + sha256Hex(content),
+		},
+		{name: "raced with same content", raced: content, wantExisted: true, wantPuts: 1},
+		{
+			name:     "raced with other content",
+			raced:    []byte("another"),
+			wantPuts: 1,
+			wantErr:  `object "sha256/x.tar.gz" already exists with sha256 ` + sha256Hex([]byte("another")) + " instead of " + sha256Hex(content),
+		},
+		{name: "refused once", refusals: 1, wantPuts: 2},
+		{name: "refused twice", refusals: 2, wantPuts: 2, wantErr: `conditional write of "sha256/x.tar.gz" refused, but no object was found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeS3(t)
+			if tt.existing != nil {
+				f.putObject("sha256/x.tar.gz", tt.existing, nil)
+			}
+			refusals := tt.refusals
+			f.beforePut = func(key string) bool {
+				if tt.raced != nil {
+					f.putObject(key, tt.raced, nil)
+				}
+				if refusals > 0 {
+					refusals--
+					return false
+				}
+				return true
+			}
+			path := filepath.Join(t.TempDir(), "apictl.tar.gz")
+			if err := os.WriteFile(path, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			p := &Putter{Client: client, Bucket: testBucket, PartSize: MinPartSize, StatePath: StatePathFor}
+
+			res, err := p.PutIfAbsent(context.Background(), path, "sha256/x.tar.gz")
+			if got := len(f.callsTo("PutObject")); got != tt.wantPuts {
+				t.Errorf("put %d times, want %d", got, tt.wantPuts)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Existed != tt.wantExisted || res.Sha256 != sha256Hex(content) || res.Size != int64(len(content)) {
+				t.Errorf("got %+v", res)
+			}
+			if got, _ := f.object("sha256/x.tar.gz"); string(got) != string(content) {
+				t.Errorf("object is %q, want %q", got, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package bucket
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const testBucket = "bins"
+
+// fakeS3 is just enough of S3 to exercise multipart uploads and conditional
+// writes, with a path style bucket.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+	// checksums are the base64 encoded sha256 of the objects, reported
+	// unless noChecksums is set.
+	checksums   map[string]string
+	noChecksums bool
+	uploads     map[string]*fakeUpload
+	nextID      int
+	// calls lists the operations received, e.g. `UploadPart 2`.
+	calls []string
+	// listPageSize is how many parts ListParts returns at once.
+	listPageSize int
+	// beforePart runs before a part is stored, and fails it with a 500 if
+	// it returns false.
+	beforePart func(n int32) bool
+	// beforePut runs before an object is put, and refuses it as if it
+	// already existed if it returns false.
+	beforePut func(key string) bool
+}
+
+type fakeUpload struct {
+	key      string
+	metadata map[string]string
+	parts    map[int32][]byte
+}
+
+func metadataOf(h http.Header) map[string]string {
+	out := make(map[string]string)
+	for k := range h {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok {
+			out[name] = h.Get(k)
+		}
+	}
+	return out
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *s3.Client) {
+	f := &fakeS3{
+		objects:      make(map[string][]byte),
+		metadata:     make(map[string]map[string]string),
+		checksums:    make(map[string]string),
+		uploads:      make(map[string]*fakeUpload),
+		listPageSize: 1000,
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		Retryer:      aws.NopRetryer{},
+		HTTPClient:   srv.Client(),
+	})
+	return f, client
+}
+
+func (f *fakeS3) called(op string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, op)
+}
+
+func (f *fakeS3) callsTo(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, c := range f.calls {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// startUpload creates a multipart upload with the given parts already stored.
+func (f *fakeS3) startUpload(key string, parts map[int32][]byte) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("upload-%d", f.nextID)
+	f.uploads[id] = &fakeUpload{key: key, parts: parts}
+	return id
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func checksumSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	q := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.called("CreateMultipartUpload")
+		id := f.startUpload(key, make(map[int32][]byte))
+		f.mu.Lock()
+		f.uploads[id].metadata = metadataOf(r.Header)
+		f.mu.Unlock()
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: testBucket, Key: key, UploadId: id})
+
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.called(fmt.Sprintf("UploadPart %d", n))
+		if f.beforePart != nil && !f.beforePart(int32(n)) {
+			writeError(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+		if sum := r.Header.Get("X-Amz-Checksum-Sha256"); sum != checksumSHA256(body) {
+			writeError(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+		f.mu.Lock()
+		up, ok := f.uploads[q.Get("uploadId")]
+		if ok {
+			up.parts[int32(n)] = body
+		}
+		f.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		w.Header().Set("ETag", etag(body))
+		w.Header().Set("X-Amz-Checksum-Sha256", checksumSHA256(body))
+
+	case r.Method == http.MethodGet && q.Has("uploadId"):
+		f.called("ListParts")
+		marker, _ := strconv.Atoi(q.Get("part-number-marker"))
+		type part struct {
+			PartNumber     int32
+			ETag           string
+			Size           int
+			ChecksumSHA256 string
+		}
+		res := struct {
+			XMLName              xml.Name `xml:"ListPartsResult"`
+			Bucket               string
+			Key                  string
+			UploadId             string
+			IsTruncated          bool
+			NextPartNumberMarker int32
+			Parts                []part `xml:"Part"`
+		}{Bucket: testBucket, Key: key, UploadId: q.Get("uploadId")}
+		f.mu.Lock()
+		up, ok := f.uploads[q.Get("uploadId")]
+		if ok {
+			var numbers []int32
+			for n := range up.parts {
+				if n > int32(marker) {
+					numbers = append(numbers, n)
+				}
+			}
+			sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+			if len(numbers) > f.listPageSize {
+				numbers = numbers[:f.listPageSize]
+				res.IsTruncated = true
+				res.NextPartNumberMarker = numbers[len(numbers)-1]
+			}
+			for _, n := range numbers {
+				data := up.parts[n]
+				res.Parts = append(res.Parts, part{PartNumber: n, ETag: etag(data), Size: len(data), ChecksumSHA256: checksumSHA256(data)})
+			}
+		}
+		f.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		writeXML(w, res)
+
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		f.called("CompleteMultipartUpload")
+		var req struct {
+			Parts []struct {
+				PartNumber     int32
+				ETag           string
+				ChecksumSHA256 string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		up, ok := f.uploads[q.Get("uploadId")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		if _, exists := f.objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		var (
+			object []byte
+			sums   []byte
+		)
+		for i, p := range req.Parts {
+			data, ok := up.parts[p.PartNumber]
+			if !ok || int(p.PartNumber) != i+1 || p.ETag != etag(data) || p.ChecksumSHA256 != checksumSHA256(data) {
+				writeError(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			object = append(object, data...)
+			sum := sha256.Sum256(data)
+			sums = append(sums, sum[:]...)
+		}
+		if len(req.Parts) != len(up.parts) {
+			// S3 would drop the extra parts, but the uploader should
+			// never leave any
+			writeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		delete(f.uploads, q.Get("uploadId"))
+		f.objects[key] = object
+		f.metadata[key] = up.metadata
+		f.checksums[key] = checksumSHA256(sums) + "-" + strconv.Itoa(len(req.Parts))
+		writeXML(w, struct {
+			XMLName        xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket         string
+			Key            string
+			ETag           string
+			ChecksumSHA256 string
+		}{Bucket: testBucket, Key: key, ETag: fmt.Sprintf(`"%x-%d"`, md5.Sum(object), len(req.Parts)), ChecksumSHA256: checksumSHA256(sums) + "-" + strconv.Itoa(len(req.Parts))})
+
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		f.called("AbortMultipartUpload " + q.Get("uploadId"))
+		f.mu.Lock()
+		_, ok := f.uploads[q.Get("uploadId")]
+		delete(f.uploads, q.Get("uploadId"))
+		f.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		f.called("PutObject")
+		if f.beforePut != nil && !f.beforePut(key) {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		if sum := r.Header.Get("X-Amz-Checksum-Sha256"); sum != checksumSHA256(body) {
+			writeError(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, exists := f.objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		f.objects[key] = body
+		f.metadata[key] = metadataOf(r.Header)
+		f.checksums[key] = checksumSHA256(body)
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodHead:
+		f.called("HeadObject")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range f.metadata[key] {
+			w.Header().Set("X-Amz-Meta-"+k, v)
+		}
+		if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" && !f.noChecksums {
+			w.Header().Set("X-Amz-Checksum-Sha256", f.checksums[key])
+		}
+		w.Header().Set("ETag", etag(data))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// putObject stores an object as if it was put with its checksum and
+// metadata.
+func (f *fakeS3) putObject(key string, data []byte, metadata map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = data
+	f.metadata[key] = metadata
+	f.checksums[key] = checksumSHA256(data)
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[key]
+	return bytes.Clone(data), ok
+}
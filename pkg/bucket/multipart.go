@@ -0,0 +1,329 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/humanlogio/apictl/pkg/progress"
+)
+
+// MinPartSize is the smallest part S3 accepts, besides the last one.
+const MinPartSize = 5 << 20
+
+// Uploader uploads files in parts, in parallel. Progress is saved to a state
+// file after every part, so that an interrupted upload can be resumed by
+// running it again.
+type Uploader struct {
+	Client      *s3.Client
+	PartSize    int64
+	Concurrency int
+	// StatePath is where progress is saved. It is removed once the upload
+	// is completed or aborted.
+	StatePath string
+	Progress  *progress.Reporter
+	// IfAbsent makes the upload fail if the object exists once it's
+	// completed.
+	IfAbsent bool
+}
+
+// uploadState is what's saved to the state file.
+type uploadState struct {
+	Bucket   string          `json:"bucket"`
+	Key      string          `json:"key"`
+	UploadID string          `json:"upload_id"`
+	Size     int64           `json:"size"`
+	ModTime  time.Time       `json:"mod_time"`
+	PartSize int64           `json:"part_size"`
+	Parts    []completedPart `json:"parts"`
+}
+
+type completedPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	// ChecksumSHA256 is the base64 encoded sha256 of the part.
+	ChecksumSHA256 string `json:"checksum_sha256,omitempty"`
+}
+
+// Upload sends the file at `path` to the object described by `input`. If
+// `ctx` is canceled, the multipart upload is aborted. Other failures leave it
+// in place to be resumed.
+//
+// Each part is sent with its sha256, and the checksum of the whole object is
+// returned as S3 computes it for multipart uploads.
+func (u *Uploader) Upload(ctx context.Context, input *s3.CreateMultipartUploadInput, path string) (*s3.CompleteMultipartUploadOutput, string, error) {
+	if u.PartSize < MinPartSize {
+		return nil, "", fmt.Errorf("part size must be at least %d bytes, got %d", MinPartSize, u.PartSize)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	st, err := u.resume(ctx, input, fi)
+	if err != nil {
+		return nil, "", err
+	}
+	if st == nil {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+		res, err := u.Client.CreateMultipartUpload(ctx, input)
+		if err != nil {
+			return nil, "", fmt.Errorf("creating multipart upload: %w", err)
+		}
+		st = &uploadState{
+			Bucket:   aws.ToString(input.Bucket),
+			Key:      aws.ToString(input.Key),
+			UploadID: aws.ToString(res.UploadId),
+			Size:     fi.Size(),
+			ModTime:  fi.ModTime(),
+			PartSize: u.PartSize,
+		}
+		if err := u.save(st); err != nil {
+			return nil, "", err
+		}
+		log.Printf("started multipart upload %q", st.UploadID)
+	}
+
+	if err := u.uploadParts(ctx, f, st); err != nil {
+		if ctx.Err() != nil {
+			return nil, "", errors.Join(err, u.abort(st))
+		}
+		return nil, "", fmt.Errorf("%w (progress saved to %q, run again to resume)", err, u.StatePath)
+	}
+
+	sort.Slice(st.Parts, func(i, j int) bool { return st.Parts[i].Number < st.Parts[j].Number })
+	var (
+		parts    = make([]types.CompletedPart, 0, len(st.Parts))
+		checksum = sha256.New()
+	)
+	for _, p := range st.Parts {
+		parts = append(parts, types.CompletedPart{
+			PartNumber:     aws.Int32(p.Number),
+			ETag:           aws.String(p.ETag),
+			ChecksumSHA256: nilIfEmpty(p.ChecksumSHA256),
+		})
+		sum, err := base64.StdEncoding.DecodeString(p.ChecksumSHA256)
+		if err != nil || len(sum) != sha256.Size {
+			// the server didn't keep it, the object's checksum is unknown
+			checksum = nil
+		} else if checksum != nil {
+			checksum.Write(sum)
+		}
+	}
+	complete := &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        aws.String(st.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}
+	if u.IfAbsent {
+		complete.IfNoneMatch = aws.String("*")
+	}
+	out, err := u.Client.CompleteMultipartUpload(ctx, complete)
+	if u.IfAbsent && IsPreconditionFailed(err) {
+		// the object was created meanwhile, the parts are of no use
+		return nil, "", errors.Join(err, u.abort(st))
+	} else if err != nil {
+		return nil, "", fmt.Errorf("completing multipart upload: %w", err)
+	}
+	if err := os.Remove(u.StatePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("upload completed but can't remove state file: %v", err)
+	}
+	var objectChecksum string
+	if checksum != nil {
+		objectChecksum = fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(checksum.Sum(nil)), len(parts))
+	}
+	return out, objectChecksum, nil
+}
+
+// resume loads the saved state if it's for the same object and file, and the
+// upload is still known to the server. It returns nil if there's nothing to
+// resume.
+func (u *Uploader) resume(ctx context.Context, input *s3.CreateMultipartUploadInput, fi fs.FileInfo) (*uploadState, error) {
+	data, err := os.ReadFile(u.StatePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading upload state: %w", err)
+	}
+	st := new(uploadState)
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("decoding upload state %q: %w", u.StatePath, err)
+	}
+	if st.Bucket != aws.ToString(input.Bucket) || st.Key != aws.ToString(input.Key) ||
+		st.Size != fi.Size() || !st.ModTime.Equal(fi.ModTime()) || st.PartSize != u.PartSize {
+		log.Printf("upload state %q is for another object, file or part size, aborting upload %q", u.StatePath, st.UploadID)
+		return nil, u.abort(st)
+	}
+
+	// the server is authoritative on which parts it has
+	st.Parts = st.Parts[:0]
+	paginator := s3.NewListPartsPaginator(u.Client, &s3.ListPartsInput{
+		Bucket:   input.Bucket,
+		Key:      input.Key,
+		UploadId: aws.String(st.UploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		// ListParts doesn't model NoSuchUpload, only its code tells
+		if hasErrorCode(err, "NoSuchUpload") {
+			log.Printf("upload %q is gone, starting over", st.UploadID)
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("listing parts of upload %q: %w", st.UploadID, err)
+		}
+		for _, p := range page.Parts {
+			st.Parts = append(st.Parts, completedPart{
+				Number:         aws.ToInt32(p.PartNumber),
+				ETag:           aws.ToString(p.ETag),
+				ChecksumSHA256: aws.ToString(p.ChecksumSHA256),
+			})
+		}
+	}
+	log.Printf("resuming upload %q, %d/%d parts already uploaded", st.UploadID, len(st.Parts), partCount(st.Size, st.PartSize))
+	return st, nil
+}
+
+func (u *Uploader) uploadParts(ctx context.Context, f *os.File, st *uploadState) error {
+	done := make(map[int32]bool, len(st.Parts))
+	for _, p := range st.Parts {
+		done[p.Number] = true
+		u.Progress.Add(min(st.PartSize, st.Size-int64(p.Number-1)*st.PartSize))
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	todo := make(chan int32)
+	go func() {
+		defer close(todo)
+		for n := int32(1); n <= partCount(st.Size, st.PartSize); n++ {
+			if done[n] {
+				continue
+			}
+			select {
+			case todo <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for i := 0; i < max(u.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, st.PartSize)
+			for n := range todo {
+				offset := int64(n-1) * st.PartSize
+				part := buf[:min(st.PartSize, st.Size-offset)]
+				if _, err := f.ReadAt(part, offset); err != nil && !errors.Is(err, io.EOF) {
+					cancel(fmt.Errorf("reading part %d: %w", n, err))
+					return
+				}
+				sum := sha256.Sum256(part)
+				checksum := base64.StdEncoding.EncodeToString(sum[:])
+				res, err := u.Client.UploadPart(ctx, &s3.UploadPartInput{
+					Bucket:         aws.String(st.Bucket),
+					Key:            aws.String(st.Key),
+					UploadId:       aws.String(st.UploadID),
+					PartNumber:     aws.Int32(n),
+					ContentLength:  aws.Int64(int64(len(part))),
+					ChecksumSHA256: aws.String(checksum),
+					Body:           u.Progress.ReadSeeker(bytes.NewReader(part)),
+				})
+				if err != nil {
+					cancel(fmt.Errorf("uploading part %d: %w", n, err))
+					return
+				}
+				mu.Lock()
+				st.Parts = append(st.Parts, completedPart{Number: n, ETag: aws.ToString(res.ETag), ChecksumSHA256: checksum})
+				err = u.save(st)
+				mu.Unlock()
+				if err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+func (u *Uploader) save(st *uploadState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := u.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("saving upload state: %w", err)
+	}
+	if err := os.Rename(tmp, u.StatePath); err != nil {
+		return fmt.Errorf("saving upload state: %w", err)
+	}
+	return nil
+}
+
+// abort gives up on the upload so the server drops its parts. It is meant to
+// run after the caller's context is done.
+func (u *Uploader) abort(st *uploadState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := u.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(st.Bucket),
+		Key:      aws.String(st.Key),
+		UploadId: aws.String(st.UploadID),
+	})
+	if err != nil && !errors.As(err, new(*types.NoSuchUpload)) {
+		return fmt.Errorf("aborting multipart upload %q: %w", st.UploadID, err)
+	}
+	log.Printf("aborted multipart upload %q", st.UploadID)
+	if err := os.Remove(u.StatePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing upload state: %w", err)
+	}
+	return nil
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func partCount(size, partSize int64) int32 {
+	if size == 0 {
+		return 1
+	}
+	return int32((size + partSize - 1) / partSize)
+}
+
+// StatePathFor is the default state file of an upload, next to the file being
+// uploaded.
+func StatePathFor(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".s3upload")
+}
@@ -0,0 +1,316 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const testPartSize = MinPartSize
+
+// writeTestFile writes a file of 2 full parts and a short one.
+func writeTestFile(t *testing.T) (string, []byte) {
+	t.Helper()
+	data := make([]byte, 2*testPartSize+1234)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	path := filepath.Join(t.TempDir(), "apictl.tar.gz")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func testParts(data []byte) map[int32][]byte {
+	parts := make(map[int32][]byte)
+	for n := int32(1); int64(n-1)*testPartSize < int64(len(data)); n++ {
+		offset := int64(n-1) * testPartSize
+		parts[n] = data[offset:min(offset+testPartSize, int64(len(data)))]
+	}
+	return parts
+}
+
+// compositeChecksum is the checksum S3 gives multipart objects.
+func compositeChecksum(data []byte) string {
+	parts := testParts(data)
+	h := sha256.New()
+	for n := int32(1); n <= int32(len(parts)); n++ {
+		sum := sha256.Sum256(parts[n])
+		h.Write(sum[:])
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(parts))
+}
+
+func createInput(key string) *s3.CreateMultipartUploadInput {
+	return &s3.CreateMultipartUploadInput{Bucket: aws.String(testBucket), Key: aws.String(key)}
+}
+
+func newTestUploader(client *s3.Client, path string) *Uploader {
+	return &Uploader{
+		Client:      client,
+		PartSize:    testPartSize,
+		Concurrency: 2,
+		StatePath:   StatePathFor(path),
+	}
+}
+
+func checkUploaded(t *testing.T, f *fakeS3, u *Uploader, key string, data []byte, checksum string) {
+	t.Helper()
+	if got, ok := f.object(key); !ok || !bytes.Equal(got, data) {
+		t.Errorf("object %q has %d bytes, want %d", key, len(got), len(data))
+	}
+	if want := compositeChecksum(data); checksum != want {
+		t.Errorf("checksum %q, want %q", checksum, want)
+	}
+	if _, err := os.Stat(u.StatePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state file wasn't removed: %v", err)
+	}
+}
+
+func TestUploaderUpload(t *testing.T) {
+	f, client := newFakeS3(t)
+	path, data := writeTestFile(t)
+	u := newTestUploader(client, path)
+
+	out, checksum, err := u.Upload(context.Background(), createInput("a/apictl.tar.gz"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUploaded(t, f, u, "a/apictl.tar.gz", data, checksum)
+	if want := compositeChecksum(data); aws.ToString(out.ChecksumSHA256) != want {
+		t.Errorf("server checksum %q, want %q", aws.ToString(out.ChecksumSHA256), want)
+	}
+	if got, want := f.callsTo("UploadPart"), []string{"UploadPart 1", "UploadPart 2", "UploadPart 3"}; !slices.Equal(got, want) {
+		t.Errorf("uploaded %v, want %v", got, want)
+	}
+}
+
+func TestUploaderRejectsSmallParts(t *testing.T) {
+	_, client := newFakeS3(t)
+	path, _ := writeTestFile(t)
+	u := newTestUploader(client, path)
+	u.PartSize = MinPartSize - 1
+	if _, _, err := u.Upload(context.Background(), createInput("a"), path); err == nil || !strings.Contains(err.Error(), "part size must be at least") {
+		t.Errorf("error %v, want a part size error", err)
+	}
+}
+
+func TestUploaderResume(t *testing.T) {
+	f, client := newFakeS3(t)
+	f.listPageSize = 1
+	path, data := writeTestFile(t)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := newTestUploader(client, path)
+	parts := testParts(data)
+
+	// the server has parts 1 and 3, while the state file only knows of 1
+	// and a part 2 that the server lost
+	id := f.startUpload("apictl.tar.gz", map[int32][]byte{1: parts[1], 3: parts[3]})
+	err = u.save(&uploadState{
+		Bucket:   testBucket,
+		Key:      "apictl.tar.gz",
+		UploadID: id,
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+		PartSize: testPartSize,
+		Parts: []completedPart{
+			{Number: 1, ETag: etag(parts[1]), ChecksumSHA256: checksumSHA256(parts[1])},
+			{Number: 2, ETag: etag(parts[2]), ChecksumSHA256: checksumSHA256(parts[2])},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, checksum, err := u.Upload(context.Background(), createInput("apictl.tar.gz"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUploaded(t, f, u, "apictl.tar.gz", data, checksum)
+	if got := f.callsTo("CreateMultipartUpload"); len(got) != 0 {
+		t.Errorf("a new upload was created instead of resuming %q", id)
+	}
+	if got, want := f.callsTo("UploadPart"), []string{"UploadPart 2"}; !slices.Equal(got, want) {
+		t.Errorf("uploaded %v, want %v", got, want)
+	}
+	if got := f.callsTo("ListParts"); len(got) != 2 {
+		t.Errorf("listed parts in %d pages, want 2", len(got))
+	}
+}
+
+func TestUploaderStartsOverWhenUploadIsGone(t *testing.T) {
+	f, client := newFakeS3(t)
+	path, data := writeTestFile(t)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := newTestUploader(client, path)
+	err = u.save(&uploadState{
+		Bucket:   testBucket,
+		Key:      "apictl.tar.gz",
+		UploadID: "expired",
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+		PartSize: testPartSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, checksum, err := u.Upload(context.Background(), createInput("apictl.tar.gz"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUploaded(t, f, u, "apictl.tar.gz", data, checksum)
+	if got := f.callsTo("CreateMultipartUpload"); len(got) != 1 {
+		t.Errorf("created %d uploads, want 1", len(got))
+	}
+}
+
+func TestUploaderRejectsStaleState(t *testing.T) {
+	tests := []struct {
+		name  string
+		stale func(st *uploadState)
+	}{
+		{name: "other key", stale: func(st *uploadState) { st.Key = "other.tar.gz" }},
+		{name: "other size", stale: func(st *uploadState) { st.Size++ }},
+		{name: "other mtime", stale: func(st *uploadState) { st.ModTime = st.ModTime.Add(-time.Hour) }},
+		{name: "other part size", stale: func(st *uploadState) { st.PartSize *= 2 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeS3(t)
+			path, data := writeTestFile(t)
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u := newTestUploader(client, path)
+			parts := testParts(data)
+			st := &uploadState{
+				Bucket:   testBucket,
+				Key:      "apictl.tar.gz",
+				Size:     fi.Size(),
+				ModTime:  fi.ModTime(),
+				PartSize: testPartSize,
+				Parts:    []completedPart{{Number: 1, ETag: etag(parts[1]), ChecksumSHA256: checksumSHA256(parts[1])}},
+			}
+			tt.stale(st)
+			st.UploadID = f.startUpload(st.Key, map[int32][]byte{1: parts[1]})
+			if err := u.save(st); err != nil {
+				t.Fatal(err)
+			}
+
+			_, checksum, err := u.Upload(context.Background(), createInput("apictl.tar.gz"), path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkUploaded(t, f, u, "apictl.tar.gz", data, checksum)
+			if got, want := f.callsTo("AbortMultipartUpload"), []string{"AbortMultipartUpload " + st.UploadID}; !slices.Equal(got, want) {
+				t.Errorf("aborted %v, want %v", got, want)
+			}
+			if got := f.callsTo("UploadPart"); len(got) != 3 {
+				t.Errorf("uploaded %v, want every part", got)
+			}
+		})
+	}
+}
+
+func TestUploaderAbortsOnCancel(t *testing.T) {
+	f, client := newFakeS3(t)
+	path, _ := writeTestFile(t)
+	u := newTestUploader(client, path)
+	u.Concurrency = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.beforePart = func(n int32) bool {
+		if n == 2 {
+			cancel()
+			return false
+		}
+		return true
+	}
+	_, _, err := u.Upload(ctx, createInput("apictl.tar.gz"), path)
+	if err == nil {
+		t.Fatal("upload succeeded despite being canceled")
+	}
+	if got := f.callsTo("AbortMultipartUpload"); len(got) != 1 {
+		t.Errorf("aborted %v, want the upload", got)
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("%d uploads left on the server", len(f.uploads))
+	}
+	if _, err := os.Stat(u.StatePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state file wasn't removed: %v", err)
+	}
+	if _, ok := f.object("apictl.tar.gz"); ok {
+		t.Error("object was created")
+	}
+}
+
+func TestUploaderKeepsStateOnFailure(t *testing.T) {
+	f, client := newFakeS3(t)
+	path, data := writeTestFile(t)
+	u := newTestUploader(client, path)
+	u.Concurrency = 1
+
+	f.beforePart = func(n int32) bool { return n != 2 }
+	_, _, err := u.Upload(context.Background(), createInput("apictl.tar.gz"), path)
+	if err == nil || !strings.Contains(err.Error(), "run again to resume") {
+		t.Fatalf("error %v, want a resumable failure", err)
+	}
+	if got := f.callsTo("AbortMultipartUpload"); len(got) != 0 {
+		t.Errorf("aborted %v", got)
+	}
+	if _, err := os.Stat(u.StatePath); err != nil {
+		t.Fatalf("state file wasn't kept: %v", err)
+	}
+
+	f.beforePart = nil
+	f.calls = nil
+	_, checksum, err := u.Upload(context.Background(), createInput("apictl.tar.gz"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUploaded(t, f, u, "apictl.tar.gz", data, checksum)
+	if got := f.callsTo("UploadPart"); slices.Contains(got, "UploadPart 1") {
+		t.Errorf("uploaded %v, part 1 was already there", got)
+	}
+}
+
+func TestUploaderIfAbsent(t *testing.T) {
+	f, client := newFakeS3(t)
+	path, _ := writeTestFile(t)
+	u := newTestUploader(client, path)
+	u.IfAbsent = true
+	f.putObject("apictl.tar.gz", []byte("already there"), nil)
+
+	_, _, err := u.Upload(context.Background(), createInput("apictl.tar.gz"), path)
+	if !IsPreconditionFailed(err) {
+		t.Fatalf("error %v, want a precondition failure", err)
+	}
+	if got := f.callsTo("AbortMultipartUpload"); len(got) != 1 {
+		t.Errorf("aborted %v, want the upload", got)
+	}
+	if got, _ := f.object("apictl.tar.gz"); string(got) != "already there" {
+		t.Error("object was overwritten")
+	}
+}
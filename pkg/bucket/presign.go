@@ -0,0 +1,65 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// MaxPresignExpiry is the longest a SigV4 presigned URL can be valid for.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// Presign returns a URL to GET an object, valid for `expiry`.
+func Presign(ctx context.Context, client *s3.Client, bucket, key string, expiry time.Duration) (string, time.Time, error) {
+	if expiry <= 0 || expiry > MaxPresignExpiry {
+		return "", time.Time{}, fmt.Errorf("expiry must be between 0 and %v, got %v", MaxPresignExpiry, expiry)
+	}
+	signedAt := time.Now().UTC()
+	req, err := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("presigning %q: %w", key, err)
+	}
+	return req.URL, signedAt.Add(expiry), nil
+}
+
+// PresignedURL is what can be told of a presigned URL without its secret.
+type PresignedURL struct {
+	Key     string
+	Expires time.Time
+}
+
+// ParsePresignedURL recognizes a presigned GET URL of an object in `bucket`,
+// either in path or virtual host style.
+func ParsePresignedURL(rawURL, bucket string) (*PresignedURL, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, false
+	}
+	q := u.Query()
+	signedAt, err := time.Parse("20060102T150405Z", q.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, false
+	}
+	expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil {
+		return nil, false
+	}
+	var key string
+	if strings.HasPrefix(u.Host, bucket+".") {
+		key = strings.TrimPrefix(u.Path, "/")
+	} else if k, ok := strings.CutPrefix(u.Path, "/"+bucket+"/"); ok {
+		key = k
+	} else {
+		return nil, false
+	}
+	return &PresignedURL{Key: key, Expires: signedAt.Add(time.Duration(expires) * time.Second)}, true
+}
@@ -0,0 +1,385 @@
+package bucket
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/humanlogio/apictl/pkg/progress"
+)
+
+// File is a local file to upload.
+type File struct {
+	Path string
+	// Rel is the path of the file relative to the directory it was found
+	// in, or its base name if it was named directly.
+	Rel string
+}
+
+// ExpandFiles resolves paths, globs and directories into the files they
+// designate. Directories are walked recursively.
+func ExpandFiles(patterns []string) ([]File, error) {
+	var out []File
+	seen := make(map[string]bool)
+	add := func(f File) {
+		if !seen[f.Path] {
+			seen[f.Path] = true
+			out = append(out, f)
+		}
+	}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%q matches no file", pattern)
+		}
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				add(File{Path: match, Rel: filepath.Base(match)})
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(match, path)
+				if err != nil {
+					return err
+				}
+				add(File{Path: path, Rel: filepath.ToSlash(rel)})
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("walking %q: %w", match, err)
+			}
+		}
+	}
+	return out, nil
+}
+
+// KeyData is what key templates can refer to.
+type KeyData struct {
+	Project  string
+	Version  string
+	Filename string
+	// Path is the path of the file relative to the directory it was found
+	// in.
+	Path string
+	OS   string
+	Arch string
+	// Sha256 is the hex encoded sha256 of the file, known to content
+	// addressed uploads only.
+	Sha256 string
+	// Ext is the extension of the file, e.g. `.tar.gz`.
+	Ext string
+}
+
+// KeyTemplate renders object keys, e.g. `{{.Project}}/{{.Version}}/{{.Filename}}`.
+type KeyTemplate struct {
+	tmpl *template.Template
+}
+
+func ParseKeyTemplate(s string) (*KeyTemplate, error) {
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing key template: %w", err)
+	}
+	return &KeyTemplate{tmpl: tmpl}, nil
+}
+
+func (kt *KeyTemplate) Key(data KeyData) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := kt.tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("rendering key of %q: %w", data.Path, err)
+	}
+	key := strings.TrimPrefix(buf.String(), "/")
+	if key == "" {
+		return "", fmt.Errorf("key of %q is empty", data.Path)
+	}
+	return key, nil
+}
+
+// URLData is what URL templates can refer to.
+type URLData struct {
+	KeyData
+	Key string
+}
+
+// URLTemplate renders the public URL of objects, e.g.
+// `https://cdn.example.com/{{.Key}}`.
+type URLTemplate struct {
+	tmpl *template.Template
+}
+
+func ParseURLTemplate(s string) (*URLTemplate, error) {
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing url template: %w", err)
+	}
+	return &URLTemplate{tmpl: tmpl}, nil
+}
+
+func (ut *URLTemplate) URL(data URLData) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := ut.tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("rendering url of %q: %w", data.Key, err)
+	}
+	return buf.String(), nil
+}
+
+// PutResult describes an uploaded file, one per line of an upload manifest.
+type PutResult struct {
+	Path   string `json:"path"`
+	Key    string `json:"key"`
+	URL    string `json:"url,omitempty"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+	// Existed is set if the upload was skipped because the object was
+	// already there.
+	Existed bool `json:"existed,omitempty"`
+}
+
+// Putter uploads files to a bucket, in parts when they're larger than
+// PartSize.
+type Putter struct {
+	Client       *s3.Client
+	Bucket       string
+	ACL          string
+	CacheControl string
+	// PublicURL is where the objects of the bucket are served, if known.
+	PublicURL       string
+	PartSize        int64
+	PartConcurrency int
+	// StatePath is where multipart progress of a file is saved.
+	StatePath func(path string) string
+	Metadata  map[string]string
+	// ContentType overrides the type guessed from file names, if set.
+	ContentType string
+	// Progress counts the bytes sent, if set.
+	Progress *progress.Reporter
+	// Sha256 is the hex encoded sha256 of the file, if the caller already
+	// hashed it; the file is hashed before the upload otherwise.
+	Sha256 string
+}
+
+// ContentType guesses the media type of a release file from its name.
+func ContentType(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "application/gzip"
+	case strings.HasSuffix(name, ".zip"):
+		return "application/zip"
+	case strings.HasSuffix(name, ".deb"):
+		return "application/vnd.debian.binary-package"
+	case strings.HasSuffix(name, ".rpm"):
+		return "application/x-rpm"
+	case strings.HasSuffix(name, ".sig"), strings.HasSuffix(name, ".txt"):
+		return "text/plain; charset=utf-8"
+	}
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// Input is the PutObject request for a file, without its body and checksum.
+func (p *Putter) Input(path, key string) *s3.PutObjectInput {
+	return &s3.PutObjectInput{
+		Bucket:       aws.String(p.Bucket),
+		Key:          aws.String(key),
+		CacheControl: aws.String(p.CacheControl),
+		ContentType:  aws.String(cmp.Or(p.ContentType, ContentType(path))),
+		ACL:          types.ObjectCannedACL(p.ACL),
+		Metadata:     p.Metadata,
+	}
+}
+
+// Multipart tells if a file of that size is uploaded in parts.
+func (p *Putter) Multipart(size int64) bool {
+	return size > p.PartSize
+}
+
+// Put uploads the file at `path` to `key`, with its sha256 so that S3 refuses
+// corrupted uploads, then checks that the object has the expected size and
+// checksum.
+func (p *Putter) Put(ctx context.Context, path, key string) (*PutResult, error) {
+	return p.put(ctx, path, key, false)
+}
+
+// PutIfAbsent is like Put, but skips the upload if the object is already at
+// `key`. The upload is conditional, so that an object with other content is
+// never overwritten, even by a concurrent upload; an *ObjectConflictError is
+// returned instead.
+func (p *Putter) PutIfAbsent(ctx context.Context, path, key string) (*PutResult, error) {
+	return p.put(ctx, path, key, true)
+}
+
+func (p *Putter) put(ctx context.Context, path, key string, ifAbsent bool) (*PutResult, error) {
+	res := &PutResult{Path: path, Key: key}
+	if p.PublicURL != "" {
+		res.URL = strings.TrimSuffix(p.PublicURL, "/") + "/" + key
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sum []byte
+	if p.Sha256 != "" {
+		if sum, err = hex.DecodeString(p.Sha256); err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid sha256 %q for %q", p.Sha256, path)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		res.Size = fi.Size()
+	} else {
+		h := sha256.New()
+		if res.Size, err = io.Copy(h, f); err != nil {
+			return nil, fmt.Errorf("hashing %q: %w", path, err)
+		}
+		sum = h.Sum(nil)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	res.Sha256 = hex.EncodeToString(sum)
+	existed := func() (*PutResult, error) {
+		same, err := SameObject(ctx, p.Client, p.Bucket, key, res.Size, res.Sha256)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			return nil, nil
+		}
+		res.Existed = true
+		return res, nil
+	}
+	if ifAbsent {
+		if res, err := existed(); res != nil || err != nil {
+			return res, err
+		}
+	}
+
+	input := p.Input(path, key)
+	input.Metadata = map[string]string{Sha256MetadataKey: res.Sha256}
+	for k, v := range p.Metadata {
+		input.Metadata[k] = v
+	}
+	if ifAbsent {
+		input.IfNoneMatch = aws.String("*")
+	}
+	body := p.Progress.ReadSeeker(f)
+	var checksum string
+	for attempt := 0; ; attempt++ {
+		checksum, err = p.upload(ctx, input, path, body, res.Size, sum, ifAbsent)
+		if !ifAbsent || !IsPreconditionFailed(err) {
+			break
+		}
+		other, herr := existed()
+		if herr != nil {
+			return nil, herr
+		}
+		if other != nil {
+			log.Printf("%q was uploaded concurrently, with the same content", key)
+			return other, nil
+		}
+		// the object was deleted since, or isn't visible yet
+		if attempt > 0 {
+			return nil, fmt.Errorf("conditional write of %q refused, but no object was found: %w", key, err)
+		}
+		log.Printf("conditional write of %q refused, but no object was found, retrying", key)
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyObject(ctx, p.Client, p.Bucket, key, res.Size, checksum); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// upload sends the content of `path`, in parts if it's large, and returns the
+// base64 encoded checksum the object should have.
+func (p *Putter) upload(ctx context.Context, input *s3.PutObjectInput, path string, body io.ReadSeeker, size int64, sum []byte, ifAbsent bool) (string, error) {
+	if p.Multipart(size) {
+		uploader := &Uploader{
+			Client:      p.Client,
+			PartSize:    p.PartSize,
+			Concurrency: p.PartConcurrency,
+			StatePath:   p.StatePath(path),
+			Progress:    p.Progress,
+			IfAbsent:    ifAbsent,
+		}
+		_, checksum, err := uploader.Upload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:       input.Bucket,
+			Key:          input.Key,
+			CacheControl: input.CacheControl,
+			ContentType:  input.ContentType,
+			ACL:          input.ACL,
+			Metadata:     input.Metadata,
+		}, path)
+		if err != nil {
+			return "", fmt.Errorf("uploading %q in parts: %w", path, err)
+		}
+		return checksum, nil
+	}
+	checksum := base64.StdEncoding.EncodeToString(sum)
+	input.Body = body
+	input.ContentLength = aws.Int64(size)
+	input.ChecksumSHA256 = aws.String(checksum)
+	if _, err := p.Client.PutObject(ctx, input); err != nil {
+		return "", fmt.Errorf("putting object %q: %w", path, err)
+	}
+	return checksum, nil
+}
+
+// VerifyObject checks that an object has the given size and, if the server
+// reports it, the given base64 encoded sha256 checksum.
+func VerifyObject(ctx context.Context, client *s3.Client, bucket, key string, size int64, checksum string) error {
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("checking uploaded object %q: %w", key, err)
+	}
+	if got := aws.ToInt64(head.ContentLength); got != size {
+		return fmt.Errorf("uploaded object %q has %d bytes instead of %d", key, got, size)
+	}
+	got := aws.ToString(head.ChecksumSHA256)
+	switch {
+	case got == "":
+		log.Printf("server didn't report a sha256 for %q, only its size was checked", key)
+	case checksum != "" && got != checksum:
+		return fmt.Errorf("uploaded object %q has sha256 %s instead of %s", key, got, checksum)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package bucket
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPutterPrecomputedSha256(t *testing.T) {
+	content := []byte("apictl archive")
+	tests := []struct {
+		name    string
+		sha256  string
+		wantErr string
+	}{
+		{name: "hashed by the putter"},
+		{name: "precomputed", sha256: sha256Hex(content)},
+		{name: "wrong sum", sha256: sha256Hex([]byte("other")), wantErr: `putting object`},
+		{name: "invalid sum", sha256: "abc", wantErr: `invalid sha256 "abc"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeS3(t)
+			path := filepath.Join(t.TempDir(), "apictl.tar.gz")
+			if err := os.WriteFile(path, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			p := &Putter{Client: client, Bucket: testBucket, PartSize: MinPartSize, StatePath: StatePathFor, Sha256: tt.sha256}
+
+			res, err := p.Put(context.Background(), path, "0.1.0/apictl.tar.gz")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				if _, ok := f.object("0.1.0/apictl.tar.gz"); ok {
+					t.Error("object was uploaded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Sha256 != sha256Hex(content) || res.Size != int64(len(content)) {
+				t.Errorf("got %+v", res)
+			}
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if got := f.metadata["0.1.0/apictl.tar.gz"][Sha256MetadataKey]; got != sha256Hex(content) {
+				t.Errorf("metadata sha256 is %q", got)
+			}
+		})
+	}
+}
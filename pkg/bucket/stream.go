@@ -0,0 +1,130 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// PutStream uploads the content of `r`, which needs neither be seekable nor
+// of known size. Content is buffered one part at a time, and sent with a
+// single PutObject if it fits in one part.
+//
+// If `wantSha256` is set, the upload is abandoned unless the content hashes to
+// it. The size and S3 checksum of the object are returned, as VerifyObject
+// expects them.
+func PutStream(ctx context.Context, client *s3.Client, input *s3.PutObjectInput, r io.Reader, partSize int64, wantSha256 string) (int64, string, error) {
+	if partSize < MinPartSize {
+		return 0, "", fmt.Errorf("part size must be at least %d bytes, got %d", MinPartSize, partSize)
+	}
+	var (
+		whole = sha256.New()
+		buf   = make([]byte, partSize)
+		key   = aws.ToString(input.Key)
+	)
+	checkWhole := func() error {
+		if got := hex.EncodeToString(whole.Sum(nil)); wantSha256 != "" && got != wantSha256 {
+			return fmt.Errorf("content of %q hashes to %s instead of %s", key, got, wantSha256)
+		}
+		return nil
+	}
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, "", err
+	}
+	whole.Write(buf[:n])
+	if int64(n) < partSize {
+		if err := checkWhole(); err != nil {
+			return 0, "", err
+		}
+		sum := sha256.Sum256(buf[:n])
+		checksum := base64.StdEncoding.EncodeToString(sum[:])
+		input.Body = bytes.NewReader(buf[:n])
+		input.ContentLength = aws.Int64(int64(n))
+		input.ChecksumSHA256 = aws.String(checksum)
+		if _, err := client.PutObject(ctx, input); err != nil {
+			return 0, "", fmt.Errorf("putting object %q: %w", key, err)
+		}
+		return int64(n), checksum, nil
+	}
+
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:            input.Bucket,
+		Key:               input.Key,
+		ACL:               input.ACL,
+		CacheControl:      input.CacheControl,
+		ContentType:       input.ContentType,
+		Metadata:          input.Metadata,
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("creating multipart upload: %w", err)
+	}
+	abort := func(err error) (int64, string, error) {
+		actx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, aerr := client.AbortMultipartUpload(actx, &s3.AbortMultipartUploadInput{
+			Bucket:   input.Bucket,
+			Key:      input.Key,
+			UploadId: created.UploadId,
+		})
+		if aerr != nil {
+			err = errors.Join(err, fmt.Errorf("aborting multipart upload: %w", aerr))
+		}
+		return 0, "", err
+	}
+	var (
+		size      int64
+		parts     []types.CompletedPart
+		composite = sha256.New()
+	)
+	for number := int32(1); n > 0; number++ {
+		sum := sha256.Sum256(buf[:n])
+		composite.Write(sum[:])
+		checksum := base64.StdEncoding.EncodeToString(sum[:])
+		res, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:         input.Bucket,
+			Key:            input.Key,
+			UploadId:       created.UploadId,
+			PartNumber:     aws.Int32(number),
+			ContentLength:  aws.Int64(int64(n)),
+			ChecksumSHA256: aws.String(checksum),
+			Body:           bytes.NewReader(buf[:n]),
+		})
+		if err != nil {
+			return abort(fmt.Errorf("uploading part %d: %w", number, err))
+		}
+		size += int64(n)
+		parts = append(parts, types.CompletedPart{PartNumber: aws.Int32(number), ETag: res.ETag, ChecksumSHA256: aws.String(checksum)})
+
+		n, err = io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return abort(err)
+		}
+		whole.Write(buf[:n])
+	}
+	if err := checkWhole(); err != nil {
+		return abort(err)
+	}
+	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		IfNoneMatch:     input.IfNoneMatch,
+	})
+	if err != nil {
+		return abort(fmt.Errorf("completing multipart upload: %w", err))
+	}
+	return size, fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(composite.Sum(nil)), len(parts)), nil
+}
@@ -0,0 +1,141 @@
+package catalog
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/release"
+	"github.com/humanlogio/apictl/pkg/versions"
+	"sigs.k8s.io/yaml"
+)
+
+// Manifest declares the release catalog of a project.
+type Manifest struct {
+	Project  string    `json:"project"`
+	Channels []Channel `json:"channels"`
+	Versions []Version `json:"versions"`
+}
+
+type Channel struct {
+	Name     string `json:"name"`
+	Priority int32  `json:"priority"`
+}
+
+type Version struct {
+	Version string `json:"version"`
+	// PublishedOn lists the channels the version is published on.
+	PublishedOn []string   `json:"published_on,omitempty"`
+	Artifacts   []Artifact `json:"artifacts"`
+
+	parsed *typesv1.Version
+}
+
+type Artifact struct {
+	URL       string `json:"url"`
+	Sha256    string `json:"sha256"`
+	Signature string `json:"signature,omitempty"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+func (a Artifact) proto() *typesv1.VersionArtifact {
+	return &typesv1.VersionArtifact{
+		Url:             a.URL,
+		Sha256:          a.Sha256,
+		Signature:       a.Signature,
+		Architecture:    a.Arch,
+		OperatingSystem: a.OS,
+	}
+}
+
+// Load reads a manifest in YAML or JSON from `path`, or from stdin if `path`
+// is `-`.
+func Load(path string) (*Manifest, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	m := new(Manifest)
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) validate() error {
+	if m.Project == "" {
+		return fmt.Errorf("`project` is required")
+	}
+	channels := make(map[string]bool, len(m.Channels))
+	for _, ch := range m.Channels {
+		if ch.Name == "" {
+			return fmt.Errorf("channel without a name")
+		}
+		if channels[ch.Name] {
+			return fmt.Errorf("channel %q declared twice", ch.Name)
+		}
+		channels[ch.Name] = true
+	}
+	seen := make(map[string]bool, len(m.Versions))
+	for i := range m.Versions {
+		v := &m.Versions[i]
+		parsed, err := versions.Parse(v.Version)
+		if err != nil {
+			return fmt.Errorf("version %q: %w", v.Version, err)
+		}
+		v.parsed = parsed
+		key := versions.String(parsed)
+		if seen[key] {
+			return fmt.Errorf("version %q declared twice", key)
+		}
+		seen[key] = true
+		for _, ch := range v.PublishedOn {
+			if !channels[ch] {
+				return fmt.Errorf("version %q is published on undeclared channel %q", key, ch)
+			}
+		}
+		platforms := make(map[release.Platform]bool, len(v.Artifacts))
+		for _, a := range v.Artifacts {
+			if a.URL == "" || a.Sha256 == "" || a.OS == "" || a.Arch == "" {
+				return fmt.Errorf("version %q: artifacts need a url, sha256, os and arch", key)
+			}
+			p := release.Platform{OS: a.OS, Arch: a.Arch}
+			if platforms[p] {
+				return fmt.Errorf("version %q has two artifacts for %s", key, p)
+			}
+			platforms[p] = true
+		}
+	}
+	return nil
+}
+
+// Platforms lists every platform any version has an artifact for.
+func (m *Manifest) Platforms() []release.Platform {
+	var (
+		out  []release.Platform
+		seen = make(map[release.Platform]bool)
+	)
+	for _, v := range m.Versions {
+		for _, a := range v.Artifacts {
+			p := release.Platform{OS: a.OS, Arch: a.Arch}
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,296 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"connectrpc.com/connect"
+	"github.com/humanlogio/api/go/svc/cliupdate/v1/cliupdatev1connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/release"
+	"github.com/humanlogio/apictl/pkg/versions"
+	"google.golang.org/protobuf/proto"
+)
+
+// State is what the API currently holds for a project.
+//
+// The API can't list which versions are published on a channel, so the
+// publications are observed through the head of each channel: the version a
+// fresh install on each platform would receive.
+type State struct {
+	Channels []*typesv1.ReleaseChannel
+	Versions []*releasepb.ListVersionArtifactResponse_ListItem
+	Heads    map[string]map[release.Platform]*typesv1.Version
+}
+
+// Observe reads the current state of the project the manifest describes.
+func Observe(ctx context.Context, rc releasev1connect.ReleaseServiceClient, uc cliupdatev1connect.UpdateServiceClient, m *Manifest) (*State, error) {
+	st := &State{Heads: make(map[string]map[release.Platform]*typesv1.Version)}
+	var err error
+	if st.Channels, err = release.ListAllReleaseChannels(ctx, rc, m.Project); err != nil {
+		return nil, err
+	}
+	if st.Versions, err = release.ListAllVersionArtifacts(ctx, rc, m.Project); err != nil {
+		return nil, err
+	}
+	for _, ch := range st.Channels {
+		heads := make(map[release.Platform]*typesv1.Version)
+		for _, p := range m.Platforms() {
+			head, _, err := release.ChannelHead(ctx, uc, m.Project, ch.Name, p.OS, p.Arch)
+			if err != nil {
+				return nil, err
+			}
+			if head != nil {
+				heads[p] = head
+			}
+		}
+		st.Heads[ch.Name] = heads
+	}
+	return st, nil
+}
+
+type ActionKind string
+
+const (
+	ActionCreateReleaseChannel  ActionKind = "create-release-channel"
+	ActionCreateVersionArtifact ActionKind = "create-version-artifact"
+	// ActionReplaceVersionArtifact deletes an artifact and registers its
+	// replacement, since a platform has a single artifact per version.
+	ActionReplaceVersionArtifact ActionKind = "replace-version-artifact"
+	ActionPublishVersion         ActionKind = "publish-version"
+	ActionUnpublishVersion       ActionKind = "unpublish-version"
+	ActionDeleteVersionArtifact  ActionKind = "delete-version-artifact"
+)
+
+// Action is one change needed to converge the API towards the manifest.
+type Action struct {
+	Kind     ActionKind               `json:"kind"`
+	Channel  *typesv1.ReleaseChannel  `json:"channel,omitempty"`
+	Version  string                   `json:"version,omitempty"`
+	Artifact *typesv1.VersionArtifact `json:"artifact,omitempty"`
+	// Replaces is the artifact a replacement deletes.
+	Replaces *typesv1.VersionArtifact `json:"replaces,omitempty"`
+	Reason   string                   `json:"reason,omitempty"`
+
+	version *typesv1.Version
+}
+
+func (a *Action) String() string {
+	switch a.Kind {
+	case ActionCreateReleaseChannel:
+		return fmt.Sprintf("+ release-channel %q (priority %d)", a.Channel.Name, a.Channel.Priority)
+	case ActionCreateVersionArtifact:
+		return fmt.Sprintf("+ version-artifact %s %s (%s)", a.Version, release.PlatformOf(a.Artifact), a.Artifact.Url)
+	case ActionReplaceVersionArtifact:
+		return fmt.Sprintf("~ version-artifact %s %s (%s -> %s)", a.Version, release.PlatformOf(a.Artifact), a.Replaces.Url, a.Artifact.Url)
+	case ActionDeleteVersionArtifact:
+		return fmt.Sprintf("- version-artifact %s %s (%s)", a.Version, release.PlatformOf(a.Artifact), a.Artifact.Url)
+	case ActionPublishVersion:
+		return fmt.Sprintf("+ published-version %s on %q", a.Version, a.Channel.Name)
+	case ActionUnpublishVersion:
+		return fmt.Sprintf("- published-version %s on %q", a.Version, a.Channel.Name)
+	}
+	return string(a.Kind)
+}
+
+// Plan lists the actions converging the API towards a manifest, in the order
+// they must be applied.
+type Plan struct {
+	Project string    `json:"project"`
+	Actions []*Action `json:"actions"`
+	// Warnings are differences that the plan can't resolve.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Diff computes the plan converging `st` to `m`. Nothing is deleted or
+// unpublished unless `prune` is set.
+func Diff(m *Manifest, st *State, prune bool) *Plan {
+	plan := &Plan{Project: m.Project}
+	var (
+		creates, publishes, unpublishes, deletes []*Action
+	)
+
+	remoteChannels := make(map[string]*typesv1.ReleaseChannel, len(st.Channels))
+	for _, ch := range st.Channels {
+		remoteChannels[ch.Name] = ch
+	}
+	channels := make(map[string]*typesv1.ReleaseChannel, len(m.Channels))
+	for _, ch := range m.Channels {
+		want := &typesv1.ReleaseChannel{Name: ch.Name, Priority: ch.Priority}
+		channels[ch.Name] = want
+		have, ok := remoteChannels[ch.Name]
+		if !ok {
+			plan.Actions = append(plan.Actions, &Action{Kind: ActionCreateReleaseChannel, Channel: want})
+			continue
+		}
+		if have.Priority != want.Priority {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("release-channel %q has priority %d instead of %d, and can't be updated", ch.Name, have.Priority, want.Priority))
+		}
+	}
+
+	remoteArtifacts := make(map[string]map[release.Platform]*typesv1.VersionArtifact)
+	remoteItems := make(map[string]*releasepb.ListVersionArtifactResponse_ListItem)
+	for _, item := range st.Versions {
+		key := versions.String(item.Version)
+		remoteItems[key] = item
+		byPlatform := make(map[release.Platform]*typesv1.VersionArtifact, len(item.Artifacts))
+		for _, a := range item.Artifacts {
+			byPlatform[release.PlatformOf(a)] = a
+		}
+		remoteArtifacts[key] = byPlatform
+	}
+
+	declared := make(map[string]bool, len(m.Versions))
+	publishedOn := make(map[string][]string)
+	for _, v := range m.Versions {
+		key := versions.String(v.parsed)
+		declared[key] = true
+		have := remoteArtifacts[key]
+		wanted := make(map[release.Platform]bool, len(v.Artifacts))
+		for _, a := range v.Artifacts {
+			want := a.proto()
+			p := release.PlatformOf(want)
+			wanted[p] = true
+			existing, ok := have[p]
+			switch {
+			case !ok:
+				creates = append(creates, &Action{Kind: ActionCreateVersionArtifact, Version: key, Artifact: want, version: v.parsed})
+			case proto.Equal(existing, want):
+			case prune:
+				creates = append(creates, &Action{Kind: ActionReplaceVersionArtifact, Version: key, Artifact: want, Replaces: existing, Reason: "differs from the manifest", version: v.parsed})
+			default:
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("version-artifact %s %s differs from the manifest, prune to replace it", key, p))
+			}
+		}
+		for _, existing := range remoteItems[key].GetArtifacts() {
+			p := release.PlatformOf(existing)
+			if wanted[p] {
+				continue
+			}
+			if prune {
+				deletes = append(deletes, &Action{Kind: ActionDeleteVersionArtifact, Version: key, Artifact: existing, Reason: "not in manifest", version: v.parsed})
+			} else {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("version-artifact %s %s is not in the manifest, prune to delete it", key, p))
+			}
+		}
+		for _, chName := range v.PublishedOn {
+			publishedOn[chName] = append(publishedOn[chName], key)
+			if servesEverywhere(st.Heads[chName], v) {
+				continue
+			}
+			publishes = append(publishes, &Action{Kind: ActionPublishVersion, Channel: channels[chName], Version: key, version: v.parsed})
+		}
+	}
+
+	for _, item := range st.Versions {
+		key := versions.String(item.Version)
+		if declared[key] {
+			continue
+		}
+		if !prune {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("version %s is not in the manifest, prune to delete its artifacts", key))
+			continue
+		}
+		for _, a := range item.Artifacts {
+			deletes = append(deletes, &Action{Kind: ActionDeleteVersionArtifact, Version: key, Artifact: a, Reason: "version not in manifest", version: item.Version})
+		}
+	}
+
+	for _, ch := range st.Channels {
+		seen := make(map[string]bool)
+		for _, p := range m.Platforms() {
+			head, ok := st.Heads[ch.Name][p]
+			if !ok {
+				continue
+			}
+			key := versions.String(head)
+			if slices.Contains(publishedOn[ch.Name], key) || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if !prune {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("version %s is served on %q but not published there in the manifest, prune to unpublish it", key, ch.Name))
+				continue
+			}
+			unpublishes = append(unpublishes, &Action{Kind: ActionUnpublishVersion, Channel: ch, Version: key, version: head})
+		}
+	}
+
+	plan.Actions = append(plan.Actions, creates...)
+	plan.Actions = append(plan.Actions, publishes...)
+	plan.Actions = append(plan.Actions, unpublishes...)
+	plan.Actions = append(plan.Actions, deletes...)
+	return plan
+}
+
+// servesEverywhere tells if the channel heads show `v` on every platform it
+// has artifacts for.
+func servesEverywhere(heads map[release.Platform]*typesv1.Version, v Version) bool {
+	if len(v.Artifacts) == 0 {
+		return false
+	}
+	for _, a := range v.Artifacts {
+		if !release.SameVersion(heads[release.Platform{OS: a.OS, Arch: a.Arch}], v.parsed) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply performs the actions of the plan in order, stopping at the first
+// failure. Publishing a version that is already published counts as a
+// success, since publications can't be observed directly.
+func (p *Plan) Apply(ctx context.Context, rc releasev1connect.ReleaseServiceClient, onDone func(*Action)) error {
+	for _, a := range p.Actions {
+		var err error
+		switch a.Kind {
+		case ActionCreateReleaseChannel:
+			_, err = rc.CreateReleaseChannel(ctx, connect.NewRequest(&releasepb.CreateReleaseChannelRequest{
+				ProjectName:     p.Project,
+				ChannelName:     a.Channel.Name,
+				ChannelPriority: a.Channel.Priority,
+			}))
+		case ActionCreateVersionArtifact:
+			_, err = rc.CreateVersionArtifact(ctx, connect.NewRequest(&releasepb.CreateVersionArtifactRequest{
+				ProjectName: p.Project,
+				Version:     a.version,
+				Artifact:    a.Artifact,
+			}))
+		case ActionReplaceVersionArtifact:
+			err = release.ReplaceVersionArtifact(ctx, rc, p.Project, a.version, a.Replaces, a.Artifact)
+		case ActionPublishVersion:
+			_, err = rc.PublishVersion(ctx, connect.NewRequest(&releasepb.PublishVersionRequest{
+				ProjectName:        p.Project,
+				ReleaseChannelName: a.Channel.Name,
+				Version:            a.version,
+			}))
+			if release.IsAlreadyExists(err) {
+				err = nil
+			}
+		case ActionUnpublishVersion:
+			_, err = rc.UnpublishVersion(ctx, connect.NewRequest(&releasepb.UnpublishVersionRequest{
+				ProjectName:        p.Project,
+				ReleaseChannelName: a.Channel.Name,
+				Version:            a.version,
+			}))
+		case ActionDeleteVersionArtifact:
+			_, err = rc.DeleteVersionArtifact(ctx, connect.NewRequest(&releasepb.DeleteVersionArtifactRequest{
+				ProjectName: p.Project,
+				Version:     a.version,
+				Artifact:    a.Artifact,
+			}))
+		default:
+			err = fmt.Errorf("unknown action kind %q", a.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("applying `%s`: %w", a, err)
+		}
+		if onDone != nil {
+			onDone(a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/release"
+	"github.com/humanlogio/apictl/pkg/versions"
+	"sigs.k8s.io/yaml"
+)
+
+const testManifest = `
+project: apictl
+channels:
+  - {name: main, priority: 1}
+  - {name: beta, priority: 2}
+versions:
+  - version: 0.1.0
+    published_on: [main]
+    artifacts:
+      - {url: https://x/0.1.0/linux.tar.gz, sha256: aa, os: linux, arch: amd64}
+      - {url: https://x/0.1.0/darwin.tar.gz, sha256: bb, os: darwin, arch: arm64}
+  - version: 0.2.0-rc.1
+    published_on: [beta]
+    artifacts:
+      - {url: https://x/0.2.0-rc.1/linux.tar.gz, sha256: cc, os: linux, arch: amd64}
+`
+
+func parseManifest(t *testing.T, data string) *Manifest {
+	t.Helper()
+	m := new(Manifest)
+	if err := yaml.UnmarshalStrict([]byte(data), m); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func mustVersion(t *testing.T, s string) *typesv1.Version {
+	t.Helper()
+	v, err := versions.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func artifact(url, sha, os, arch string) *typesv1.VersionArtifact {
+	return &typesv1.VersionArtifact{Url: url, Sha256: sha, OperatingSystem: os, Architecture: arch}
+}
+
+var (
+	linux  = release.Platform{OS: "linux", Arch: "amd64"}
+	darwin = release.Platform{OS: "darwin", Arch: "arm64"}
+)
+
+// converged is the state the API holds once testManifest is applied.
+func converged(t *testing.T) *State {
+	return &State{
+		Channels: []*typesv1.ReleaseChannel{{Name: "main", Priority: 1}, {Name: "beta", Priority: 2}},
+		Versions: []*releasepb.ListVersionArtifactResponse_ListItem{
+			{Version: mustVersion(t, "0.1.0"), Artifacts: []*typesv1.VersionArtifact{
+				artifact("https://x/0.1.0/linux.tar.gz", "aa", "linux", "amd64"),
+				artifact("https://x/0.1.0/darwin.tar.gz", "bb", "darwin", "arm64"),
+			}},
+			{Version: mustVersion(t, "0.2.0-rc.1"), Artifacts: []*typesv1.VersionArtifact{
+				artifact("https://x/0.2.0-rc.1/linux.tar.gz", "cc", "linux", "amd64"),
+			}},
+		},
+		Heads: map[string]map[release.Platform]*typesv1.Version{
+			"main": {linux: mustVersion(t, "0.1.0"), darwin: mustVersion(t, "0.1.0")},
+			"beta": {linux: mustVersion(t, "0.2.0-rc.1"), darwin: mustVersion(t, "0.1.0")},
+		},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        func(t *testing.T) *State
+		prune        bool
+		wantActions  []string
+		wantWarnings []string
+	}{
+		{
+			name:  "converged",
+			state: converged,
+			wantWarnings: []string{
+				// beta serves 0.1.0 to darwin, which the manifest only
+				// publishes on main
+				`version 0.1.0 is served on "beta" but not published there in the manifest, prune to unpublish it`,
+			},
+		},
+		{
+			name: "empty",
+			state: func(t *testing.T) *State {
+				return &State{}
+			},
+			wantActions: []string{
+				`+ release-channel "main" (priority 1)`,
+				`+ release-channel "beta" (priority 2)`,
+				"+ version-artifact 0.1.0 linux/amd64 (https://x/0.1.0/linux.tar.gz)",
+				"+ version-artifact 0.1.0 darwin/arm64 (https://x/0.1.0/darwin.tar.gz)",
+				"+ version-artifact 0.2.0-rc.1 linux/amd64 (https://x/0.2.0-rc.1/linux.tar.gz)",
+				`+ published-version 0.1.0 on "main"`,
+				`+ published-version 0.2.0-rc.1 on "beta"`,
+			},
+		},
+		{
+			name: "published on some platforms only",
+			state: func(t *testing.T) *State {
+				st := converged(t)
+				st.Heads["main"] = map[release.Platform]*typesv1.Version{linux: mustVersion(t, "0.1.0")}
+				return st
+			},
+			wantActions: []string{`+ published-version 0.1.0 on "main"`},
+			wantWarnings: []string{
+				`version 0.1.0 is served on "beta" but not published there in the manifest, prune to unpublish it`,
+			},
+		},
+		{
+			name: "channel priority differs",
+			state: func(t *testing.T) *State {
+				st := converged(t)
+				st.Channels[1].Priority = 5
+				return st
+			},
+			wantWarnings: []string{
+				`release-channel "beta" has priority 5 instead of 2, and can't be updated`,
+				`version 0.1.0 is served on "beta" but not published there in the manifest, prune to unpublish it`,
+			},
+		},
+		{
+			name: "changed artifact without prune",
+			state: func(t *testing.T) *State {
+				st := converged(t)
+				st.Versions[0].Artifacts[0].Sha256 = "ff"
+				return st
+			},
+			wantWarnings: []string{
+				"version-artifact 0.1.0 linux/amd64 differs from the manifest, prune to replace it",
+				`version 0.1.0 is served on "beta" but not published there in the manifest, prune to unpublish it`,
+			},
+		},
+		{
+			name: "changed artifact with prune",
+			state: func(t *testing.T) *State {
+				st := converged(t)
+				st.Versions[0].Artifacts[0].Sha256 = "ff"
+				return st
+			},
+			prune: true,
+			wantActions: []string{
+				"~ version-artifact 0.1.0 linux/amd64 (https://x/0.1.0/linux.tar.gz -> https://x/0.1.0/linux.tar.gz)",
+				`- published-version 0.1.0 on "beta"`,
+			},
+		},
+		{
+			name: "undeclared version and platform",
+			state: func(t *testing.T) *State {
+				st := converged(t)
+				st.Versions[1].Artifacts = append(st.Versions[1].Artifacts, artifact("https://x/0.2.0-rc.1/windows.zip", "dd", "windows", "amd64"))
+				st.Versions = append(st.Versions, &releasepb.ListVersionArtifactResponse_ListItem{
+					Version:   mustVersion(t, "0.0.1"),
+					Artifacts: []*typesv1.VersionArtifact{artifact("https://x/0.0.1/linux.tar.gz", "ee", "linux", "amd64")},
+				})
+				return st
+			},
+			wantWarnings: []string{
+				"version-artifact 0.2.0-rc.1 windows/amd64 is not in the manifest, prune to delete it",
+				"version 0.0.1 is not in the manifest, prune to delete its artifacts",
+				`version 0.1.0 is served on "beta" but not published there in the manifest, prune to unpublish it`,
+			},
+		},
+		{
+			name: "undeclared version and platform with prune",
+			state: func(t *testing.T) *State {
+				st := converged(t)
+				st.Versions[1].Artifacts = append(st.Versions[1].Artifacts, artifact("https://x/0.2.0-rc.1/windows.zip", "dd", "windows", "amd64"))
+				st.Versions = append(st.Versions, &releasepb.ListVersionArtifactResponse_ListItem{
+					Version:   mustVersion(t, "0.0.1"),
+					Artifacts: []*typesv1.VersionArtifact{artifact("https://x/0.0.1/linux.tar.gz", "ee", "linux", "amd64")},
+				})
+				st.Heads["main"][linux] = mustVersion(t, "0.0.1")
+				return st
+			},
+			prune: true,
+			wantActions: []string{
+				`+ published-version 0.1.0 on "main"`,
+				`- published-version 0.0.1 on "main"`,
+				`- published-version 0.1.0 on "beta"`,
+				"- version-artifact 0.2.0-rc.1 windows/amd64 (https://x/0.2.0-rc.1/windows.zip)",
+				"- version-artifact 0.0.1 linux/amd64 (https://x/0.0.1/linux.tar.gz)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Diff(parseManifest(t, testManifest), tt.state(t), tt.prune)
+			var got []string
+			for _, a := range plan.Actions {
+				got = append(got, a.String())
+			}
+			if !slices.Equal(got, tt.wantActions) {
+				t.Errorf("actions:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.wantActions, "\n"))
+			}
+			if !slices.Equal(plan.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(plan.Warnings, "\n"), strings.Join(tt.wantWarnings, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiffActionsCarryVersions(t *testing.T) {
+	plan := Diff(parseManifest(t, testManifest), &State{}, false)
+	for _, a := range plan.Actions {
+		if a.Kind == ActionCreateReleaseChannel {
+			continue
+		}
+		if a.version == nil || versions.String(a.version) != a.Version {
+			t.Errorf("%s: version %v doesn't match %q", a, a.version, a.Version)
+		}
+	}
+}
+
+// recordingReleaseService logs the mutations it receives, and fails to create
+// the artifacts at failURL.
+type recordingReleaseService struct {
+	releasev1connect.ReleaseServiceClient
+	failURL string
+	calls   []string
+}
+
+func (f *recordingReleaseService) CreateVersionArtifact(ctx context.Context, req *connect.Request[releasepb.CreateVersionArtifactRequest]) (*connect.Response[releasepb.CreateVersionArtifactResponse], error) {
+	f.calls = append(f.calls, "create "+req.Msg.Artifact.Sha256)
+	if req.Msg.Artifact.Url == f.failURL {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("bad artifact"))
+	}
+	return connect.NewResponse(new(releasepb.CreateVersionArtifactResponse)), nil
+}
+
+func (f *recordingReleaseService) DeleteVersionArtifact(ctx context.Context, req *connect.Request[releasepb.DeleteVersionArtifactRequest]) (*connect.Response[releasepb.DeleteVersionArtifactResponse], error) {
+	f.calls = append(f.calls, "delete "+req.Msg.Artifact.Sha256)
+	return connect.NewResponse(new(releasepb.DeleteVersionArtifactResponse)), nil
+}
+
+func (f *recordingReleaseService) UnpublishVersion(ctx context.Context, req *connect.Request[releasepb.UnpublishVersionRequest]) (*connect.Response[releasepb.UnpublishVersionResponse], error) {
+	f.calls = append(f.calls, "unpublish "+req.Msg.ReleaseChannelName)
+	return connect.NewResponse(new(releasepb.UnpublishVersionResponse)), nil
+}
+
+func TestApplyReplacesArtifacts(t *testing.T) {
+	newPlan := func(url string) *Plan {
+		st := converged(t)
+		st.Versions[0].Artifacts[0].Sha256 = "ff"
+		m := parseManifest(t, testManifest)
+		m.Versions[0].Artifacts[0].URL = url
+		return Diff(m, st, true)
+	}
+	tests := []struct {
+		name      string
+		failURL   string
+		wantCalls []string
+		wantErr   string
+	}{
+		{
+			name: "replaced",
+			// a platform only has one artifact, so the old one goes first
+			wantCalls: []string{"delete ff", "create aa", "unpublish beta"},
+		},
+		{
+			name:      "replacement rejected",
+			failURL:   "https://y/0.1.0/linux.tar.gz",
+			wantCalls: []string{"delete ff", "create aa", "create ff"},
+			wantErr:   "registering replacement version-artifact 0.1.0 linux/amd64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &recordingReleaseService{failURL: tt.failURL}
+			url := "https://x/0.1.0/linux.tar.gz"
+			if tt.failURL != "" {
+				url = tt.failURL
+			}
+			err := newPlan(url).Apply(context.Background(), rc, nil)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+			if !slices.Equal(rc.calls, tt.wantCalls) {
+				t.Errorf("calls %q, want %q", rc.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: testManifest,
+		},
+		{
+			name:    "no project",
+			data:    `versions: []`,
+			wantErr: "`project` is required",
+		},
+		{
+			name: "duplicate channel",
+			data: `
+project: p
+channels: [{name: main}, {name: main}]`,
+			wantErr: `channel "main" declared twice`,
+		},
+		{
+			name: "invalid version",
+			data: `
+project: p
+versions: [{version: one}]`,
+			wantErr: `version "one"`,
+		},
+		{
+			name: "same version twice",
+			data: `
+project: p
+versions: [{version: 1.0.0}, {version: v1.0.0}]`,
+			wantErr: `version "1.0.0" declared twice`,
+		},
+		{
+			name: "undeclared channel",
+			data: `
+project: p
+versions: [{version: 1.0.0, published_on: [main]}]`,
+			wantErr: `published on undeclared channel "main"`,
+		},
+		{
+			name: "incomplete artifact",
+			data: `
+project: p
+versions: [{version: 1.0.0, artifacts: [{url: https://x, os: linux, arch: amd64}]}]`,
+			wantErr: "artifacts need a url, sha256, os and arch",
+		},
+		{
+			name: "two artifacts for a platform",
+			data: `
+project: p
+versions:
+  - version: 1.0.0
+    artifacts:
+      - {url: https://x/a, sha256: aa, os: linux, arch: amd64}
+      - {url: https://x/b, sha256: bb, os: linux, arch: amd64}`,
+			wantErr: "two artifacts for linux/amd64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(Manifest)
+			if err := yaml.UnmarshalStrict([]byte(tt.data), m); err != nil {
+				t.Fatal(err)
+			}
+			err := m.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("want error containing %q", tt.wantErr)
+			case err != nil && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("error %q doesn't contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Plan describes an operation that would have been performed.
+type Plan struct {
+	Target    string          `json:"target"`
+	Auth      string          `json:"auth"`
+	Operation string          `json:"operation"`
+	Request   json.RawMessage `json:"request"`
+	Body      string          `json:"body,omitempty"`
+}
+
+// Printer writes plans instead of performing operations.
+type Printer struct {
+	W      io.Writer
+	Target string
+	Auth   string
+}
+
+// Proto prints a plan for an RPC, with the request encoded as protojson.
+func (p *Printer) Proto(operation string, req proto.Message) error {
+	raw, err := protojson.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding request as protojson: %w", err)
+	}
+	return p.print(Plan{Target: p.Target, Auth: p.Auth, Operation: operation, Request: raw})
+}
+
+// JSON prints a plan for a non-RPC operation. `body` names the content that
+// would have been sent along, if any.
+func (p *Printer) JSON(operation string, req any, body string) error {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding request as json: %w", err)
+	}
+	return p.print(Plan{Target: p.Target, Auth: p.Auth, Operation: operation, Request: raw, Body: body})
+}
+
+func (p *Printer) print(plan Plan) error {
+	enc := json.NewEncoder(p.W)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan)
+}
+
+// ReleaseClient forwards read-only calls to `inner` and prints the mutating
+// ones instead of performing them.
+func ReleaseClient(inner releasev1connect.ReleaseServiceClient, p *Printer) releasev1connect.ReleaseServiceClient {
+	return &releaseClient{ReleaseServiceClient: inner, p: p}
+}
+
+type releaseClient struct {
+	releasev1connect.ReleaseServiceClient
+	p *Printer
+}
+
+func (c *releaseClient) CreateReleaseChannel(ctx context.Context, req *connect.Request[releasepb.CreateReleaseChannelRequest]) (*connect.Response[releasepb.CreateReleaseChannelResponse], error) {
+	return connect.NewResponse(&releasepb.CreateReleaseChannelResponse{}), c.p.Proto(releasev1connect.ReleaseServiceCreateReleaseChannelProcedure, req.Msg)
+}
+
+func (c *releaseClient) PublishVersion(ctx context.Context, req *connect.Request[releasepb.PublishVersionRequest]) (*connect.Response[releasepb.PublishVersionResponse], error) {
+	return connect.NewResponse(&releasepb.PublishVersionResponse{}), c.p.Proto(releasev1connect.ReleaseServicePublishVersionProcedure, req.Msg)
+}
+
+func (c *releaseClient) UnpublishVersion(ctx context.Context, req *connect.Request[releasepb.UnpublishVersionRequest]) (*connect.Response[releasepb.UnpublishVersionResponse], error) {
+	return connect.NewResponse(&releasepb.UnpublishVersionResponse{}), c.p.Proto(releasev1connect.ReleaseServiceUnpublishVersionProcedure, req.Msg)
+}
+
+func (c *releaseClient) CreateVersionArtifact(ctx context.Context, req *connect.Request[releasepb.CreateVersionArtifactRequest]) (*connect.Response[releasepb.CreateVersionArtifactResponse], error) {
+	return connect.NewResponse(&releasepb.CreateVersionArtifactResponse{}), c.p.Proto(releasev1connect.ReleaseServiceCreateVersionArtifactProcedure, req.Msg)
+}
+
+func (c *releaseClient) DeleteVersionArtifact(ctx context.Context, req *connect.Request[releasepb.DeleteVersionArtifactRequest]) (*connect.Response[releasepb.DeleteVersionArtifactResponse], error) {
+	return connect.NewResponse(&releasepb.DeleteVersionArtifactResponse{}), c.p.Proto(releasev1connect.ReleaseServiceDeleteVersionArtifactProcedure, req.Msg)
+}
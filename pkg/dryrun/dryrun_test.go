@@ -0,0 +1,169 @@
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+// failingReleaseService fails the test when a mutating RPC reaches it.
+type failingReleaseService struct {
+	releasev1connect.ReleaseServiceClient
+	t     *testing.T
+	lists int
+}
+
+func (f *failingReleaseService) fail(procedure string) error {
+	f.t.Errorf("%s reached the inner client", procedure)
+	return errors.New("unexpected call")
+}
+
+func (f *failingReleaseService) CreateReleaseChannel(context.Context, *connect.Request[releasepb.CreateReleaseChannelRequest]) (*connect.Response[releasepb.CreateReleaseChannelResponse], error) {
+	return nil, f.fail(releasev1connect.ReleaseServiceCreateReleaseChannelProcedure)
+}
+
+func (f *failingReleaseService) PublishVersion(context.Context, *connect.Request[releasepb.PublishVersionRequest]) (*connect.Response[releasepb.PublishVersionResponse], error) {
+	return nil, f.fail(releasev1connect.ReleaseServicePublishVersionProcedure)
+}
+
+func (f *failingReleaseService) UnpublishVersion(context.Context, *connect.Request[releasepb.UnpublishVersionRequest]) (*connect.Response[releasepb.UnpublishVersionResponse], error) {
+	return nil, f.fail(releasev1connect.ReleaseServiceUnpublishVersionProcedure)
+}
+
+func (f *failingReleaseService) CreateVersionArtifact(context.Context, *connect.Request[releasepb.CreateVersionArtifactRequest]) (*connect.Response[releasepb.CreateVersionArtifactResponse], error) {
+	return nil, f.fail(releasev1connect.ReleaseServiceCreateVersionArtifactProcedure)
+}
+
+func (f *failingReleaseService) DeleteVersionArtifact(context.Context, *connect.Request[releasepb.DeleteVersionArtifactRequest]) (*connect.Response[releasepb.DeleteVersionArtifactResponse], error) {
+	return nil, f.fail(releasev1connect.ReleaseServiceDeleteVersionArtifactProcedure)
+}
+
+func (f *failingReleaseService) ListReleaseChannel(context.Context, *connect.Request[releasepb.ListReleaseChannelRequest]) (*connect.Response[releasepb.ListReleaseChannelResponse], error) {
+	f.lists++
+	return connect.NewResponse(new(releasepb.ListReleaseChannelResponse)), nil
+}
+
+func compact(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestReleaseClient(t *testing.T) {
+	inner := &failingReleaseService{t: t}
+	var out bytes.Buffer
+	client := ReleaseClient(inner, &Printer{W: &out, Target: "https://api.humanlog.io", Auth: "user token from keyring"})
+	ctx := context.Background()
+	version := &typesv1.Version{Major: 1, Minor: 2}
+	artifact := &typesv1.VersionArtifact{Url: "https://x/a.tar.gz", Sha256: "aa", OperatingSystem: "linux", Architecture: "amd64"}
+
+	calls := []struct {
+		procedure string
+		call      func() error
+		field     string
+	}{
+		{
+			procedure: releasev1connect.ReleaseServiceCreateReleaseChannelProcedure,
+			call: func() error {
+				_, err := client.CreateReleaseChannel(ctx, connect.NewRequest(&releasepb.CreateReleaseChannelRequest{ProjectName: "apictl", ChannelName: "beta", ChannelPriority: 2}))
+				return err
+			},
+			field: `"channelName":"beta"`,
+		},
+		{
+			procedure: releasev1connect.ReleaseServiceCreateVersionArtifactProcedure,
+			call: func() error {
+				_, err := client.CreateVersionArtifact(ctx, connect.NewRequest(&releasepb.CreateVersionArtifactRequest{ProjectName: "apictl", Version: version, Artifact: artifact}))
+				return err
+			},
+			field: `"url":"https://x/a.tar.gz"`,
+		},
+		{
+			procedure: releasev1connect.ReleaseServicePublishVersionProcedure,
+			call: func() error {
+				_, err := client.PublishVersion(ctx, connect.NewRequest(&releasepb.PublishVersionRequest{ProjectName: "apictl", ReleaseChannelName: "main", Version: version}))
+				return err
+			},
+			field: `"releaseChannelName":"main"`,
+		},
+		{
+			procedure: releasev1connect.ReleaseServiceUnpublishVersionProcedure,
+			call: func() error {
+				_, err := client.UnpublishVersion(ctx, connect.NewRequest(&releasepb.UnpublishVersionRequest{ProjectName: "apictl", ReleaseChannelName: "beta", Version: version}))
+				return err
+			},
+			field: `"releaseChannelName":"beta"`,
+		},
+		{
+			procedure: releasev1connect.ReleaseServiceDeleteVersionArtifactProcedure,
+			call: func() error {
+				_, err := client.DeleteVersionArtifact(ctx, connect.NewRequest(&releasepb.DeleteVersionArtifactRequest{ProjectName: "apictl", Version: version, Artifact: artifact}))
+				return err
+			},
+			field: `"sha256":"aa"`,
+		},
+	}
+	for _, c := range calls {
+		if err := c.call(); err != nil {
+			t.Errorf("%s: %v", c.procedure, err)
+		}
+	}
+
+	dec := json.NewDecoder(&out)
+	for _, c := range calls {
+		var plan Plan
+		if err := dec.Decode(&plan); err != nil {
+			t.Fatalf("decoding the plan of %s: %v", c.procedure, err)
+		}
+		if plan.Operation != c.procedure {
+			t.Errorf("got a plan for %s, want %s", plan.Operation, c.procedure)
+		}
+		if plan.Target != "https://api.humanlog.io" || plan.Auth != "user token from keyring" {
+			t.Errorf("%s: got target %q and auth %q", c.procedure, plan.Target, plan.Auth)
+		}
+		if req := compact(t, plan.Request); !strings.Contains(req, c.field) {
+			t.Errorf("%s: request %s doesn't contain %s", c.procedure, req, c.field)
+		}
+	}
+	if err := dec.Decode(new(Plan)); err != io.EOF {
+		t.Errorf("printed more plans than calls: %v", err)
+	}
+
+	// reads still reach the API, so that plans are computed against it
+	if _, err := client.ListReleaseChannel(ctx, connect.NewRequest(new(releasepb.ListReleaseChannelRequest))); err != nil || inner.lists != 1 {
+		t.Errorf("listing: %v, %d calls", err, inner.lists)
+	}
+	if out.Len() != 0 {
+		t.Errorf("printed a plan for a read: %s", out.String())
+	}
+}
+
+func TestPrinterJSON(t *testing.T) {
+	var out bytes.Buffer
+	p := &Printer{W: &out, Target: "s3://releases", Auth: "aws profile ci"}
+	if err := p.JSON("PutObject", map[string]string{"key": "a.tar.gz"}, "dist/a.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if plan.Target != "s3://releases" || plan.Auth != "aws profile ci" || plan.Operation != "PutObject" || plan.Body != "dist/a.tar.gz" || compact(t, plan.Request) != `{"key":"a.tar.gz"}` {
+		t.Errorf("got plan %+v", plan)
+	}
+	if err := p.JSON("PutObject", func() {}, ""); err == nil {
+		t.Error("encoded a function")
+	}
+}
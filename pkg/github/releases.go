@@ -0,0 +1,84 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const DefaultBaseURL = "https://api.github.com"
+
+// Client talks to the GitHub REST API, or to a GitHub Enterprise one.
+type Client struct {
+	// BaseURL is the root of the API, e.g. `https://api.github.com` or
+	// `https://github.example.com/api/v3`.
+	BaseURL string
+	// Token is sent as a bearer token if set.
+	Token string
+	HTTP  *http.Client
+}
+
+// TokenFromEnv returns $GITHUB_TOKEN, or $GH_TOKEN like the `gh` CLI does.
+func TokenFromEnv() string {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GH_TOKEN")
+}
+
+type Asset struct {
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+type Release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []Asset `json:"assets"`
+}
+
+// ReleaseByTag gets the release of a repository that has the given tag.
+func (c *Client) ReleaseByTag(ctx context.Context, owner, repo, tag string) (*Release, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s",
+		strings.TrimSuffix(c.BaseURL, "/"),
+		url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(tag),
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getting release %q of %s/%s: %w", tag, owner, repo, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return nil, fmt.Errorf("getting release %q of %s/%s: %s: %s", tag, owner, repo, res.Status, strings.TrimSpace(string(body)))
+	}
+	out := new(Release)
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("decoding release %q of %s/%s: %w", tag, owner, repo, err)
+	}
+	return out, nil
+}
+
+// Asset finds an asset of the release by name.
+func (r *Release) Asset(name string) (*Asset, bool) {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i], true
+		}
+	}
+	return nil, false
+}
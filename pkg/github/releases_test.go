@@ -0,0 +1,77 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReleaseByTag(t *testing.T) {
+	var (
+		gotPath, gotAuth string
+		status           = http.StatusOK
+		body             = `{"tag_name":"v1.0.0+build/1","assets":[{"name":"a.tar.gz","size":3,"browser_download_url":"https://github.com/o/r/releases/download/v1.0.0/a.tar.gz"},{"name":"b.zip","size":4,"browser_download_url":"https://github.com/o/r/releases/download/v1.0.0/b.zip"}]}`
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.EscapedPath(), r.Header.Get("Authorization")
+		if r.Header.Get("Accept") != "application/vnd.github+json" || r.Header.Get("X-GitHub-Api-Version") == "" {
+			http.Error(w, "bad headers", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "from-gh")
+	client := &Client{BaseURL: srv.URL + "/api/v3/", Token: TokenFromEnv(), HTTP: srv.Client()}
+	rel, err := client.ReleaseByTag(ctx, "humanlogio", "api ctl", "v1.0.0+build/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/api/v3/repos/humanlogio/api%20ctl/releases/tags/v1.0.0+build%2F1"; gotPath != want {
+		t.Errorf("requested %q, want %q", gotPath, want)
+	}
+	if gotAuth != "Bearer from-gh" {
+		t.Errorf("got authorization %q", gotAuth)
+	}
+	if rel.TagName != "v1.0.0+build/1" || len(rel.Assets) != 2 {
+		t.Errorf("got release %+v", rel)
+	}
+	if a, ok := rel.Asset("b.zip"); !ok || a.Size != 4 || a.BrowserDownloadURL != "https://github.com/o/r/releases/download/v1.0.0/b.zip" {
+		t.Errorf("got asset %+v, %v", a, ok)
+	}
+	if a, ok := rel.Asset("c.zip"); ok {
+		t.Errorf("found missing asset %+v", a)
+	}
+
+	// GITHUB_TOKEN wins, and anonymous requests send no authorization
+	t.Setenv("GITHUB_TOKEN", "from-actions")
+	if token := TokenFromEnv(); token != "from-actions" {
+		t.Errorf("got token %q", token)
+	}
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+	client.Token = TokenFromEnv()
+	if _, err := client.ReleaseByTag(ctx, "o", "r", "v1"); err != nil || gotAuth != "" {
+		t.Errorf("got authorization %q, %v", gotAuth, err)
+	}
+
+	status, body = http.StatusNotFound, `{"message":"Not Found","documentation_url":"https://docs.github.com/rest"}`+"\n"
+	_, err = client.ReleaseByTag(ctx, "o", "r", "v2")
+	if want := `getting release "v2" of o/r: 404 Not Found: {"message":"Not Found","documentation_url":"https://docs.github.com/rest"}`; err == nil || err.Error() != want {
+		t.Errorf("error %v, want %q", err, want)
+	}
+	status, body = http.StatusForbidden, strings.Repeat("x", 4<<10)
+	if _, err := client.ReleaseByTag(ctx, "o", "r", "v2"); err == nil || len(err.Error()) > 1<<11 {
+		t.Errorf("error body isn't truncated: %d bytes", len(err.Error()))
+	}
+	status, body = http.StatusOK, "{"
+	if _, err := client.ReleaseByTag(ctx, "o", "r", "v2"); err == nil || !strings.Contains(err.Error(), `decoding release "v2" of o/r`) {
+		t.Errorf("error %v, want a decoding error", err)
+	}
+}
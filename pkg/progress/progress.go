@@ -0,0 +1,296 @@
+// Package progress reports how transfers advance: as a live line on
+// terminals, or as periodic log lines otherwise.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Mode is how reporters show progress.
+type Mode string
+
+const (
+	// Auto draws on terminals and logs otherwise.
+	Auto Mode = "auto"
+	TTY  Mode = "tty"
+	Log  Mode = "log"
+	Off  Mode = "off"
+)
+
+// ParseMode validates a mode given on the command line.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case Auto, TTY, Log, Off:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid progress mode %q, want auto, tty, log or off", s)
+}
+
+var (
+	// DefaultMode is the mode of new reporters.
+	DefaultMode = Auto
+	// LogInterval is how often log lines are printed.
+	LogInterval  = 10 * time.Second
+	drawInterval = 200 * time.Millisecond
+
+	// mu guards the line drawn on the terminal, which log lines must erase
+	// and draw again.
+	mu   sync.Mutex
+	line string
+
+	// now and tick are the clock of reporters, replaced in tests.
+	now  = time.Now
+	tick = func(d time.Duration) (<-chan time.Time, func()) {
+		t := time.NewTicker(d)
+		return t.C, t.Stop
+	}
+)
+
+// Reporter counts the bytes of a transfer. A nil reporter does nothing, so
+// that callers don't need to check if progress is wanted.
+type Reporter struct {
+	name  string
+	mode  Mode
+	start time.Time
+	total atomic.Int64
+	done  atomic.Int64
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// New starts reporting a transfer of `total` bytes, or of an unknown size if
+// it's negative. It returns nil if progress is off.
+func New(name string, total int64) *Reporter {
+	mode := DefaultMode
+	if mode == Auto {
+		mode = Log
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			mode = TTY
+		}
+	}
+	if mode == Off {
+		return nil
+	}
+	r := &Reporter{
+		name:    name,
+		mode:    mode,
+		start:   now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	r.total.Store(total)
+	go r.run()
+	return r
+}
+
+func (r *Reporter) run() {
+	defer close(r.stopped)
+	interval := LogInterval
+	if r.mode == TTY {
+		interval = drawInterval
+	}
+	ticks, stop := tick(interval)
+	defer stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticks:
+			if r.mode == TTY {
+				draw(r.line())
+			} else {
+				r.logLine()
+			}
+		}
+	}
+}
+
+// Add counts bytes that were transferred. It's safe to call concurrently.
+func (r *Reporter) Add(n int64) {
+	if r != nil {
+		r.done.Add(n)
+	}
+}
+
+// Grow adds to the total, for transfers whose size is learnt as they go. An
+// unknown total becomes known.
+func (r *Reporter) Grow(n int64) {
+	if r == nil {
+		return
+	}
+	for {
+		old := r.total.Load()
+		if r.total.CompareAndSwap(old, max(old, 0)+n) {
+			return
+		}
+	}
+}
+
+// Done stops reporting and logs a summary.
+func (r *Reporter) Done() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		close(r.stop)
+		<-r.stopped
+		if r.mode == TTY {
+			draw("")
+		}
+		elapsed := now().Sub(r.start)
+		log.Printf("%s: %s in %s (%s/s)", r.name, FormatBytes(r.done.Load()), elapsed.Round(time.Millisecond), FormatBytes(int64(r.rate(elapsed))))
+	})
+}
+
+func (r *Reporter) rate(elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(r.done.Load()) / elapsed.Seconds()
+}
+
+// eta is -1 if it can't be told.
+func (r *Reporter) eta(rate float64) time.Duration {
+	total, done := r.total.Load(), r.done.Load()
+	if total <= 0 || rate <= 0 || done > total {
+		return -1
+	}
+	return time.Duration(float64(total-done) / rate * float64(time.Second)).Round(time.Second)
+}
+
+func (r *Reporter) line() string {
+	elapsed := now().Sub(r.start)
+	rate := r.rate(elapsed)
+	done, total := r.done.Load(), r.total.Load()
+	var sb strings.Builder
+	sb.WriteString(r.name)
+	sb.WriteString(" ")
+	sb.WriteString(FormatBytes(done))
+	if total > 0 {
+		fmt.Fprintf(&sb, " / %s (%.0f%%)", FormatBytes(total), 100*float64(done)/float64(total))
+	}
+	fmt.Fprintf(&sb, ", %s/s", FormatBytes(int64(rate)))
+	if eta := r.eta(rate); eta >= 0 {
+		fmt.Fprintf(&sb, ", ETA %s", eta)
+	}
+	return sb.String()
+}
+
+func (r *Reporter) logLine() {
+	elapsed := now().Sub(r.start)
+	rate := r.rate(elapsed)
+	done, total := r.done.Load(), r.total.Load()
+	percent, eta := "unknown", "unknown"
+	if total > 0 {
+		percent = fmt.Sprintf("%.1f", 100*float64(done)/float64(total))
+	}
+	if d := r.eta(rate); d >= 0 {
+		eta = d.String()
+	}
+	log.Printf("progress op=%q bytes=%d total=%d percent=%s bytes_per_sec=%.0f elapsed=%s eta=%s",
+		r.name, done, total, percent, rate, elapsed.Round(time.Second), eta)
+}
+
+// draw replaces the line drawn on the terminal.
+func draw(s string) {
+	mu.Lock()
+	defer mu.Unlock()
+	fmt.Fprint(os.Stderr, "\r\033[K"+s)
+	line = s
+}
+
+// LogWriter wraps the output of the log package so that log lines don't get
+// mixed with the line drawn on the terminal.
+func LogWriter(w io.Writer) io.Writer {
+	return &logWriter{w: w}
+}
+
+type logWriter struct{ w io.Writer }
+
+func (lw *logWriter) Write(p []byte) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if line == "" {
+		return lw.w.Write(p)
+	}
+	fmt.Fprint(lw.w, "\r\033[K")
+	n, err := lw.w.Write(p)
+	fmt.Fprint(lw.w, line)
+	return n, err
+}
+
+// Reader counts the bytes read from `rd`.
+func (r *Reporter) Reader(rd io.Reader) io.Reader {
+	if r == nil {
+		return rd
+	}
+	return &reader{r: r, rd: rd}
+}
+
+type reader struct {
+	r  *Reporter
+	rd io.Reader
+}
+
+func (cr *reader) Read(p []byte) (int, error) {
+	n, err := cr.rd.Read(p)
+	cr.r.Add(int64(n))
+	return n, err
+}
+
+// ReadSeeker counts the bytes read from `rs`, and uncounts them when it's
+// rewound, e.g. when a request is retried.
+func (r *Reporter) ReadSeeker(rs io.ReadSeeker) io.ReadSeeker {
+	if r == nil {
+		return rs
+	}
+	return &readSeeker{r: r, rs: rs}
+}
+
+type readSeeker struct {
+	r   *Reporter
+	rs  io.ReadSeeker
+	pos int64
+}
+
+func (cr *readSeeker) Read(p []byte) (int, error) {
+	n, err := cr.rs.Read(p)
+	cr.pos += int64(n)
+	cr.r.Add(int64(n))
+	return n, err
+}
+
+func (cr *readSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := cr.rs.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	cr.r.Add(pos - cr.pos)
+	cr.pos = pos
+	return pos, nil
+}
+
+// FormatBytes formats a size with binary units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
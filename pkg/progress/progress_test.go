@@ -0,0 +1,213 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a fake clock whose ticks are sent by the test.
+type clock struct {
+	mu    sync.Mutex
+	t     time.Time
+	ticks chan time.Time
+}
+
+func fakeClock(t *testing.T) *clock {
+	c := &clock{t: time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC), ticks: make(chan time.Time)}
+	oldNow, oldTick := now, tick
+	now = func() time.Time {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.t
+	}
+	tick = func(time.Duration) (<-chan time.Time, func()) { return c.ticks, func() {} }
+	t.Cleanup(func() { now, tick = oldNow, oldTick })
+	return c
+}
+
+// advance moves the clock forward and ticks.
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	t := c.t
+	c.mu.Unlock()
+	c.ticks <- t
+}
+
+// lineWriter sends each log line it's written.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- strings.TrimSuffix(string(p), "\n")
+	return len(p), nil
+}
+
+func captureLog(t *testing.T, w io.Writer) {
+	out, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(w)
+	log.SetFlags(0)
+	log.SetPrefix("")
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	})
+}
+
+func withMode(t *testing.T, m Mode) {
+	old := DefaultMode
+	DefaultMode = m
+	t.Cleanup(func() { DefaultMode = old })
+}
+
+func TestLogLines(t *testing.T) {
+	withMode(t, Log)
+	c := fakeClock(t)
+	lines := make(lineWriter, 1)
+	captureLog(t, lines)
+
+	r := New("uploading apictl.tar.gz", -1)
+	r.Add(250)
+	c.advance(10 * time.Second)
+	if got, want := <-lines, `progress op="uploading apictl.tar.gz" bytes=250 total=-1 percent=unknown bytes_per_sec=25 elapsed=10s eta=unknown`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	r.Grow(1000)
+	r.Add(250)
+	c.advance(10 * time.Second)
+	if got, want := <-lines, `progress op="uploading apictl.tar.gz" bytes=500 total=1000 percent=50.0 bytes_per_sec=25 elapsed=20s eta=20s`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	// more than the total was sent, e.g. a retried part
+	r.Add(600)
+	c.advance(20 * time.Second)
+	if got, want := <-lines, `progress op="uploading apictl.tar.gz" bytes=1100 total=1000 percent=110.0 bytes_per_sec=28 elapsed=40s eta=unknown`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	r.Done()
+	if got, want := <-lines, "uploading apictl.tar.gz: 1.1 KiB in 40s (27 B/s)"; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	r.Done()
+	select {
+	case line := <-lines:
+		t.Errorf("logged %q after being done", line)
+	default:
+	}
+}
+
+func TestLine(t *testing.T) {
+	c := fakeClock(t)
+	r := &Reporter{name: "mirroring 3 files", start: now()}
+	r.total.Store(4 << 20)
+	r.done.Store(1 << 20)
+	c.mu.Lock()
+	c.t = c.t.Add(2 * time.Second)
+	c.mu.Unlock()
+	if got, want := r.line(), "mirroring 3 files 1.0 MiB / 4.0 MiB (25%), 512.0 KiB/s, ETA 6s"; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	r.total.Store(-1)
+	if got, want := r.line(), "mirroring 3 files 1.0 MiB, 512.0 KiB/s"; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// TestConcurrentReaders is meant to run with -race: parts of a file are read
+// at once, rewound on retries, while the total grows and lines are logged.
+func TestConcurrentReaders(t *testing.T) {
+	withMode(t, Log)
+	c := fakeClock(t)
+	captureLog(t, io.Discard)
+
+	const (
+		readers = 8
+		size    = 64 << 10
+	)
+	r := New("uploading parts", -1)
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Grow(size)
+			rs := r.ReadSeeker(bytes.NewReader(make([]byte, size)))
+			if _, err := io.CopyN(io.Discard, rs, size/2); err != nil {
+				t.Error(err)
+			}
+			// a failed attempt, retried from the start
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				t.Error(err)
+			}
+			if _, err := io.Copy(io.Discard, rs); err != nil {
+				t.Error(err)
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := io.Copy(io.Discard, r.Reader(bytes.NewReader(make([]byte, size)))); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for ticking := true; ticking; {
+		select {
+		case <-done:
+			ticking = false
+		default:
+			c.advance(time.Second)
+		}
+	}
+	r.Done()
+	if got, want := r.done.Load(), int64(2*readers*size); got != want {
+		t.Errorf("counted %d bytes, want %d", got, want)
+	}
+	if got, want := r.total.Load(), int64(readers*size); got != want {
+		t.Errorf("total is %d, want %d", got, want)
+	}
+}
+
+func TestNilReporter(t *testing.T) {
+	withMode(t, Off)
+	r := New("uploading", 10)
+	if r != nil {
+		t.Fatalf("got a reporter with progress off")
+	}
+	r.Add(1)
+	r.Grow(1)
+	r.Done()
+	rd := strings.NewReader("x")
+	if r.Reader(rd) != io.Reader(rd) || r.ReadSeeker(rd) != io.ReadSeeker(rd) {
+		t.Error("a nil reporter wrapped a reader")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
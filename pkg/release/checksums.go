@@ -0,0 +1,72 @@
+package release
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const artifactTypeChecksum = "Checksum"
+
+// Checksums maps file names to their hex encoded sha256.
+type Checksums map[string]string
+
+// ParseChecksums reads a checksums file in the format of `sha256sum`, which is
+// what goreleaser writes.
+func ParseChecksums(r io.Reader) (Checksums, error) {
+	out := make(Checksums)
+	sc := bufio.NewScanner(r)
+	for lineno := 1; sc.Scan(); lineno++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected `<sha256>  <filename>`", lineno)
+		}
+		// `sha256sum --binary` prefixes names with a `*`
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		if raw, err := hex.DecodeString(sum); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("line %d: %q isn't a sha256", lineno, sum)
+		}
+		sum = strings.ToLower(sum)
+		if prev, ok := out[name]; ok && prev != sum {
+			return nil, fmt.Errorf("line %d: %q is listed twice with different checksums", lineno, name)
+		}
+		out[name] = sum
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadChecksums reads the checksums file at `path`.
+func LoadChecksums(path string) (Checksums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out, err := ParseChecksums(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", path, err)
+	}
+	return out, nil
+}
+
+// ChecksumsPath is where the checksums file goreleaser produced can be found,
+// if there is one.
+func (d *Dist) ChecksumsPath() (string, bool) {
+	for _, a := range d.Artifacts {
+		if a.Type == artifactTypeChecksum {
+			return d.LocalPath(a), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,88 @@
+package release
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	const (
+		a = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+		b = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	)
+	tests := []struct {
+		name    string
+		in      string
+		want    Checksums
+		wantErr string
+	}{
+		{
+			name: "sha256sum",
+			in:   a + "  apictl_linux_amd64.tar.gz\n" + b + "  apictl_darwin_arm64.tar.gz\n",
+			want: Checksums{"apictl_linux_amd64.tar.gz": a, "apictl_darwin_arm64.tar.gz": b},
+		},
+		{
+			name: "binary mode",
+			in:   a + " *apictl_linux_amd64.tar.gz\n",
+			want: Checksums{"apictl_linux_amd64.tar.gz": a},
+		},
+		{
+			name: "blank lines and single space",
+			in:   "\n" + a + " apictl_linux_amd64.tar.gz\n\n",
+			want: Checksums{"apictl_linux_amd64.tar.gz": a},
+		},
+		{
+			name: "upper case",
+			in:   strings.ToUpper(a) + "  apictl_linux_amd64.tar.gz\n",
+			want: Checksums{"apictl_linux_amd64.tar.gz": a},
+		},
+		{
+			name: "same file listed twice",
+			in:   a + "  apictl_linux_amd64.tar.gz\n" + strings.ToUpper(a) + " *apictl_linux_amd64.tar.gz\n",
+			want: Checksums{"apictl_linux_amd64.tar.gz": a},
+		},
+		{
+			name:    "file listed with different checksums",
+			in:      a + "  apictl_linux_amd64.tar.gz\n" + b + "  apictl_linux_amd64.tar.gz\n",
+			wantErr: `line 2: "apictl_linux_amd64.tar.gz" is listed twice with different checksums`,
+		},
+		{
+			name:    "no file name",
+			in:      a + "\n",
+			wantErr: "line 1: expected `<sha256>  <filename>`",
+		},
+		{
+			name:    "bad hex",
+			in:      a + "  a.tar.gz\n" + strings.Repeat("z", 64) + "  b.tar.gz\n",
+			wantErr: `line 2: "` + strings.Repeat("z", 64) + `" isn't a sha256`,
+		},
+		{
+			name:    "not a sha256",
+			in:      "d41d8cd98f00b204e9800998ecf8427e  a.tar.gz\n",
+			wantErr: `line 1: "d41d8cd98f00b204e9800998ecf8427e" isn't a sha256`,
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: Checksums{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseChecksums(strings.NewReader(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+const (
+	artifactTypeArchive = "Archive"
+	// NoSignature is what gets registered for archives that have no `.sig` file
+	// alongside them.
+	NoSignature = "no-signature"
+)
+
+// Metadata is the content of goreleaser's `dist/metadata.json`.
+type Metadata struct {
+	ProjectName string `json:"project_name"`
+	Tag         string `json:"tag"`
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`
+}
+
+// Artifact is an entry of goreleaser's `dist/artifacts.json`.
+type Artifact struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Goos   string `json:"goos"`
+	Goarch string `json:"goarch"`
+	Type   string `json:"type"`
+}
+
+// VersionInfo is the content of `dist-extra/version.json`, as written by
+// `script/write_version_info.sh`.
+type VersionInfo struct {
+	Version        string `json:"version"`
+	Major          string `json:"major"`
+	Minor          string `json:"minor"`
+	Patch          string `json:"patch"`
+	Pre            string `json:"pre"`
+	Build          string `json:"build"`
+	ArchiveBaseURL string `json:"archive_base_url"`
+}
+
+// NewVersionInfo describes `v` the way `script/write_version_info.sh` does.
+func NewVersionInfo(v *typesv1.Version, archiveBaseURL string) *VersionInfo {
+	return &VersionInfo{
+		Version:        versions.String(v),
+		Major:          strconv.Itoa(int(v.Major)),
+		Minor:          strconv.Itoa(int(v.Minor)),
+		Patch:          strconv.Itoa(int(v.Patch)),
+		Pre:            strings.Join(v.Prereleases, "."),
+		Build:          v.Build,
+		ArchiveBaseURL: archiveBaseURL,
+	}
+}
+
+// WriteVersionInfo writes `version.json` in `extraDir`, creating it if
+// needed.
+func WriteVersionInfo(extraDir string, vi *VersionInfo) error {
+	if err := os.MkdirAll(extraDir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(vi)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(extraDir, "version.json"), append(data, '\n'), 0o644)
+}
+
+// Dist is what a goreleaser run left on disk.
+type Dist struct {
+	// Root is the directory the artifact paths are relative to.
+	Root        string
+	Metadata    Metadata
+	Artifacts   []Artifact
+	VersionInfo *VersionInfo
+}
+
+// LoadDist reads the goreleaser output found in `distDir`, along with the
+// optional `version.json` found in `extraDir`.
+func LoadDist(distDir, extraDir string) (*Dist, error) {
+	out := &Dist{Root: filepath.Dir(filepath.Clean(distDir))}
+	if err := readJSON(filepath.Join(distDir, "metadata.json"), &out.Metadata); err != nil {
+		return nil, err
+	}
+	if err := readJSON(filepath.Join(distDir, "artifacts.json"), &out.Artifacts); err != nil {
+		return nil, err
+	}
+	if extraDir != "" {
+		vi := new(VersionInfo)
+		err := readJSON(filepath.Join(extraDir, "version.json"), vi)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			out.VersionInfo = vi
+		}
+	}
+	return out, nil
+}
+
+// Version is the version being released. With `version.json`, it's made of
+// the major, minor, patch, pre and build fields that artifacts were always
+// registered with, and its `version` field must agree. Otherwise it's the
+// version of goreleaser's metadata.
+func (d *Dist) Version() (*typesv1.Version, error) {
+	if d.VersionInfo == nil {
+		v, err := versions.Parse(d.Metadata.Version)
+		if err != nil {
+			return nil, fmt.Errorf("parsing version %q of goreleaser metadata: %w", d.Metadata.Version, err)
+		}
+		return v, nil
+	}
+	return d.VersionInfo.Fields()
+}
+
+// Fields returns the version made of the major, minor, patch, pre and build
+// fields, and fails if the `version` field is set to another version.
+func (vi *VersionInfo) Fields() (*typesv1.Version, error) {
+	out := &typesv1.Version{Build: vi.Build}
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *int32
+	}{
+		{"major", vi.Major, &out.Major},
+		{"minor", vi.Minor, &out.Minor},
+		{"patch", vi.Patch, &out.Patch},
+	} {
+		n, err := strconv.ParseInt(field.value, 10, 32)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s %q in version.json", field.name, field.value)
+		}
+		*field.dst = int32(n)
+	}
+	if vi.Pre != "" {
+		out.Prereleases = strings.Split(vi.Pre, ".")
+	}
+	if _, err := out.AsSemver(); err != nil {
+		return nil, fmt.Errorf("invalid version in version.json: %w", err)
+	}
+	// write_version_info.sh always writes a `-` and a `+`, even when pre or
+	// build are empty
+	scriptVersion := fmt.Sprintf("%s.%s.%s-%s+%s", vi.Major, vi.Minor, vi.Patch, vi.Pre, vi.Build)
+	if vi.Version != "" && vi.Version != versions.String(out) && vi.Version != scriptVersion {
+		return nil, fmt.Errorf("version.json has version %q, but its major, minor, patch, pre and build fields make %q", vi.Version, versions.String(out))
+	}
+	return out, nil
+}
+
+// Archives lists the artifacts of type `Archive`.
+func (d *Dist) Archives() []Artifact {
+	var out []Artifact
+	for _, a := range d.Artifacts {
+		if a.Type == artifactTypeArchive {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// LocalPath is where the artifact can be found on disk.
+func (d *Dist) LocalPath(a Artifact) string {
+	if filepath.IsAbs(a.Path) {
+		return a.Path
+	}
+	return filepath.Join(d.Root, a.Path)
+}
+
+// Signature returns the content of the `.sig` file next to the artifact, or
+// NoSignature if there is none.
+func (d *Dist) Signature(a Artifact) (string, error) {
+	return ReadSignature(d.LocalPath(a))
+}
+
+// ReadSignature returns the content of the `.sig` file next to `path`, or
+// NoSignature if there is none.
+func ReadSignature(path string) (string, error) {
+	sig, err := os.ReadFile(path + ".sig")
+	if errors.Is(err, fs.ErrNotExist) {
+		return NoSignature, nil
+	} else if err != nil {
+		return "", fmt.Errorf("reading signature of %q: %w", filepath.Base(path), err)
+	}
+	return strings.TrimSpace(string(sig)), nil
+}
+
+// FileSHA256 returns the hex encoded sha256 of the file at `path`.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %q: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readJSON(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("decoding %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package release
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/github"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+const (
+	linuxArchive  = "apictl_0.3.0-rc.1_linux_amd64.tar.gz"
+	darwinArchive = "apictl_0.3.0-rc.1_darwin_arm64.tar.gz"
+	linuxSHA256   = "4ec26f57d9b9ed0176789b3a916c83f8d273c7ecae0e0ed19c24e04bad88d421"
+	darwinSHA256  = "c24f20f53d1e16c7c7a41c0c40b4cec365b65065278eec63dd067ef1180414cb"
+)
+
+func mustVersion(t *testing.T, s string) *typesv1.Version {
+	t.Helper()
+	v, err := versions.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func loadTestDist(t *testing.T, extraDir string) *Dist {
+	t.Helper()
+	dist, err := LoadDist(filepath.Join("testdata", "dist"), extraDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dist
+}
+
+func TestLoadDist(t *testing.T) {
+	dist := loadTestDist(t, filepath.Join("testdata", "dist-extra"))
+	if dist.Root != "testdata" {
+		t.Errorf("root is %q, want testdata", dist.Root)
+	}
+	if dist.Metadata.ProjectName != "apictl" || dist.Metadata.Tag != "v0.3.0-rc.1" {
+		t.Errorf("got metadata %+v", dist.Metadata)
+	}
+	if len(dist.Artifacts) != 4 {
+		t.Errorf("got %d artifacts, want 4", len(dist.Artifacts))
+	}
+	archives := dist.Archives()
+	if len(archives) != 2 || archives[0].Name != linuxArchive || archives[1].Name != darwinArchive {
+		t.Fatalf("got archives %+v", archives)
+	}
+	if got, want := dist.LocalPath(archives[0]), filepath.Join("testdata", "dist", linuxArchive); got != want {
+		t.Errorf("local path %q, want %q", got, want)
+	}
+	if sig, err := dist.Signature(archives[0]); err != nil || !strings.HasPrefix(sig, "untrusted comment:") || strings.HasSuffix(sig, "\n") {
+		t.Errorf("got signature %q, %v", sig, err)
+	}
+	if sig, err := dist.Signature(archives[1]); err != nil || sig != NoSignature {
+		t.Errorf("got signature %q, %v, want %q", sig, err, NoSignature)
+	}
+	if dist.VersionInfo == nil || !strings.HasSuffix(dist.VersionInfo.ArchiveBaseURL, "/apictl-binaries/0.3.0-rc.1") {
+		t.Errorf("got version info %+v", dist.VersionInfo)
+	}
+
+	// version.json is optional
+	if dist := loadTestDist(t, t.TempDir()); dist.VersionInfo != nil {
+		t.Errorf("got version info %+v without version.json", dist.VersionInfo)
+	}
+	if _, err := LoadDist(t.TempDir(), ""); err == nil {
+		t.Error("loaded a dist without metadata.json")
+	}
+}
+
+func TestDistVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    *VersionInfo
+		want    string
+		wantErr string
+	}{
+		{
+			name: "from goreleaser metadata",
+			want: "0.3.0-rc.1",
+		},
+		{
+			name: "as written by the script",
+			info: &VersionInfo{Version: "0.3.0-rc.1+", Major: "0", Minor: "3", Patch: "0", Pre: "rc.1"},
+			want: "0.3.0-rc.1",
+		},
+		{
+			name: "release as written by the script",
+			info: &VersionInfo{Version: "1.2.3-+", Major: "1", Minor: "2", Patch: "3"},
+			want: "1.2.3",
+		},
+		{
+			name: "written by release version-info",
+			info: NewVersionInfo(mustVersion(t, "1.2.3-rc.1.next+abc"), ""),
+			want: "1.2.3-rc.1.next+abc",
+		},
+		{
+			name: "fields win over metadata",
+			info: &VersionInfo{Major: "0", Minor: "3", Patch: "0", Pre: "rc.1", Build: "abc"},
+			want: "0.3.0-rc.1+abc",
+		},
+		{
+			name:    "version field disagrees",
+			info:    &VersionInfo{Version: "0.3.0", Major: "0", Minor: "3", Patch: "0", Pre: "rc.1"},
+			wantErr: `version.json has version "0.3.0", but its major, minor, patch, pre and build fields make "0.3.0-rc.1"`,
+		},
+		{
+			name:    "invalid field",
+			info:    &VersionInfo{Major: "0", Minor: "three", Patch: "0"},
+			wantErr: `invalid minor "three"`,
+		},
+		{
+			name:    "negative field",
+			info:    &VersionInfo{Major: "-1", Minor: "0", Patch: "0"},
+			wantErr: `invalid major "-1"`,
+		},
+		{
+			name:    "invalid prerelease",
+			info:    &VersionInfo{Major: "1", Minor: "0", Patch: "0", Pre: "rc..1"},
+			wantErr: "invalid version in version.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dist := loadTestDist(t, "")
+			dist.VersionInfo = tt.info
+			v, err := dist.Version()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions.String(v); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultURLFor(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path != "/repos/humanlogio/apictl/releases/tags/v0.3.0-rc.1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"tag_name":"v0.3.0-rc.1","assets":[{"name":"` + linuxArchive + `","browser_download_url":"https://github.com/humanlogio/apictl/releases/download/v0.3.0-rc.1/` + linuxArchive + `"}]}`))
+	}))
+	defer srv.Close()
+	gh := &github.Client{BaseURL: srv.URL, HTTP: srv.Client()}
+	ctx := context.Background()
+
+	withBaseURL := loadTestDist(t, filepath.Join("testdata", "dist-extra"))
+	urlFor := DefaultURLFor(withBaseURL, gh, "humanlogio")
+	got, err := urlFor(ctx, withBaseURL.Archives()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://humanlog-binaries.sfo3.cdn.digitaloceanspaces.com/apictl-binaries/0.3.0-rc.1/" + linuxArchive; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(requests) != 0 {
+		t.Errorf("looked up the GitHub release despite archive_base_url: %q", requests)
+	}
+
+	dist := loadTestDist(t, "")
+	urlFor = DefaultURLFor(dist, gh, "humanlogio")
+	got, err = urlFor(ctx, dist.Archives()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://github.com/humanlogio/apictl/releases/download/v0.3.0-rc.1/" + linuxArchive; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := urlFor(ctx, dist.Archives()[1]); err == nil || !strings.Contains(err.Error(), `release "v0.3.0-rc.1" has no asset named "`+darwinArchive+`"`) {
+		t.Errorf("error %v, want a missing asset", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("got %d requests, want the release looked up once", len(requests))
+	}
+
+	// without a tag, the release is looked up by version
+	dist.Metadata.Tag = ""
+	dist.Metadata.Version = "0.3.0"
+	if _, err := DefaultURLFor(dist, gh, "humanlogio")(ctx, dist.Archives()[0]); err == nil || requests[len(requests)-1] != "/repos/humanlogio/apictl/releases/tags/v0.3.0" {
+		t.Errorf("error %v, requests %q", err, requests)
+	}
+}
+
+// publishingReleaseService records the artifacts it registers and the
+// versions it publishes.
+type publishingReleaseService struct {
+	releasev1connect.ReleaseServiceClient
+	created   []string
+	published []string
+}
+
+func (f *publishingReleaseService) CreateVersionArtifact(ctx context.Context, req *connect.Request[releasepb.CreateVersionArtifactRequest]) (*connect.Response[releasepb.CreateVersionArtifactResponse], error) {
+	f.created = append(f.created, req.Msg.Artifact.Url)
+	return connect.NewResponse(new(releasepb.CreateVersionArtifactResponse)), nil
+}
+
+func (f *publishingReleaseService) PublishVersion(ctx context.Context, req *connect.Request[releasepb.PublishVersionRequest]) (*connect.Response[releasepb.PublishVersionResponse], error) {
+	f.published = append(f.published, versions.String(req.Msg.Version)+" on "+req.Msg.ReleaseChannelName)
+	return connect.NewResponse(new(releasepb.PublishVersionResponse)), nil
+}
+
+func TestPublish(t *testing.T) {
+	dist := loadTestDist(t, filepath.Join("testdata", "dist-extra"))
+	newPublisher := func(rc releasev1connect.ReleaseServiceClient, checksums Checksums) *Publisher {
+		return &Publisher{
+			Client:  rc,
+			Project: "apictl",
+			Channel: "main",
+			URLFor: func(_ context.Context, a Artifact) (string, error) {
+				return "https://x/" + a.Name, nil
+			},
+			Checksums: checksums,
+		}
+	}
+
+	rc := new(publishingReleaseService)
+	results, err := newPublisher(rc, Checksums{linuxArchive: linuxSHA256, darwinArchive: darwinSHA256}).Publish(context.Background(), dist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Artifact.Sha256 != linuxSHA256 || results[1].Artifact.Sha256 != darwinSHA256 {
+		t.Fatalf("got results %+v", results)
+	}
+	if a := results[0].Artifact; a.OperatingSystem != "linux" || a.Architecture != "amd64" || !strings.HasPrefix(a.Signature, "untrusted comment:") {
+		t.Errorf("got artifact %v", a)
+	}
+	if results[1].Artifact.Signature != NoSignature {
+		t.Errorf("got signature %q, want %q", results[1].Artifact.Signature, NoSignature)
+	}
+	if len(rc.created) != 2 || len(rc.published) != 1 || rc.published[0] != "0.3.0-rc.1 on main" {
+		t.Errorf("created %q, published %q", rc.created, rc.published)
+	}
+
+	rc = new(publishingReleaseService)
+	results, err = newPublisher(rc, Checksums{linuxArchive: linuxSHA256, darwinArchive: strings.Repeat("0", 64)}).Publish(context.Background(), dist)
+	if err == nil || err.Error() != "1/2 archives failed to register, not publishing" {
+		t.Fatalf("error %v, want a failed archive", err)
+	}
+	if len(results) != 2 || results[0].Err != nil || results[1].Err == nil || !strings.Contains(results[1].Error, "checksum mismatch: checksums file has 0000") {
+		t.Errorf("got results %+v", results)
+	}
+	// the other archives are still registered, but the version isn't
+	// published
+	if len(rc.created) != 1 || len(rc.published) != 0 {
+		t.Errorf("created %q, published %q", rc.created, rc.published)
+	}
+
+	rc = new(publishingReleaseService)
+	results, err = newPublisher(rc, Checksums{linuxArchive: linuxSHA256}).Publish(context.Background(), dist)
+	if err == nil || len(results) != 2 || results[1].Error != "not listed in the checksums file" {
+		t.Errorf("error %v, results %+v, want an unlisted archive", err, results)
+	}
+}
@@ -0,0 +1,158 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/humanlogio/api/go/svc/cliupdate/v1/cliupdatev1connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/versions"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// IsAlreadyExists tells if the API refused to create something because it
+// already exists.
+func IsAlreadyExists(err error) bool {
+	connectErr := new(connect.Error)
+	return errors.As(err, &connectErr) && connectErr.Code() == connect.CodeAlreadyExists
+}
+
+// FieldDiff is a field that differs between an existing object and the one
+// that was meant to be created.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Have  string `json:"have"`
+	Want  string `json:"want"`
+}
+
+// ConflictError tells that an object already exists with different fields.
+type ConflictError struct {
+	What  string
+	Diffs []FieldDiff
+}
+
+func (e *ConflictError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s already exists and differs:", e.What)
+	for _, d := range e.Diffs {
+		fmt.Fprintf(&sb, "\n  %s:\n    - %s\n    + %s", d.Field, d.Have, d.Want)
+	}
+	return sb.String()
+}
+
+// CompareFields lists the fields of `want` whose value differs in `have`.
+func CompareFields(have, want proto.Message) []FieldDiff {
+	var (
+		h     = have.ProtoReflect()
+		w     = want.ProtoReflect()
+		diffs []FieldDiff
+	)
+	fields := w.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		hv, wv := h.Get(fd), w.Get(fd)
+		if hv.Equal(wv) {
+			continue
+		}
+		diffs = append(diffs, FieldDiff{
+			Field: string(fd.Name()),
+			Have:  formatValue(fd, hv),
+			Want:  formatValue(fd, wv),
+		})
+	}
+	return diffs
+}
+
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+		return fmt.Sprintf("%q", v.String())
+	}
+	return v.String()
+}
+
+// CheckExistingReleaseChannel reads back the channel a create request
+// conflicted with, and returns a ConflictError if it isn't identical.
+func CheckExistingReleaseChannel(ctx context.Context, client releasev1connect.ReleaseServiceClient, req *releasepb.CreateReleaseChannelRequest) error {
+	channels, err := ListAllReleaseChannels(ctx, client, req.ProjectName)
+	if err != nil {
+		return err
+	}
+	want := &typesv1.ReleaseChannel{Name: req.ChannelName, Priority: req.ChannelPriority}
+	for _, have := range channels {
+		if have.Name != want.Name {
+			continue
+		}
+		if diffs := CompareFields(have, want); len(diffs) > 0 {
+			return &ConflictError{What: fmt.Sprintf("release-channel %q", want.Name), Diffs: diffs}
+		}
+		return nil
+	}
+	return fmt.Errorf("release-channel %q is said to exist, but isn't listed", want.Name)
+}
+
+// CheckExistingVersionArtifact reads back the artifact a create request
+// conflicted with, and returns a ConflictError if it isn't identical. An
+// artifact is identified by its version and platform.
+func CheckExistingVersionArtifact(ctx context.Context, client releasev1connect.ReleaseServiceClient, req *releasepb.CreateVersionArtifactRequest) error {
+	items, err := ListAllVersionArtifacts(ctx, client, req.ProjectName)
+	if err != nil {
+		return err
+	}
+	var (
+		vs   = versions.String(req.Version)
+		want = req.Artifact
+	)
+	for _, have := range FindVersion(items, req.Version).GetArtifacts() {
+		if PlatformOf(have) != PlatformOf(want) {
+			continue
+		}
+		if diffs := CompareFields(have, want); len(diffs) > 0 {
+			return &ConflictError{What: fmt.Sprintf("version-artifact %s %s", vs, PlatformOf(want)), Diffs: diffs}
+		}
+		return nil
+	}
+	return fmt.Errorf("version-artifact %s %s is said to exist, but isn't listed", vs, PlatformOf(want))
+}
+
+// CheckExistingPublication reads back the publication a publish request
+// conflicted with. The API can't list publications, so it's observed through
+// the head of the channel on each platform the version has artifacts for, and
+// a ConflictError lists the platforms where the channel serves something
+// else.
+func CheckExistingPublication(ctx context.Context, rc releasev1connect.ReleaseServiceClient, uc cliupdatev1connect.UpdateServiceClient, req *releasepb.PublishVersionRequest) error {
+	items, err := ListAllVersionArtifacts(ctx, rc, req.ProjectName)
+	if err != nil {
+		return err
+	}
+	vs := versions.String(req.Version)
+	item := FindVersion(items, req.Version)
+	if item == nil || len(item.Artifacts) == 0 {
+		return fmt.Errorf("published-version %s on %q is said to exist, but the version has no artifacts", vs, req.ReleaseChannelName)
+	}
+	var diffs []FieldDiff
+	for _, a := range item.Artifacts {
+		p := PlatformOf(a)
+		head, _, err := ChannelHead(ctx, uc, req.ProjectName, req.ReleaseChannelName, p.OS, p.Arch)
+		if err != nil {
+			return err
+		}
+		if SameVersion(head, req.Version) {
+			continue
+		}
+		have := "nothing"
+		if head != nil {
+			have = versions.String(head)
+		}
+		diffs = append(diffs, FieldDiff{Field: "head for " + p.String(), Have: have, Want: vs})
+	}
+	if len(diffs) > 0 {
+		return &ConflictError{What: fmt.Sprintf("published-version %s on %q", vs, req.ReleaseChannelName), Diffs: diffs}
+	}
+	return nil
+}
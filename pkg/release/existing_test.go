@@ -0,0 +1,254 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCompareFields(t *testing.T) {
+	artifact := &typesv1.VersionArtifact{
+		Url:             "https://x/a.tar.gz",
+		Sha256:          "aa",
+		Signature:       "sig",
+		Architecture:    "amd64",
+		OperatingSystem: "linux",
+	}
+	with := func(f func(a *typesv1.VersionArtifact)) *typesv1.VersionArtifact {
+		out := proto.Clone(artifact).(*typesv1.VersionArtifact)
+		f(out)
+		return out
+	}
+	tests := []struct {
+		name string
+		have proto.Message
+		want proto.Message
+		diff []FieldDiff
+	}{
+		{
+			name: "identical",
+			have: artifact,
+			want: with(func(a *typesv1.VersionArtifact) {}),
+		},
+		{
+			name: "strings are quoted",
+			have: artifact,
+			want: with(func(a *typesv1.VersionArtifact) { a.Sha256 = "bb"; a.Signature = "" }),
+			diff: []FieldDiff{
+				{Field: "sha256", Have: `"aa"`, Want: `"bb"`},
+				{Field: "signature", Have: `"sig"`, Want: `""`},
+			},
+		},
+		{
+			name: "in field order",
+			have: artifact,
+			want: with(func(a *typesv1.VersionArtifact) { a.OperatingSystem = "darwin"; a.Url = "https://x/b.tar.gz" }),
+			diff: []FieldDiff{
+				{Field: "url", Have: `"https://x/a.tar.gz"`, Want: `"https://x/b.tar.gz"`},
+				{Field: "operating_system", Have: `"linux"`, Want: `"darwin"`},
+			},
+		},
+		{
+			name: "numbers",
+			have: &typesv1.ReleaseChannel{Name: "main", Priority: 1},
+			want: &typesv1.ReleaseChannel{Name: "main", Priority: 2},
+			diff: []FieldDiff{{Field: "priority", Have: "1", Want: "2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareFields(tt.have, tt.want)
+			if !slices.Equal(got, tt.diff) {
+				t.Errorf("got %+v, want %+v", got, tt.diff)
+			}
+		})
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	err := &ConflictError{What: `release-channel "main"`, Diffs: []FieldDiff{
+		{Field: "priority", Have: "1", Want: "2"},
+		{Field: "name", Have: `"a"`, Want: `"b"`},
+	}}
+	want := `release-channel "main" already exists and differs:
+  priority:
+    - 1
+    + 2
+  name:
+    - "a"
+    + "b"`
+	if err.Error() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", err.Error(), want)
+	}
+}
+
+func TestIsAlreadyExists(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: connect.NewError(connect.CodeAlreadyExists, errors.New("exists")), want: true},
+		{err: fmt.Errorf("creating: %w", connect.NewError(connect.CodeAlreadyExists, errors.New("exists"))), want: true},
+		{err: connect.NewError(connect.CodeInvalidArgument, errors.New("invalid"))},
+		{err: errors.New("exists")},
+		{err: nil},
+	}
+	for _, tt := range tests {
+		if got := IsAlreadyExists(tt.err); got != tt.want {
+			t.Errorf("IsAlreadyExists(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCheckExistingReleaseChannel(t *testing.T) {
+	client := &fakeReleaseService{channels: []*typesv1.ReleaseChannel{
+		{Name: "main", Priority: 1},
+		{Name: "beta", Priority: 2},
+	}}
+	tests := []struct {
+		name     string
+		priority int32
+		wantErr  string
+		conflict bool
+	}{
+		{name: "beta", priority: 2},
+		{name: "beta", priority: 3, conflict: true, wantErr: "release-channel \"beta\" already exists and differs:\n  priority:\n    - 2\n    + 3"},
+		{name: "alpha", priority: 3, wantErr: `release-channel "alpha" is said to exist, but isn't listed`},
+	}
+	for _, tt := range tests {
+		err := CheckExistingReleaseChannel(context.Background(), client, &releasepb.CreateReleaseChannelRequest{
+			ProjectName:     "apictl",
+			ChannelName:     tt.name,
+			ChannelPriority: tt.priority,
+		})
+		checkErr(t, err, tt.wantErr)
+		if conflict := new(ConflictError); errors.As(err, &conflict) != tt.conflict {
+			t.Errorf("%v: ConflictError is %v, want %v", err, !tt.conflict, tt.conflict)
+		}
+	}
+}
+
+func TestCheckExistingVersionArtifact(t *testing.T) {
+	linux := &typesv1.VersionArtifact{Url: "https://x/1.0.0/linux.tar.gz", Sha256: "aa", Architecture: "amd64", OperatingSystem: "linux"}
+	client := &fakeReleaseService{versions: []*releasepb.ListVersionArtifactResponse_ListItem{
+		{Version: &typesv1.Version{Major: 0, Minor: 9}},
+		{Version: &typesv1.Version{Major: 1}, Artifacts: []*typesv1.VersionArtifact{linux}},
+	}}
+	tests := []struct {
+		name     string
+		version  *typesv1.Version
+		artifact *typesv1.VersionArtifact
+		wantErr  string
+	}{
+		{
+			name:     "identical",
+			version:  &typesv1.Version{Major: 1},
+			artifact: proto.Clone(linux).(*typesv1.VersionArtifact),
+		},
+		{
+			name:     "different sha256",
+			version:  &typesv1.Version{Major: 1},
+			artifact: &typesv1.VersionArtifact{Url: linux.Url, Sha256: "bb", Architecture: "amd64", OperatingSystem: "linux"},
+			wantErr:  "version-artifact 1.0.0 linux/amd64 already exists and differs:\n  sha256:\n    - \"aa\"\n    + \"bb\"",
+		},
+		{
+			name:     "other platform",
+			version:  &typesv1.Version{Major: 1},
+			artifact: &typesv1.VersionArtifact{Url: linux.Url, Sha256: "aa", Architecture: "arm64", OperatingSystem: "linux"},
+			wantErr:  "version-artifact 1.0.0 linux/arm64 is said to exist, but isn't listed",
+		},
+		{
+			name:     "unknown version",
+			version:  &typesv1.Version{Major: 2},
+			artifact: proto.Clone(linux).(*typesv1.VersionArtifact),
+			wantErr:  "version-artifact 2.0.0 linux/amd64 is said to exist, but isn't listed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckExistingVersionArtifact(context.Background(), client, &releasepb.CreateVersionArtifactRequest{
+				ProjectName: "apictl",
+				Version:     tt.version,
+				Artifact:    tt.artifact,
+			})
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCheckExistingPublication(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	darwin := Platform{OS: "darwin", Arch: "arm64"}
+	rc := &fakeReleaseService{versions: []*releasepb.ListVersionArtifactResponse_ListItem{
+		{Version: &typesv1.Version{Major: 0, Minor: 9}},
+		{Version: &typesv1.Version{Major: 1}, Artifacts: []*typesv1.VersionArtifact{
+			{Url: "https://x/1.0.0/linux.tar.gz", Architecture: "amd64", OperatingSystem: "linux"},
+			{Url: "https://x/1.0.0/darwin.tar.gz", Architecture: "arm64", OperatingSystem: "darwin"},
+		}},
+	}}
+	tests := []struct {
+		name    string
+		version *typesv1.Version
+		heads   map[Platform]string
+		wantErr string
+	}{
+		{
+			name:    "served everywhere",
+			version: &typesv1.Version{Major: 1},
+			heads:   map[Platform]string{linux: "1.0.0", darwin: "1.0.0"},
+		},
+		{
+			name:    "shadowed on a platform",
+			version: &typesv1.Version{Major: 1},
+			heads:   map[Platform]string{linux: "1.0.0", darwin: "1.1.0"},
+			wantErr: "published-version 1.0.0 on \"main\" already exists and differs:\n  head for darwin/arm64:\n    - 1.1.0\n    + 1.0.0",
+		},
+		{
+			name:    "nothing served",
+			version: &typesv1.Version{Major: 1},
+			heads:   map[Platform]string{linux: "1.0.0"},
+			wantErr: "published-version 1.0.0 on \"main\" already exists and differs:\n  head for darwin/arm64:\n    - nothing\n    + 1.0.0",
+		},
+		{
+			name:    "build metadata differs",
+			version: &typesv1.Version{Major: 1},
+			heads:   map[Platform]string{linux: "1.0.0+abc", darwin: "1.0.0"},
+			wantErr: "published-version 1.0.0 on \"main\" already exists and differs:\n  head for linux/amd64:\n    - 1.0.0+abc\n    + 1.0.0",
+		},
+		{
+			name:    "version without artifacts",
+			version: &typesv1.Version{Major: 0, Minor: 9},
+			wantErr: "published-version 0.9.0 on \"main\" is said to exist, but the version has no artifacts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := &fakeUpdateService{heads: map[string]map[Platform]string{"main": tt.heads}}
+			err := CheckExistingPublication(context.Background(), rc, uc, &releasepb.PublishVersionRequest{
+				ProjectName:        "apictl",
+				ReleaseChannelName: "main",
+				Version:            tt.version,
+			})
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Errorf("want error %q", want)
+	case err != nil && err.Error() != want:
+		t.Errorf("error:\n%s\nwant:\n%s", err, want)
+	}
+}
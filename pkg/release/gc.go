@@ -0,0 +1,40 @@
+package release
+
+import (
+	"context"
+	"strings"
+
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+)
+
+// ReferencedKeys lists every artifact of the projects and maps their URLs to
+// object keys with `keyFor`, keeping the keys under `prefix`. URLs that
+// `keyFor` can't map but that `serves` says point at the bucket are returned
+// apart, since what they reference can't be told.
+func ReferencedKeys(ctx context.Context, rc releasev1connect.ReleaseServiceClient, projects []string, prefix string, keyFor func(url string) (string, bool), serves func(url string) bool) (map[string]bool, []string, error) {
+	var (
+		referenced = make(map[string]bool)
+		unmapped   []string
+	)
+	for _, project := range projects {
+		items, err := ListAllVersionArtifacts(ctx, rc, project)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, item := range items {
+			for _, artifact := range item.Artifacts {
+				key, ok := keyFor(artifact.Url)
+				if !ok {
+					if serves(artifact.Url) {
+						unmapped = append(unmapped, artifact.Url)
+					}
+					continue
+				}
+				if strings.HasPrefix(key, prefix) {
+					referenced[key] = true
+				}
+			}
+		}
+	}
+	return referenced, unmapped, nil
+}
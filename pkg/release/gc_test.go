@@ -0,0 +1,68 @@
+package release
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/bucket"
+	"github.com/humanlogio/apictl/pkg/store"
+)
+
+func TestReferencedKeys(t *testing.T) {
+	const presigned = "?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Date=20251017T120000Z&X-Amz-Expires=3600&X-Amz-Signature=abc"
+	version := func(major int32, urls ...string) *releasepb.ListVersionArtifactResponse_ListItem {
+		item := &releasepb.ListVersionArtifactResponse_ListItem{Version: &typesv1.Version{Major: major}}
+		for _, u := range urls {
+			item.Artifacts = append(item.Artifacts, &typesv1.VersionArtifact{Url: u})
+		}
+		return item
+	}
+	// one version per page
+	rc := &fakeReleaseService{versions: []*releasepb.ListVersionArtifactResponse_ListItem{
+		version(1, "https://dl.example.com/apictl/1.0.0/linux.tar.gz"),
+		version(2, "https://dl.example.com/apictl/2.0.0/linux%2Bamd64.tar.gz"),
+		version(3, "https://releases.s3.us-east-1.amazonaws.com/apictl/3.0.0/linux.tar.gz"+presigned),
+		version(4,
+			"https://github.com/humanlogio/apictl/releases/download/v4.0.0/linux.tar.gz",
+			"https://dl.example.com/other/4.0.0/linux.tar.gz",
+		),
+		version(5, "https://releases.s3.amazonaws.com/apictl/5.0.0/linux.tar.gz"),
+	}}
+	st := &store.S3Store{Bucket: "releases", PublicURL: "https://dl.example.com"}
+	referenced, unmapped, err := ReferencedKeys(context.Background(), rc, []string{"apictl"}, "apictl/",
+		func(url string) (string, bool) { return store.KeyForURL(st, url) },
+		func(url string) bool { return store.Serves(st, url) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReferenced := []string{"apictl/1.0.0/linux.tar.gz", "apictl/2.0.0/linux+amd64.tar.gz", "apictl/3.0.0/linux.tar.gz"}
+	for _, key := range wantReferenced {
+		if !referenced[key] {
+			t.Errorf("%q isn't referenced", key)
+		}
+	}
+	if len(referenced) != len(wantReferenced) {
+		t.Errorf("got referenced keys %v, want %q", referenced, wantReferenced)
+	}
+	// neither presigned nor public, so what it points to can't be told
+	if want := []string{"https://releases.s3.amazonaws.com/apictl/5.0.0/linux.tar.gz"}; !slices.Equal(unmapped, want) {
+		t.Errorf("got unmapped %q, want %q", unmapped, want)
+	}
+
+	now := time.Now()
+	var objects []types.Object
+	for _, key := range []string{"apictl/1.0.0/linux.tar.gz", "apictl/2.0.0/linux+amd64.tar.gz", "apictl/3.0.0/linux.tar.gz", "apictl/0.1.0/linux.tar.gz"} {
+		objects = append(objects, types.Object{Key: aws.String(key), LastModified: aws.Time(now.Add(-48 * time.Hour))})
+	}
+	orphans, _ := bucket.Orphans(objects, referenced, 24*time.Hour, now)
+	if len(orphans) != 1 || aws.ToString(orphans[0].Key) != "apictl/0.1.0/linux.tar.gz" {
+		t.Errorf("got orphans %v, want only apictl/0.1.0/linux.tar.gz", orphans)
+	}
+}
@@ -0,0 +1,126 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"connectrpc.com/connect"
+	cliupdatepb "github.com/humanlogio/api/go/svc/cliupdate/v1"
+	"github.com/humanlogio/api/go/svc/cliupdate/v1/cliupdatev1connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+// cursors remembers the cursors a listing followed, so that a server handing
+// out the same one twice doesn't make it loop forever.
+type cursors map[string]struct{}
+
+func (c cursors) next(cursor *typesv1.Cursor) error {
+	key := string(cursor.GetOpaque())
+	if _, ok := c[key]; ok {
+		return fmt.Errorf("server returned cursor %q twice", key)
+	}
+	c[key] = struct{}{}
+	return nil
+}
+
+// ListAllReleaseChannels follows cursors until every channel of the project
+// was listed.
+func ListAllReleaseChannels(ctx context.Context, client releasev1connect.ReleaseServiceClient, project string) ([]*typesv1.ReleaseChannel, error) {
+	var (
+		out    []*typesv1.ReleaseChannel
+		cursor *typesv1.Cursor
+		seen   = cursors{}
+	)
+	for {
+		res, err := client.ListReleaseChannel(ctx, connect.NewRequest(&releasepb.ListReleaseChannelRequest{
+			ProjectName: project,
+			Cursor:      cursor,
+		}))
+		if err != nil {
+			return nil, fmt.Errorf("listing release channels: %w", err)
+		}
+		for _, item := range res.Msg.Items {
+			out = append(out, item.ReleaseChannel)
+		}
+		if res.Msg.Next == nil {
+			return out, nil
+		}
+		if err := seen.next(res.Msg.Next); err != nil {
+			return nil, fmt.Errorf("listing release channels: %w", err)
+		}
+		cursor = res.Msg.Next
+	}
+}
+
+// ListAllVersionArtifacts follows cursors until every version of the project
+// was listed.
+func ListAllVersionArtifacts(ctx context.Context, client releasev1connect.ReleaseServiceClient, project string) ([]*releasepb.ListVersionArtifactResponse_ListItem, error) {
+	var (
+		out    []*releasepb.ListVersionArtifactResponse_ListItem
+		cursor *typesv1.Cursor
+		seen   = cursors{}
+	)
+	for {
+		res, err := client.ListVersionArtifact(ctx, connect.NewRequest(&releasepb.ListVersionArtifactRequest{
+			ProjectName: project,
+			Cursor:      cursor,
+		}))
+		if err != nil {
+			return nil, fmt.Errorf("listing version artifacts: %w", err)
+		}
+		out = append(out, res.Msg.Items...)
+		if res.Msg.Next == nil {
+			return out, nil
+		}
+		if err := seen.next(res.Msg.Next); err != nil {
+			return nil, fmt.Errorf("listing version artifacts: %w", err)
+		}
+		cursor = res.Msg.Next
+	}
+}
+
+// ChannelHead returns the version a fresh install on the given platform would
+// receive from a channel, or nil if the channel serves nothing for it.
+func ChannelHead(ctx context.Context, client cliupdatev1connect.UpdateServiceClient, project, channel, os, arch string) (*typesv1.Version, *typesv1.VersionArtifact, error) {
+	res, err := client.GetNextUpdate(ctx, connect.NewRequest(&cliupdatepb.GetNextUpdateRequest{
+		ProjectName:            project,
+		CurrentVersion:         &typesv1.Version{},
+		MachineArchitecture:    arch,
+		MachineOperatingSystem: os,
+		ReleaseChannelName:     &channel,
+		Meta:                   &typesv1.ReqMeta{MachineId: -1},
+	}))
+	if connectErr := new(connect.Error); errors.As(err, &connectErr) && connectErr.Code() == connect.CodeNotFound {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("getting head of channel %q for %s/%s: %w", channel, os, arch, err)
+	}
+	return res.Msg.NextVersion, res.Msg.NextArtifact, nil
+}
+
+// SameVersion tells whether two versions are identical, build metadata
+// included.
+func SameVersion(a, b *typesv1.Version) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	sa, erra := a.AsSemver()
+	sb, errb := b.AsSemver()
+	if erra != nil || errb != nil {
+		return false
+	}
+	return sa.String() == sb.String()
+}
+
+// FindVersion returns the listed item for `v`, or nil if it isn't listed.
+func FindVersion(items []*releasepb.ListVersionArtifactResponse_ListItem, v *typesv1.Version) *releasepb.ListVersionArtifactResponse_ListItem {
+	for _, item := range items {
+		if SameVersion(item.Version, v) {
+			return item
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package release
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+// fakeReleaseService lists its channels and versions one page per item.
+type fakeReleaseService struct {
+	releasev1connect.ReleaseServiceClient
+	channels []*typesv1.ReleaseChannel
+	versions []*releasepb.ListVersionArtifactResponse_ListItem
+}
+
+func page(cursor *typesv1.Cursor, n int) (int, *typesv1.Cursor) {
+	i, _ := strconv.Atoi(string(cursor.GetOpaque()))
+	if i+1 >= n {
+		return i, nil
+	}
+	return i, &typesv1.Cursor{Opaque: []byte(strconv.Itoa(i + 1))}
+}
+
+func (f *fakeReleaseService) ListReleaseChannel(ctx context.Context, req *connect.Request[releasepb.ListReleaseChannelRequest]) (*connect.Response[releasepb.ListReleaseChannelResponse], error) {
+	res := new(releasepb.ListReleaseChannelResponse)
+	if len(f.channels) > 0 {
+		var i int
+		i, res.Next = page(req.Msg.Cursor, len(f.channels))
+		res.Items = append(res.Items, &releasepb.ListReleaseChannelResponse_ListItem{ReleaseChannel: f.channels[i]})
+	}
+	return connect.NewResponse(res), nil
+}
+
+func (f *fakeReleaseService) ListVersionArtifact(ctx context.Context, req *connect.Request[releasepb.ListVersionArtifactRequest]) (*connect.Response[releasepb.ListVersionArtifactResponse], error) {
+	res := new(releasepb.ListVersionArtifactResponse)
+	if len(f.versions) > 0 {
+		var i int
+		i, res.Next = page(req.Msg.Cursor, len(f.versions))
+		res.Items = append(res.Items, f.versions[i])
+	}
+	return connect.NewResponse(res), nil
+}
+
+// loopingReleaseService hands out the same cursor on every page.
+type loopingReleaseService struct {
+	fakeReleaseService
+	calls int
+}
+
+func (f *loopingReleaseService) ListReleaseChannel(ctx context.Context, req *connect.Request[releasepb.ListReleaseChannelRequest]) (*connect.Response[releasepb.ListReleaseChannelResponse], error) {
+	f.calls++
+	return connect.NewResponse(&releasepb.ListReleaseChannelResponse{
+		Next:  &typesv1.Cursor{Opaque: []byte("again")},
+		Items: []*releasepb.ListReleaseChannelResponse_ListItem{{ReleaseChannel: &typesv1.ReleaseChannel{Name: "main"}}},
+	}), nil
+}
+
+func (f *loopingReleaseService) ListVersionArtifact(ctx context.Context, req *connect.Request[releasepb.ListVersionArtifactRequest]) (*connect.Response[releasepb.ListVersionArtifactResponse], error) {
+	f.calls++
+	return connect.NewResponse(&releasepb.ListVersionArtifactResponse{
+		Next:  &typesv1.Cursor{Opaque: []byte("again")},
+		Items: []*releasepb.ListVersionArtifactResponse_ListItem{{Version: &typesv1.Version{Major: 1}}},
+	}), nil
+}
+
+func TestListAllFollowsCursors(t *testing.T) {
+	client := &fakeReleaseService{
+		channels: []*typesv1.ReleaseChannel{{Name: "main"}, {Name: "beta"}, {Name: "nightly"}},
+		versions: []*releasepb.ListVersionArtifactResponse_ListItem{{Version: &typesv1.Version{Major: 1}}, {Version: &typesv1.Version{Major: 2}}},
+	}
+	channels, err := ListAllReleaseChannels(context.Background(), client, "apictl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 3 || channels[2].Name != "nightly" {
+		t.Errorf("got %d channels, want 3", len(channels))
+	}
+	items, err := ListAllVersionArtifacts(context.Background(), client, "apictl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[1].Version.Major != 2 {
+		t.Errorf("got %d versions, want 2", len(items))
+	}
+}
+
+func TestListAllStopsOnRepeatedCursor(t *testing.T) {
+	client := new(loopingReleaseService)
+	if _, err := ListAllReleaseChannels(context.Background(), client, "apictl"); err == nil || !strings.Contains(err.Error(), `server returned cursor "again" twice`) {
+		t.Errorf("error %v, want a repeated cursor", err)
+	}
+	if client.calls != 2 {
+		t.Errorf("listed %d pages, want 2", client.calls)
+	}
+	client.calls = 0
+	if _, err := ListAllVersionArtifacts(context.Background(), client, "apictl"); err == nil || !strings.Contains(err.Error(), `server returned cursor "again" twice`) {
+		t.Errorf("error %v, want a repeated cursor", err)
+	}
+	if client.calls != 2 {
+		t.Errorf("listed %d pages, want 2", client.calls)
+	}
+}
@@ -0,0 +1,41 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+// Platform is an os/arch pair.
+type Platform struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+func (p Platform) String() string { return p.OS + "/" + p.Arch }
+
+// PlatformOf returns the platform an artifact is built for.
+func PlatformOf(a *typesv1.VersionArtifact) Platform {
+	return Platform{OS: a.OperatingSystem, Arch: a.Architecture}
+}
+
+// ParsePlatforms reads `os/arch` pairs, each value possibly holding several
+// comma separated pairs.
+func ParsePlatforms(values []string) ([]Platform, error) {
+	var out []Platform
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			os, arch, ok := strings.Cut(pair, "/")
+			if !ok || os == "" || arch == "" {
+				return nil, fmt.Errorf("invalid platform %q, want `os/arch`", pair)
+			}
+			out = append(out, Platform{OS: os, Arch: arch})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/humanlogio/api/go/svc/cliupdate/v1/cliupdatev1connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+// Promotion publishes on a channel a version that is currently served on
+// another one.
+type Promotion struct {
+	Project string
+	Version *typesv1.Version
+	From    string
+	To      string
+	// Platforms that must have an artifact for the version to be promoted.
+	Platforms []Platform
+}
+
+// Check verifies that the version has an artifact for every required
+// platform, and that it's what the source channel serves for each of them.
+func (p *Promotion) Check(ctx context.Context, rc releasev1connect.ReleaseServiceClient, uc cliupdatev1connect.UpdateServiceClient) error {
+	version := versions.String(p.Version)
+	items, err := ListAllVersionArtifacts(ctx, rc, p.Project)
+	if err != nil {
+		return err
+	}
+	item := FindVersion(items, p.Version)
+	if item == nil {
+		return fmt.Errorf("version %s has no artifacts", version)
+	}
+	have := make(map[Platform]bool, len(item.Artifacts))
+	for _, a := range item.Artifacts {
+		have[PlatformOf(a)] = true
+	}
+	var missing, notServed []string
+	for _, platform := range p.Platforms {
+		if !have[platform] {
+			missing = append(missing, platform.String())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("version %s has no artifacts for %s", version, strings.Join(missing, ", "))
+	}
+	for _, platform := range p.Platforms {
+		head, _, err := ChannelHead(ctx, uc, p.Project, p.From, platform.OS, platform.Arch)
+		if err != nil {
+			return err
+		}
+		if !SameVersion(head, p.Version) {
+			served := "nothing"
+			if head != nil {
+				served = versions.String(head)
+			}
+			notServed = append(notServed, fmt.Sprintf("%s (serves %s)", platform, served))
+		}
+	}
+	if len(notServed) > 0 {
+		return fmt.Errorf("version %s is not currently served on channel %q for %s", version, p.From, strings.Join(notServed, ", "))
+	}
+	return nil
+}
+
+// Run checks the promotion and publishes the version on the target channel.
+func (p *Promotion) Run(ctx context.Context, rc releasev1connect.ReleaseServiceClient, uc cliupdatev1connect.UpdateServiceClient) error {
+	if err := p.Check(ctx, rc, uc); err != nil {
+		return fmt.Errorf("can't promote: %w", err)
+	}
+	_, err := rc.PublishVersion(ctx, connect.NewRequest(&releasepb.PublishVersionRequest{
+		ProjectName:        p.Project,
+		ReleaseChannelName: p.To,
+		Version:            p.Version,
+	}))
+	if err != nil {
+		return fmt.Errorf("publishing version on channel %q: %w", p.To, err)
+	}
+	return nil
+}
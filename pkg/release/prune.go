@@ -0,0 +1,106 @@
+package release
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/humanlogio/api/go/svc/cliupdate/v1/cliupdatev1connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+// Retention decides which versions to keep.
+type Retention struct {
+	// KeepLatest is how many of the most recent matching versions are kept.
+	KeepLatest int
+	// PrereleasePrefix restricts the retention to versions whose prerelease
+	// starts with it, e.g. `next` for `1.2.3-next.1731300000`. Versions that
+	// don't match are always kept.
+	PrereleasePrefix string
+}
+
+func (r *Retention) matches(item *releasepb.ListVersionArtifactResponse_ListItem) bool {
+	if r.PrereleasePrefix == "" {
+		return true
+	}
+	return strings.HasPrefix(strings.Join(item.Version.Prereleases, "."), r.PrereleasePrefix)
+}
+
+// Expired returns the matching versions that are older than the `KeepLatest`
+// most recent ones, newest first.
+func (r *Retention) Expired(items []*releasepb.ListVersionArtifactResponse_ListItem) []*releasepb.ListVersionArtifactResponse_ListItem {
+	var matching []*releasepb.ListVersionArtifactResponse_ListItem
+	for _, item := range items {
+		if r.matches(item) {
+			matching = append(matching, item)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		vi, erri := matching[i].Version.AsSemver()
+		vj, errj := matching[j].Version.AsSemver()
+		if erri != nil || errj != nil {
+			return errj != nil && erri == nil
+		}
+		return vi.GT(vj)
+	})
+	if len(matching) <= r.KeepLatest {
+		return nil
+	}
+	return matching[max(r.KeepLatest, 0):]
+}
+
+// Unserved returns the versions that are the head of no channel, given the
+// heads returned by ChannelHeads.
+func Unserved(items []*releasepb.ListVersionArtifactResponse_ListItem, heads map[string][]string) []*releasepb.ListVersionArtifactResponse_ListItem {
+	var out []*releasepb.ListVersionArtifactResponse_ListItem
+	for _, item := range items {
+		if _, ok := heads[versions.String(item.Version)]; !ok {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// ChannelHeads returns the versions that any channel of the project serves
+// to any of the platforms.
+func ChannelHeads(ctx context.Context, rc releasev1connect.ReleaseServiceClient, uc cliupdatev1connect.UpdateServiceClient, project string, platforms []Platform) (map[string][]string, error) {
+	channels, err := ListAllReleaseChannels(ctx, rc, project)
+	if err != nil {
+		return nil, err
+	}
+	heads := make(map[string][]string)
+	for _, ch := range channels {
+		for _, p := range platforms {
+			head, _, err := ChannelHead(ctx, uc, project, ch.Name, p.OS, p.Arch)
+			if err != nil {
+				return nil, err
+			}
+			if head == nil {
+				continue
+			}
+			key := versions.String(head)
+			heads[key] = append(heads[key], ch.Name+" ("+p.String()+")")
+		}
+	}
+	return heads, nil
+}
+
+// PlatformsOf lists every platform any of the versions has an artifact for.
+func PlatformsOf(items []*releasepb.ListVersionArtifactResponse_ListItem) []Platform {
+	var (
+		out  []Platform
+		seen = make(map[Platform]bool)
+	)
+	for _, item := range items {
+		for _, a := range item.Artifacts {
+			p := PlatformOf(a)
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
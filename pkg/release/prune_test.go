@@ -0,0 +1,120 @@
+package release
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+func items(t *testing.T, vs ...string) []*releasepb.ListVersionArtifactResponse_ListItem {
+	t.Helper()
+	var out []*releasepb.ListVersionArtifactResponse_ListItem
+	for _, s := range vs {
+		out = append(out, &releasepb.ListVersionArtifactResponse_ListItem{Version: mustVersion(t, s)})
+	}
+	return out
+}
+
+func names(items []*releasepb.ListVersionArtifactResponse_ListItem) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, versions.String(item.Version))
+	}
+	return out
+}
+
+func TestRetentionExpired(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention Retention
+		versions  []string
+		want      []string
+	}{
+		{
+			name:      "keeps the latest",
+			retention: Retention{KeepLatest: 2},
+			versions:  []string{"0.1.0", "0.3.0", "0.2.0", "0.10.0"},
+			want:      []string{"0.2.0", "0.1.0"},
+		},
+		{
+			name:      "prereleases precede their release",
+			retention: Retention{KeepLatest: 2},
+			versions:  []string{"1.0.0-rc.2", "1.0.0", "1.0.0-rc.10", "0.9.0"},
+			want:      []string{"1.0.0-rc.2", "0.9.0"},
+		},
+		{
+			name:      "fewer versions than kept",
+			retention: Retention{KeepLatest: 5},
+			versions:  []string{"0.1.0", "0.2.0"},
+		},
+		{
+			name:      "keep none",
+			retention: Retention{},
+			versions:  []string{"0.1.0", "0.2.0"},
+			want:      []string{"0.2.0", "0.1.0"},
+		},
+		{
+			name:      "negative keep",
+			retention: Retention{KeepLatest: -1},
+			versions:  []string{"0.1.0"},
+			want:      []string{"0.1.0"},
+		},
+		{
+			name:      "only matching prereleases expire",
+			retention: Retention{KeepLatest: 1, PrereleasePrefix: "next"},
+			versions:  []string{"1.2.3-next.1731300000", "1.2.3-next.1731400000", "1.2.3-rc.1", "1.2.2", "1.2.3-next.1731200000"},
+			want:      []string{"1.2.3-next.1731300000", "1.2.3-next.1731200000"},
+		},
+		{
+			name:      "prefix is matched against every identifier",
+			retention: Retention{PrereleasePrefix: "next.17"},
+			versions:  []string{"1.0.0-next.1731300000", "1.0.0-next.2", "1.0.0-nextgen.17"},
+			want:      []string{"1.0.0-next.1731300000"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(tt.retention.Expired(items(t, tt.versions...)))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelHeads(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	darwin := Platform{OS: "darwin", Arch: "arm64"}
+	rc := &fakeReleaseService{channels: []*typesv1.ReleaseChannel{{Name: "main"}, {Name: "beta"}, {Name: "empty"}}}
+	uc := &fakeUpdateService{heads: map[string]map[Platform]string{
+		"main": {linux: "0.1.0", darwin: "0.1.0"},
+		"beta": {linux: "0.2.0-rc.1", darwin: "0.1.0"},
+	}}
+	heads, err := ChannelHeads(context.Background(), rc, uc, "apictl", []Platform{linux, darwin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"0.1.0":      {"main (linux/amd64)", "main (darwin/arm64)", "beta (darwin/arm64)"},
+		"0.2.0-rc.1": {"beta (linux/amd64)"},
+	}
+	if len(heads) != len(want) {
+		t.Errorf("got heads %q, want %q", heads, want)
+	}
+	for v, servedOn := range want {
+		if !slices.Equal(heads[v], servedOn) {
+			t.Errorf("%s is the head of %q, want %q", v, heads[v], servedOn)
+		}
+	}
+
+	// versions that are the head of a channel on a single platform are never
+	// pruned, however old
+	expired := (&Retention{}).Expired(items(t, "0.0.1", "0.1.0", "0.2.0-rc.1", "0.2.0"))
+	if got := names(Unserved(expired, heads)); !slices.Equal(got, []string{"0.2.0", "0.0.1"}) {
+		t.Errorf("would prune %q", got)
+	}
+}
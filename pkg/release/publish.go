@@ -0,0 +1,152 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/github"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+// ArchiveResult is the outcome of registering one archive.
+type ArchiveResult struct {
+	Name     string                   `json:"name"`
+	Artifact *typesv1.VersionArtifact `json:"artifact,omitempty"`
+	Err      error                    `json:"-"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+func (r *ArchiveResult) fail(err error) {
+	r.Err = err
+	r.Error = err.Error()
+}
+
+// Publisher registers the archives of a goreleaser run as version artifacts,
+// then publishes the version on a channel.
+type Publisher struct {
+	Client  releasev1connect.ReleaseServiceClient
+	Project string
+	Channel string
+	// URLFor resolves where an archive can be downloaded from.
+	URLFor func(ctx context.Context, a Artifact) (string, error)
+	// Checksums, if set, is the source of the registered sha256. Archives
+	// that aren't listed or don't hash to the listed value are refused.
+	Checksums Checksums
+}
+
+// DefaultURLFor uses `archive_base_url` from `version.json` when present, and
+// otherwise the download URL of the matching asset in the GitHub release of
+// the version.
+func DefaultURLFor(dist *Dist, gh *github.Client, owner string) func(context.Context, Artifact) (string, error) {
+	var ghRelease *github.Release
+	return func(ctx context.Context, a Artifact) (string, error) {
+		if dist.VersionInfo != nil && dist.VersionInfo.ArchiveBaseURL != "" {
+			return strings.TrimSuffix(dist.VersionInfo.ArchiveBaseURL, "/") + "/" + a.Name, nil
+		}
+		if ghRelease == nil {
+			tag := dist.Metadata.Tag
+			if tag == "" {
+				v, err := dist.Version()
+				if err != nil {
+					return "", err
+				}
+				tag = "v" + versions.String(v)
+			}
+			var err error
+			if ghRelease, err = gh.ReleaseByTag(ctx, owner, dist.Metadata.ProjectName, tag); err != nil {
+				return "", err
+			}
+		}
+		asset, ok := ghRelease.Asset(a.Name)
+		if !ok {
+			return "", fmt.Errorf("release %q has no asset named %q", ghRelease.TagName, a.Name)
+		}
+		return asset.BrowserDownloadURL, nil
+	}
+}
+
+// Publish registers every archive, continuing past failures so that the
+// results cover all of them. The version is only published if every archive
+// was registered.
+func (p *Publisher) Publish(ctx context.Context, dist *Dist) ([]*ArchiveResult, error) {
+	version, err := dist.Version()
+	if err != nil {
+		return nil, err
+	}
+	archives := dist.Archives()
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("no archives found in dist")
+	}
+	var (
+		results = make([]*ArchiveResult, 0, len(archives))
+		failed  int
+	)
+	for _, a := range archives {
+		res := &ArchiveResult{Name: a.Name}
+		results = append(results, res)
+		artifact, err := p.artifactFor(ctx, dist, a)
+		if err != nil {
+			res.fail(err)
+			failed++
+			continue
+		}
+		res.Artifact = artifact
+		_, err = p.Client.CreateVersionArtifact(ctx, connect.NewRequest(&releasepb.CreateVersionArtifactRequest{
+			ProjectName: p.Project,
+			Version:     version,
+			Artifact:    artifact,
+		}))
+		if err != nil {
+			res.fail(fmt.Errorf("creating version artifact: %w", err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d/%d archives failed to register, not publishing", failed, len(archives))
+	}
+	_, err = p.Client.PublishVersion(ctx, connect.NewRequest(&releasepb.PublishVersionRequest{
+		ProjectName:        p.Project,
+		ReleaseChannelName: p.Channel,
+		Version:            version,
+	}))
+	if err != nil {
+		return results, fmt.Errorf("publishing version on channel %q: %w", p.Channel, err)
+	}
+	return results, nil
+}
+
+func (p *Publisher) artifactFor(ctx context.Context, dist *Dist, a Artifact) (*typesv1.VersionArtifact, error) {
+	url, err := p.URLFor(ctx, a)
+	if err != nil {
+		return nil, fmt.Errorf("resolving url: %w", err)
+	}
+	sum, err := FileSHA256(dist.LocalPath(a))
+	if err != nil {
+		return nil, err
+	}
+	if p.Checksums != nil {
+		want, ok := p.Checksums[a.Name]
+		if !ok {
+			return nil, fmt.Errorf("not listed in the checksums file")
+		}
+		if want != sum {
+			return nil, fmt.Errorf("checksum mismatch: checksums file has %s, local file hashes to %s", want, sum)
+		}
+	}
+	sig, err := dist.Signature(a)
+	if err != nil {
+		return nil, err
+	}
+	return &typesv1.VersionArtifact{
+		Url:             url,
+		Sha256:          sum,
+		Signature:       sig,
+		Architecture:    a.Goarch,
+		OperatingSystem: a.Goos,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"connectrpc.com/connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+// ReplaceVersionArtifact swaps a version artifact for another. Artifacts
+// can't be updated, so the old one is deleted first, and registered again if
+// the new one can't be.
+func ReplaceVersionArtifact(ctx context.Context, rc releasev1connect.ReleaseServiceClient, project string, version *typesv1.Version, old, replacement *typesv1.VersionArtifact) error {
+	vs := versions.String(version)
+	_, err := rc.DeleteVersionArtifact(ctx, connect.NewRequest(&releasepb.DeleteVersionArtifactRequest{
+		ProjectName: project,
+		Version:     version,
+		Artifact:    old,
+	}))
+	if err != nil {
+		return fmt.Errorf("deleting version-artifact %s %s: %w", vs, PlatformOf(old), err)
+	}
+	_, err = rc.CreateVersionArtifact(ctx, connect.NewRequest(&releasepb.CreateVersionArtifactRequest{
+		ProjectName: project,
+		Version:     version,
+		Artifact:    replacement,
+	}))
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("registering replacement version-artifact %s %s: %w", vs, PlatformOf(old), err)
+	_, rerr := rc.CreateVersionArtifact(ctx, connect.NewRequest(&releasepb.CreateVersionArtifactRequest{
+		ProjectName: project,
+		Version:     version,
+		Artifact:    old,
+	}))
+	if rerr != nil {
+		return errors.Join(err, fmt.Errorf("restoring previous version-artifact: %w", rerr))
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/humanlogio/api/go/svc/cliupdate/v1/cliupdatev1connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	"github.com/humanlogio/api/go/svc/release/v1/releasev1connect"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+// Rollback unpublishes a version from a channel.
+type Rollback struct {
+	Project string
+	Channel string
+	Version *typesv1.Version
+}
+
+// Resolution is what a channel serves to a platform.
+type Resolution struct {
+	Platform Platform                 `json:"platform"`
+	Version  *typesv1.Version         `json:"version,omitempty"`
+	Artifact *typesv1.VersionArtifact `json:"artifact,omitempty"`
+}
+
+// Platforms lists the platforms the version has artifacts for.
+func (r *Rollback) Platforms(ctx context.Context, rc releasev1connect.ReleaseServiceClient) ([]Platform, error) {
+	items, err := ListAllVersionArtifacts(ctx, rc, r.Project)
+	if err != nil {
+		return nil, err
+	}
+	item := FindVersion(items, r.Version)
+	if item == nil || len(item.Artifacts) == 0 {
+		return nil, fmt.Errorf("version %s has no artifacts", versions.String(r.Version))
+	}
+	out := make([]Platform, 0, len(item.Artifacts))
+	for _, a := range item.Artifacts {
+		out = append(out, PlatformOf(a))
+	}
+	return out, nil
+}
+
+func (r *Rollback) Unpublish(ctx context.Context, rc releasev1connect.ReleaseServiceClient) error {
+	_, err := rc.UnpublishVersion(ctx, connect.NewRequest(&releasepb.UnpublishVersionRequest{
+		ProjectName:        r.Project,
+		ReleaseChannelName: r.Channel,
+		Version:            r.Version,
+	}))
+	if err != nil {
+		return fmt.Errorf("unpublishing version from channel %q: %w", r.Channel, err)
+	}
+	return nil
+}
+
+// Verify resolves what the channel now serves to each platform, and fails if
+// any of them would still receive the rolled back version.
+func (r *Rollback) Verify(ctx context.Context, uc cliupdatev1connect.UpdateServiceClient, platforms []Platform) ([]*Resolution, error) {
+	var (
+		out   = make([]*Resolution, 0, len(platforms))
+		stuck []string
+	)
+	for _, platform := range platforms {
+		version, artifact, err := ChannelHead(ctx, uc, r.Project, r.Channel, platform.OS, platform.Arch)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, &Resolution{Platform: platform, Version: version, Artifact: artifact})
+		if SameVersion(version, r.Version) {
+			stuck = append(stuck, platform.String())
+		}
+	}
+	if len(stuck) > 0 {
+		return out, fmt.Errorf("channel %q still serves %s to %s", r.Channel, versions.String(r.Version), strings.Join(stuck, ", "))
+	}
+	return out, nil
+}
@@ -0,0 +1,208 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	cliupdatepb "github.com/humanlogio/api/go/svc/cliupdate/v1"
+	"github.com/humanlogio/api/go/svc/cliupdate/v1/cliupdatev1connect"
+	releasepb "github.com/humanlogio/api/go/svc/release/v1"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/versions"
+)
+
+// fakeUpdateService serves the heads of channels per platform, or fails with
+// err if set.
+type fakeUpdateService struct {
+	cliupdatev1connect.UpdateServiceClient
+	heads map[string]map[Platform]string
+	err   error
+}
+
+func (f *fakeUpdateService) GetNextUpdate(ctx context.Context, req *connect.Request[cliupdatepb.GetNextUpdateRequest]) (*connect.Response[cliupdatepb.GetNextUpdateResponse], error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	head, ok := f.heads[req.Msg.GetReleaseChannelName()][Platform{OS: req.Msg.MachineOperatingSystem, Arch: req.Msg.MachineArchitecture}]
+	if !ok {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("no version"))
+	}
+	v, err := versions.Parse(head)
+	if err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&cliupdatepb.GetNextUpdateResponse{NextVersion: v}), nil
+}
+
+// unpublishingReleaseService unpublishes versions from the heads of a
+// fakeUpdateService, making channels serve what `fallback` says instead.
+type unpublishingReleaseService struct {
+	fakeReleaseService
+	uc          *fakeUpdateService
+	fallback    map[Platform]string
+	unpublished []string
+	err         error
+}
+
+func (f *unpublishingReleaseService) UnpublishVersion(ctx context.Context, req *connect.Request[releasepb.UnpublishVersionRequest]) (*connect.Response[releasepb.UnpublishVersionResponse], error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	v := versions.String(req.Msg.Version)
+	f.unpublished = append(f.unpublished, req.Msg.ProjectName+" "+v+" from "+req.Msg.ReleaseChannelName)
+	heads := f.uc.heads[req.Msg.ReleaseChannelName]
+	for p, head := range heads {
+		if head != v {
+			continue
+		}
+		if fallback, ok := f.fallback[p]; ok {
+			heads[p] = fallback
+		} else {
+			delete(heads, p)
+		}
+	}
+	return connect.NewResponse(new(releasepb.UnpublishVersionResponse)), nil
+}
+
+func TestRollback(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	darwin := Platform{OS: "darwin", Arch: "arm64"}
+	windows := Platform{OS: "windows", Arch: "amd64"}
+	artifact := func(p Platform) *typesv1.VersionArtifact {
+		return &typesv1.VersionArtifact{Url: "https://x/" + p.String(), OperatingSystem: p.OS, Architecture: p.Arch}
+	}
+	tests := []struct {
+		name     string
+		version  string
+		fallback map[Platform]string
+		// stuck platforms keep receiving the version, as if another
+		// channel of higher priority served it
+		stuck         []Platform
+		wantPlatforms string
+		wantReceive   map[Platform]string
+		wantErr       string
+	}{
+		{
+			name:          "every platform falls back",
+			version:       "0.2.0",
+			fallback:      map[Platform]string{linux: "0.1.0", darwin: "0.1.0"},
+			wantPlatforms: "linux/amd64, darwin/arm64",
+			wantReceive:   map[Platform]string{linux: "0.1.0", darwin: "0.1.0"},
+		},
+		{
+			name:          "a platform receives nothing",
+			version:       "0.2.0",
+			fallback:      map[Platform]string{linux: "0.1.0"},
+			wantPlatforms: "linux/amd64, darwin/arm64",
+			wantReceive:   map[Platform]string{linux: "0.1.0", darwin: ""},
+		},
+		{
+			name:          "a platform is stuck",
+			version:       "0.2.0",
+			fallback:      map[Platform]string{linux: "0.1.0"},
+			stuck:         []Platform{darwin},
+			wantPlatforms: "linux/amd64, darwin/arm64",
+			wantReceive:   map[Platform]string{linux: "0.1.0", darwin: "0.2.0"},
+			wantErr:       `channel "main" still serves 0.2.0 to darwin/arm64`,
+		},
+		{
+			name:          "build metadata matters",
+			version:       "0.3.0+build.1",
+			wantPlatforms: "windows/amd64",
+			wantReceive:   map[Platform]string{windows: ""},
+		},
+		{
+			name:    "unknown version",
+			version: "9.9.9",
+			wantErr: "version 9.9.9 has no artifacts",
+		},
+		{
+			name:    "version without artifacts",
+			version: "0.0.1",
+			wantErr: "version 0.0.1 has no artifacts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := &fakeUpdateService{heads: map[string]map[Platform]string{
+				"main": {linux: "0.2.0", darwin: "0.2.0", windows: "0.3.0+build.1"},
+				"beta": {linux: "0.2.0"},
+			}}
+			rc := &unpublishingReleaseService{
+				fakeReleaseService: fakeReleaseService{versions: []*releasepb.ListVersionArtifactResponse_ListItem{
+					{Version: mustVersion(t, "0.0.1")},
+					{Version: mustVersion(t, "0.1.0"), Artifacts: []*typesv1.VersionArtifact{artifact(linux), artifact(darwin)}},
+					{Version: mustVersion(t, "0.2.0"), Artifacts: []*typesv1.VersionArtifact{artifact(linux), artifact(darwin)}},
+					{Version: mustVersion(t, "0.3.0+build.0"), Artifacts: []*typesv1.VersionArtifact{artifact(linux)}},
+					{Version: mustVersion(t, "0.3.0+build.1"), Artifacts: []*typesv1.VersionArtifact{artifact(windows)}},
+				}},
+				uc:       uc,
+				fallback: tt.fallback,
+			}
+			r := &Rollback{Project: "apictl", Channel: "main", Version: mustVersion(t, tt.version)}
+			ctx := context.Background()
+
+			platforms, err := r.Platforms(ctx, rc)
+			if err == nil {
+				var names []string
+				for _, p := range platforms {
+					names = append(names, p.String())
+				}
+				if got := strings.Join(names, ", "); got != tt.wantPlatforms {
+					t.Errorf("platforms %s, want %s", got, tt.wantPlatforms)
+				}
+				if err = r.Unpublish(ctx, rc); err != nil {
+					t.Fatal(err)
+				}
+				if want := "apictl " + tt.version + " from main"; len(rc.unpublished) != 1 || rc.unpublished[0] != want {
+					t.Errorf("unpublished %q, want %q", rc.unpublished, want)
+				}
+				// the other channels are left alone
+				if uc.heads["beta"][linux] != "0.2.0" {
+					t.Errorf("beta serves %q", uc.heads["beta"][linux])
+				}
+				for _, p := range tt.stuck {
+					uc.heads["main"][p] = tt.version
+				}
+				var resolutions []*Resolution
+				resolutions, err = r.Verify(ctx, uc, platforms)
+				if len(resolutions) != len(platforms) {
+					t.Errorf("got %d resolutions for %d platforms", len(resolutions), len(platforms))
+				}
+				for _, res := range resolutions {
+					var got string
+					if res.Version != nil {
+						got = versions.String(res.Version)
+					}
+					if want := tt.wantReceive[res.Platform]; got != want {
+						t.Errorf("%s receives %q, want %q", res.Platform, got, want)
+					}
+				}
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRollbackErrors(t *testing.T) {
+	ctx := context.Background()
+	r := &Rollback{Project: "apictl", Channel: "main", Version: mustVersion(t, "0.2.0")}
+	denied := connect.NewError(connect.CodePermissionDenied, errors.New("not an admin"))
+	rc := &unpublishingReleaseService{err: denied}
+	if err := r.Unpublish(ctx, rc); !errors.Is(err, denied) || !strings.HasPrefix(err.Error(), `unpublishing version from channel "main"`) {
+		t.Errorf("error %v, want the API's", err)
+	}
+	unavailable := connect.NewError(connect.CodeUnavailable, errors.New("down"))
+	_, err := r.Verify(ctx, &fakeUpdateService{err: unavailable}, []Platform{{OS: "linux", Arch: "amd64"}})
+	if !errors.Is(err, unavailable) || !strings.Contains(err.Error(), `getting head of channel "main" for linux/amd64`) {
+		t.Errorf("error %v, want the API's", err)
+	}
+}
@@ -0,0 +1,136 @@
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/progress"
+	"github.com/humanlogio/apictl/pkg/signing"
+)
+
+type SignatureStatus string
+
+const (
+	SignatureValid     SignatureStatus = "valid"
+	SignatureInvalid   SignatureStatus = "invalid"
+	SignatureMissing   SignatureStatus = "missing"
+	SignatureUnchecked SignatureStatus = "unchecked"
+)
+
+// ArtifactCheck is the outcome of verifying one artifact.
+type ArtifactCheck struct {
+	Platform  Platform        `json:"platform"`
+	URL       string          `json:"url"`
+	Sha256    string          `json:"sha256,omitempty"`
+	Sha256OK  bool            `json:"sha256_ok"`
+	Signature SignatureStatus `json:"signature"`
+	Err       error           `json:"-"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// OK tells if the artifact matches everything that was checked.
+func (c *ArtifactCheck) OK() bool {
+	return c.Err == nil && c.Sha256OK && (c.Signature == SignatureValid || c.Signature == SignatureUnchecked)
+}
+
+func (c *ArtifactCheck) fail(err error) {
+	c.Err = err
+	c.Error = err.Error()
+}
+
+// ArtifactVerifier downloads artifacts to check them against their registered
+// sha256 and signature.
+type ArtifactVerifier struct {
+	Client *http.Client
+	// PublicKey checks the signatures, which are left unchecked if it's nil.
+	PublicKey   *signing.PublicKey
+	Concurrency int
+	// Progress counts the bytes downloaded, if set.
+	Progress *progress.Reporter
+}
+
+// Verify checks every artifact concurrently. The checks are returned in the
+// same order as the artifacts.
+func (v *ArtifactVerifier) Verify(ctx context.Context, artifacts []*typesv1.VersionArtifact) []*ArtifactCheck {
+	out := make([]*ArtifactCheck, len(artifacts))
+	sem := make(chan struct{}, max(v.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, a := range artifacts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, a *typesv1.VersionArtifact) {
+			defer func() { <-sem; wg.Done() }()
+			out[i] = v.verify(ctx, a)
+		}(i, a)
+	}
+	wg.Wait()
+	return out
+}
+
+func (v *ArtifactVerifier) verify(ctx context.Context, a *typesv1.VersionArtifact) *ArtifactCheck {
+	check := &ArtifactCheck{Platform: PlatformOf(a), URL: a.Url, Signature: SignatureUnchecked}
+
+	var sigVerifier *signing.Verifier
+	if v.PublicKey != nil {
+		if a.Signature == "" || a.Signature == NoSignature {
+			check.Signature = SignatureMissing
+			check.fail(fmt.Errorf("no signature registered"))
+		} else if sig, err := signing.ParseSignature(a.Signature); err != nil {
+			check.Signature = SignatureInvalid
+			check.fail(fmt.Errorf("parsing signature: %w", err))
+		} else if sigVerifier, err = signing.NewVerifier(v.PublicKey, sig); err != nil {
+			check.Signature = SignatureInvalid
+			check.fail(err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.Url, nil)
+	if err != nil {
+		check.fail(err)
+		return check
+	}
+	res, err := v.Client.Do(req)
+	if err != nil {
+		check.fail(fmt.Errorf("downloading: %w", err))
+		return check
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		check.fail(fmt.Errorf("downloading: unexpected status %s", res.Status))
+		return check
+	}
+	if res.ContentLength > 0 {
+		v.Progress.Grow(res.ContentLength)
+	}
+	h := sha256.New()
+	w := io.Writer(h)
+	if sigVerifier != nil {
+		w = io.MultiWriter(h, sigVerifier)
+	}
+	if _, err := io.Copy(w, v.Progress.Reader(res.Body)); err != nil {
+		check.fail(fmt.Errorf("downloading: %w", err))
+		return check
+	}
+	check.Sha256 = hex.EncodeToString(h.Sum(nil))
+	check.Sha256OK = check.Sha256 == a.Sha256
+	if !check.Sha256OK && check.Err == nil {
+		check.fail(fmt.Errorf("sha256 is %s, registered as %s", check.Sha256, a.Sha256))
+	}
+	if sigVerifier != nil {
+		if err := sigVerifier.Verify(); err != nil {
+			check.Signature = SignatureInvalid
+			if check.Err == nil {
+				check.fail(err)
+			}
+		} else {
+			check.Signature = SignatureValid
+		}
+	}
+	return check
+}
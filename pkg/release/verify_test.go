@@ -0,0 +1,243 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"github.com/humanlogio/apictl/pkg/signing"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sign(t *testing.T, sk *signing.SecretKey, data []byte) string {
+	t.Helper()
+	sig, err := sk.Sign(bytes.NewReader(data), "file:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig.String()
+}
+
+func TestArtifactVerifierVerify(t *testing.T) {
+	content := []byte("the archive")
+	other := []byte("another archive")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/archive":
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	sk, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered, err := signing.ParseSignature(sign(t, sk, content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered.TrustedComment = "file:other"
+
+	tests := []struct {
+		name      string
+		publicKey *signing.PublicKey
+		path      string
+		sha256    string
+		signature string
+		wantOK    bool
+		wantSHA   bool
+		wantSig   SignatureStatus
+		wantErr   string
+	}{
+		{
+			name:    "sha256 matches",
+			path:    "/archive",
+			sha256:  sha256Hex(content),
+			wantOK:  true,
+			wantSHA: true,
+			wantSig: SignatureUnchecked,
+		},
+		{
+			name:    "sha256 differs",
+			path:    "/archive",
+			sha256:  sha256Hex(other),
+			wantSig: SignatureUnchecked,
+			wantErr: "sha256 is " + sha256Hex(content) + ", registered as " + sha256Hex(other),
+		},
+		{
+			name:    "not found",
+			path:    "/missing",
+			sha256:  sha256Hex(content),
+			wantSig: SignatureUnchecked,
+			wantErr: "unexpected status 404 Not Found",
+		},
+		{
+			name:      "signature valid",
+			publicKey: sk.Public(),
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			signature: sign(t, sk, content),
+			wantOK:    true,
+			wantSHA:   true,
+			wantSig:   SignatureValid,
+		},
+		{
+			name:      "signature not checked without a public key",
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			signature: sign(t, otherKey, other),
+			wantOK:    true,
+			wantSHA:   true,
+			wantSig:   SignatureUnchecked,
+		},
+		{
+			name:      "signature missing",
+			publicKey: sk.Public(),
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			wantSHA:   true,
+			wantSig:   SignatureMissing,
+			wantErr:   "no signature registered",
+		},
+		{
+			name:      "signature registered as absent",
+			publicKey: sk.Public(),
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			signature: NoSignature,
+			wantSHA:   true,
+			wantSig:   SignatureMissing,
+			wantErr:   "no signature registered",
+		},
+		{
+			name:      "signature unparsable",
+			publicKey: sk.Public(),
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			signature: "not a signature",
+			wantSHA:   true,
+			wantSig:   SignatureInvalid,
+			wantErr:   "parsing signature",
+		},
+		{
+			name:      "signature of other content",
+			publicKey: sk.Public(),
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			signature: sign(t, sk, other),
+			wantSHA:   true,
+			wantSig:   SignatureInvalid,
+			wantErr:   "invalid signature",
+		},
+		{
+			name:      "signature from another key",
+			publicKey: sk.Public(),
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			signature: sign(t, otherKey, content),
+			wantSHA:   true,
+			wantSig:   SignatureInvalid,
+			wantErr:   "signature was made with key",
+		},
+		{
+			name:      "trusted comment tampered with",
+			publicKey: sk.Public(),
+			path:      "/archive",
+			sha256:    sha256Hex(content),
+			signature: tampered.String(),
+			wantSHA:   true,
+			wantSig:   SignatureInvalid,
+			wantErr:   "invalid global signature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &ArtifactVerifier{Client: srv.Client(), PublicKey: tt.publicKey}
+			checks := v.Verify(context.Background(), []*typesv1.VersionArtifact{{
+				Url:             srv.URL + tt.path,
+				Sha256:          tt.sha256,
+				Signature:       tt.signature,
+				OperatingSystem: "linux",
+				Architecture:    "amd64",
+			}})
+			if len(checks) != 1 {
+				t.Fatalf("got %d checks", len(checks))
+			}
+			check := checks[0]
+			if check.OK() != tt.wantOK {
+				t.Errorf("OK() = %v, want %v (error %q)", check.OK(), tt.wantOK, check.Error)
+			}
+			if check.Sha256OK != tt.wantSHA {
+				t.Errorf("Sha256OK = %v, want %v", check.Sha256OK, tt.wantSHA)
+			}
+			if check.Signature != tt.wantSig {
+				t.Errorf("Signature = %q, want %q", check.Signature, tt.wantSig)
+			}
+			switch {
+			case tt.wantErr == "" && check.Err != nil:
+				t.Errorf("unexpected error: %v", check.Err)
+			case tt.wantErr != "" && (check.Err == nil || !strings.Contains(check.Error, tt.wantErr)):
+				t.Errorf("error %q doesn't contain %q", check.Error, tt.wantErr)
+			}
+			if want := (Platform{OS: "linux", Arch: "amd64"}); check.Platform != want {
+				t.Errorf("Platform = %v, want %v", check.Platform, want)
+			}
+		})
+	}
+}
+
+func TestArtifactVerifierVerifyKeepsOrder(t *testing.T) {
+	const n = 16
+	// the first artifacts are the slowest to download, so they complete last
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(time.Duration(n-i) * 2 * time.Millisecond)
+		fmt.Fprintf(w, "archive %d", i)
+	}))
+	defer srv.Close()
+
+	var artifacts []*typesv1.VersionArtifact
+	for i := 0; i < n; i++ {
+		artifacts = append(artifacts, &typesv1.VersionArtifact{
+			Url:    fmt.Sprintf("%s/%d", srv.URL, i),
+			Sha256: sha256Hex([]byte(fmt.Sprintf("archive %d", i))),
+		})
+	}
+	v := &ArtifactVerifier{Client: srv.Client(), Concurrency: 4}
+	checks := v.Verify(context.Background(), artifacts)
+	if len(checks) != n {
+		t.Fatalf("got %d checks, want %d", len(checks), n)
+	}
+	for i, check := range checks {
+		if check.URL != artifacts[i].Url {
+			t.Errorf("check %d is for %s, want %s", i, check.URL, artifacts[i].Url)
+		}
+		if !check.OK() {
+			t.Errorf("check %d failed: %v", i, check.Err)
+		}
+	}
+}
@@ -3,8 +3,11 @@
 package selfupdate
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,36 +15,64 @@ import (
 	"strings"
 
 	"github.com/cli/safeexec"
+	"github.com/humanlogio/apictl/pkg/progress"
 )
 
-func UpgradeInPlace(ctx context.Context, projectName string, stdout, stderr io.Writer, stdin io.Reader) error {
+func UpgradeInPlace(ctx context.Context, projectName string, stdout, stderr io.Writer, stdin io.Reader, p *progress.Reporter) error {
 	if runtime.GOOS == "windows" {
 		if err := renameCurrentBinaries(); err != nil {
 			return err
 		}
 	}
 
-	shellToUse, ok := os.LookupEnv("SHELL")
-	switchToUse := "-c"
-
-	if !ok {
-		if runtime.GOOS == "windows" {
-			shellToUse = "powershell.exe"
-			switchToUse = "-Command"
-		} else {
-			shellToUse = "/bin/bash"
-		}
+	if isUnderHomebrew() {
+		cmd := exec.Command("brew", "upgrade", projectName)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.Stdin = stdin
+		return cmd.Run()
 	}
 
-	command := updateCommand(projectName)
-
-	cmd := exec.Command(shellToUse, switchToUse, command)
+	// download the install script ourselves rather than piping curl to the
+	// shell, so that the download is reported
+	script, err := downloadScript(ctx, installScriptURL(projectName), p)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", "-s")
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("powershell.exe", "-Command", "-")
+	}
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
-	cmd.Stdin = stdin
+	cmd.Stdin = bytes.NewReader(script)
 	return cmd.Run()
 }
 
+func downloadScript(ctx context.Context, url string, p *progress.Reporter) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading install script: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading install script: unexpected status %s", res.Status)
+	}
+	if res.ContentLength > 0 {
+		p.Grow(res.ContentLength)
+	}
+	script, err := io.ReadAll(p.Reader(res.Body))
+	if err != nil {
+		return nil, fmt.Errorf("downloading install script: %w", err)
+	}
+	p.Done()
+	return script, nil
+}
+
 func isUnderHomebrew() bool {
 	binary, err := os.Executable()
 	if err != nil {
@@ -62,19 +93,14 @@ func isUnderHomebrew() bool {
 	return strings.HasPrefix(binary, brewBinPrefix)
 }
 
-func updateCommand(projectName string) string {
-	if isUnderHomebrew() {
-		return "brew upgrade " + projectName
-	}
-
+func installScriptURL(projectName string) string {
 	if runtime.GOOS == "windows" {
-		return "iwr https://humanlog.io/install.ps1 -useb | iex"
-	} else {
-		if projectName == "apictl" {
-			return `curl -L "https://humanlog.io/install_apictl.sh" | sh`
-		}
-		return `curl -L "https://humanlog.io/install.sh" | sh`
+		return "https://humanlog.io/install.ps1"
+	}
+	if projectName == "apictl" {
+		return "https://humanlog.io/install_apictl.sh"
 	}
+	return "https://humanlog.io/install.sh"
 }
 
 // can't replace binary on windows, need to move
@@ -0,0 +1,215 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	kdfNone   = [2]byte{0, 0}
+	kdfScrypt = [2]byte{'S', 'c'}
+	chkBlake2 = [2]byte{'B', '2'}
+)
+
+const (
+	// same defaults as minisign
+	scryptOpsLimit = 33554432
+	scryptMemLimit = 1073741824
+
+	keynumSKSize  = 8 + ed25519.PrivateKeySize + blake2b.Size256
+	secretKeySize = 2 + 2 + 2 + 32 + 8 + 8 + keynumSKSize
+)
+
+type SecretKey struct {
+	KeyID KeyID
+	Key   ed25519.PrivateKey
+}
+
+// GenerateKey creates a new key pair.
+func GenerateKey() (*SecretKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sk := &SecretKey{Key: key}
+	if _, err := io.ReadFull(rand.Reader, sk.KeyID[:]); err != nil {
+		return nil, err
+	}
+	return sk, nil
+}
+
+func (sk *SecretKey) Public() *PublicKey {
+	return &PublicKey{KeyID: sk.KeyID, Key: sk.Key.Public().(ed25519.PublicKey)}
+}
+
+// Marshal encodes the key as the content of a minisign secret key file. The
+// key is encrypted if a password is given.
+func (sk *SecretKey) Marshal(password []byte) (string, error) {
+	raw := make([]byte, 0, secretKeySize)
+	raw = append(raw, algPure[:]...)
+	kdf := kdfNone
+	if len(password) > 0 {
+		kdf = kdfScrypt
+	}
+	raw = append(raw, kdf[:]...)
+	raw = append(raw, chkBlake2[:]...)
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	raw = append(raw, salt...)
+	var opsLimit, memLimit uint64
+	if kdf == kdfScrypt {
+		opsLimit, memLimit = scryptOpsLimit, scryptMemLimit
+	}
+	raw = binary.LittleEndian.AppendUint64(raw, opsLimit)
+	raw = binary.LittleEndian.AppendUint64(raw, memLimit)
+
+	keynum := make([]byte, 0, keynumSKSize)
+	keynum = append(keynum, sk.KeyID[:]...)
+	keynum = append(keynum, sk.Key...)
+	keynum = append(keynum, sk.checksum()...)
+	if kdf == kdfScrypt {
+		stream, err := deriveStream(password, salt, opsLimit, memLimit)
+		if err != nil {
+			return "", err
+		}
+		subtle.XORBytes(keynum, keynum, stream)
+	}
+	raw = append(raw, keynum...)
+	return untrustedCommentPrefix + "minisign encrypted secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n", nil
+}
+
+// ParseSecretKey reads the content of a minisign secret key file. `password`
+// is only called if the key is encrypted.
+func ParseSecretKey(s string, password func() ([]byte, error)) (*SecretKey, error) {
+	_, line, err := splitComment(s)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("decoding secret key: %w", err)
+	}
+	if len(raw) != secretKeySize {
+		return nil, fmt.Errorf("secret key has invalid length %d", len(raw))
+	}
+	if !bytes.Equal(raw[0:2], algPure[:]) {
+		return nil, fmt.Errorf("unsupported secret key algorithm %q", raw[0:2])
+	}
+	if !bytes.Equal(raw[4:6], chkBlake2[:]) {
+		return nil, fmt.Errorf("unsupported secret key checksum algorithm %q", raw[4:6])
+	}
+	var (
+		salt     = raw[6:38]
+		opsLimit = binary.LittleEndian.Uint64(raw[38:46])
+		memLimit = binary.LittleEndian.Uint64(raw[46:54])
+		keynum   = append([]byte{}, raw[54:]...)
+	)
+	switch [2]byte(raw[2:4]) {
+	case kdfNone:
+	case kdfScrypt:
+		pwd, err := password()
+		if err != nil {
+			return nil, fmt.Errorf("getting password: %w", err)
+		}
+		stream, err := deriveStream(pwd, salt, opsLimit, memLimit)
+		if err != nil {
+			return nil, err
+		}
+		subtle.XORBytes(keynum, keynum, stream)
+	default:
+		return nil, fmt.Errorf("unsupported secret key kdf %q", raw[2:4])
+	}
+	sk := &SecretKey{Key: ed25519.PrivateKey(keynum[8 : 8+ed25519.PrivateKeySize])}
+	copy(sk.KeyID[:], keynum[:8])
+	if subtle.ConstantTimeCompare(sk.checksum(), keynum[8+ed25519.PrivateKeySize:]) != 1 {
+		return nil, fmt.Errorf("secret key checksum doesn't match, wrong password?")
+	}
+	return sk, nil
+}
+
+func (sk *SecretKey) checksum() []byte {
+	h, err := blake2b.New256(nil)
+	if err != nil {
+		panic(err)
+	}
+	h.Write(algPure[:])
+	h.Write(sk.KeyID[:])
+	h.Write(sk.Key)
+	return h.Sum(nil)
+}
+
+// DefaultTrustedComment is the trusted comment minisign would use for a file.
+func DefaultTrustedComment(filename string) string {
+	return fmt.Sprintf("timestamp:%d\tfile:%s\thashed", time.Now().Unix(), filepath.Base(filename))
+}
+
+// Sign produces a prehashed signature of the content of `r`, like minisign
+// does by default.
+func (sk *SecretKey) Sign(r io.Reader, trustedComment string) (*Signature, error) {
+	h := newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	sig := &Signature{
+		UntrustedComment: "signature from apictl secret key",
+		Algorithm:        algHashed,
+		KeyID:            sk.KeyID,
+		Signature:        ed25519.Sign(sk.Key, h.Sum(nil)),
+		TrustedComment:   trustedComment,
+	}
+	global := append(append([]byte{}, sig.Signature...), trustedComment...)
+	sig.GlobalSignature = ed25519.Sign(sk.Key, global)
+	return sig, nil
+}
+
+func deriveStream(password, salt []byte, opsLimit, memLimit uint64) ([]byte, error) {
+	logN, r, p := scryptParams(opsLimit, memLimit)
+	stream, err := scrypt.Key(password, salt, 1<<logN, r, p, keynumSKSize)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key from password: %w", err)
+	}
+	return stream, nil
+}
+
+// scryptParams mirrors libsodium's `pickparams`, which minisign relies on to
+// turn its limits into scrypt parameters.
+func scryptParams(opsLimit, memLimit uint64) (logN uint, r, p int) {
+	if opsLimit < 32768 {
+		opsLimit = 32768
+	}
+	r = 8
+	var maxN uint64
+	if opsLimit < memLimit/32 {
+		p = 1
+		maxN = opsLimit / uint64(r*4)
+	} else {
+		maxN = memLimit / uint64(r*128)
+	}
+	for logN = 1; logN < 63; logN++ {
+		if uint64(1)<<logN > maxN/2 {
+			break
+		}
+	}
+	if opsLimit >= memLimit/32 {
+		maxrp := (opsLimit / 4) / (uint64(1) << logN)
+		if maxrp > 0x3fffffff {
+			maxrp = 0x3fffffff
+		}
+		p = int(maxrp) / r
+	}
+	return logN, r, p
+}
@@ -0,0 +1,229 @@
+// Package signing reads and writes ed25519 signatures in the format used by
+// minisign (https://jedisct1.github.io/minisign/).
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	untrustedCommentPrefix = "untrusted comment: "
+	trustedCommentPrefix   = "trusted comment: "
+)
+
+var (
+	// algPure signs the message itself, and is what old minisign versions
+	// produce.
+	algPure = [2]byte{'E', 'd'}
+	// algHashed signs the BLAKE2b-512 of the message.
+	algHashed = [2]byte{'E', 'D'}
+)
+
+// KeyID identifies a key pair.
+type KeyID [8]byte
+
+// String formats the key ID the way minisign prints it.
+func (id KeyID) String() string {
+	return strings.ToUpper(fmt.Sprintf("%016x", binary.LittleEndian.Uint64(id[:])))
+}
+
+type PublicKey struct {
+	KeyID KeyID
+	Key   ed25519.PublicKey
+}
+
+// ParsePublicKey reads a public key, either as the content of a minisign
+// `.pub` file or as its bare base64 line.
+func ParsePublicKey(s string) (*PublicKey, error) {
+	_, line, err := splitComment(s)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key has invalid length %d", len(raw))
+	}
+	if !bytes.Equal(raw[:2], algPure[:]) {
+		return nil, fmt.Errorf("unsupported public key algorithm %q", raw[:2])
+	}
+	pk := &PublicKey{Key: ed25519.PublicKey(raw[10:])}
+	copy(pk.KeyID[:], raw[2:10])
+	return pk, nil
+}
+
+// LoadPublicKey reads a public key from `s`, or from the file at path `s` if
+// it isn't a public key itself.
+func LoadPublicKey(s string) (*PublicKey, error) {
+	pk, err := ParsePublicKey(s)
+	if err == nil {
+		return pk, nil
+	}
+	data, rerr := os.ReadFile(s)
+	if rerr != nil {
+		return nil, fmt.Errorf("not a public key (%v), nor a readable file: %w", err, rerr)
+	}
+	return ParsePublicKey(string(data))
+}
+
+func (pk *PublicKey) String() string {
+	raw := make([]byte, 0, 2+8+ed25519.PublicKeySize)
+	raw = append(raw, algPure[:]...)
+	raw = append(raw, pk.KeyID[:]...)
+	raw = append(raw, pk.Key...)
+	return untrustedCommentPrefix + "minisign public key " + pk.KeyID.String() + "\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+// Signature is the content of a minisign `.sig` file.
+type Signature struct {
+	UntrustedComment string
+	Algorithm        [2]byte
+	KeyID            KeyID
+	Signature        []byte
+	TrustedComment   string
+	// GlobalSignature signs the signature and the trusted comment.
+	GlobalSignature []byte
+}
+
+// ParseSignature reads the content of a minisign `.sig` file.
+func ParseSignature(s string) (*Signature, error) {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n")), "\n")
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("signature should have 4 lines, has %d", len(lines))
+	}
+	sig := new(Signature)
+	var ok bool
+	if sig.UntrustedComment, ok = strings.CutPrefix(lines[0], untrustedCommentPrefix); !ok {
+		return nil, fmt.Errorf("signature doesn't start with an untrusted comment")
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %w", err)
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("signature has invalid length %d", len(raw))
+	}
+	copy(sig.Algorithm[:], raw[:2])
+	if sig.Algorithm != algPure && sig.Algorithm != algHashed {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", raw[:2])
+	}
+	copy(sig.KeyID[:], raw[2:10])
+	sig.Signature = raw[10:]
+	if sig.TrustedComment, ok = strings.CutPrefix(lines[2], trustedCommentPrefix); !ok {
+		return nil, fmt.Errorf("signature has no trusted comment")
+	}
+	if sig.GlobalSignature, err = base64.StdEncoding.DecodeString(lines[3]); err != nil {
+		return nil, fmt.Errorf("decoding global signature: %w", err)
+	}
+	if len(sig.GlobalSignature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("global signature has invalid length %d", len(sig.GlobalSignature))
+	}
+	return sig, nil
+}
+
+func (sig *Signature) String() string {
+	raw := make([]byte, 0, 2+8+ed25519.SignatureSize)
+	raw = append(raw, sig.Algorithm[:]...)
+	raw = append(raw, sig.KeyID[:]...)
+	raw = append(raw, sig.Signature...)
+	return untrustedCommentPrefix + sig.UntrustedComment + "\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		trustedCommentPrefix + sig.TrustedComment + "\n" +
+		base64.StdEncoding.EncodeToString(sig.GlobalSignature) + "\n"
+}
+
+// Verifier checks a signature against the content written to it.
+type Verifier struct {
+	pk  *PublicKey
+	sig *Signature
+	h   hash.Hash
+	buf *bytes.Buffer
+}
+
+// NewVerifier prepares to check `sig` against the content that will be
+// written to the verifier.
+func NewVerifier(pk *PublicKey, sig *Signature) (*Verifier, error) {
+	if pk.KeyID != sig.KeyID {
+		return nil, fmt.Errorf("signature was made with key %s, not %s", sig.KeyID, pk.KeyID)
+	}
+	v := &Verifier{pk: pk, sig: sig}
+	if sig.Algorithm == algHashed {
+		v.h = newHash()
+	} else {
+		v.buf = new(bytes.Buffer)
+	}
+	return v, nil
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	if v.h != nil {
+		return v.h.Write(p)
+	}
+	return v.buf.Write(p)
+}
+
+// Verify checks the signature against everything that was written.
+func (v *Verifier) Verify() error {
+	var msg []byte
+	if v.h != nil {
+		msg = v.h.Sum(nil)
+	} else {
+		msg = v.buf.Bytes()
+	}
+	if !ed25519.Verify(v.pk.Key, msg, v.sig.Signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	global := append(append([]byte{}, v.sig.Signature...), v.sig.TrustedComment...)
+	if !ed25519.Verify(v.pk.Key, global, v.sig.GlobalSignature) {
+		return fmt.Errorf("invalid global signature, the trusted comment was tampered with")
+	}
+	return nil
+}
+
+// Verify checks `sig` against the content of `r`.
+func Verify(pk *PublicKey, r io.Reader, sig *Signature) error {
+	v, err := NewVerifier(pk, sig)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(v, r); err != nil {
+		return err
+	}
+	return v.Verify()
+}
+
+func newHash() hash.Hash {
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+func splitComment(s string) (comment, line string, err error) {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n")), "\n")
+	switch len(lines) {
+	case 1:
+		return "", strings.TrimSpace(lines[0]), nil
+	case 2:
+		comment, ok := strings.CutPrefix(lines[0], untrustedCommentPrefix)
+		if !ok {
+			return "", "", fmt.Errorf("first line isn't an untrusted comment")
+		}
+		return comment, strings.TrimSpace(lines[1]), nil
+	}
+	return "", "", fmt.Errorf("expected 1 or 2 lines, got %d", len(lines))
+}
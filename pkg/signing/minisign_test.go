@@ -0,0 +1,224 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func generateKey(t *testing.T) *SecretKey {
+	t.Helper()
+	sk, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk
+}
+
+func TestKeyIDString(t *testing.T) {
+	id := KeyID{0xef, 0xcd, 0xab, 0x89, 0x67, 0x45, 0x23, 0x01}
+	if got, want := id.String(), "0123456789ABCDEF"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pk := generateKey(t).Public()
+	line := strings.Split(pk.String(), "\n")[1]
+	wrongAlg, _ := base64.StdEncoding.DecodeString(line)
+	copy(wrongAlg, "ED")
+
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{name: "pub file", in: pk.String()},
+		{name: "bare line", in: line},
+		{name: "crlf", in: strings.ReplaceAll(pk.String(), "\n", "\r\n")},
+		{name: "bad comment", in: "comment\n" + line, wantErr: "isn't an untrusted comment"},
+		{name: "too many lines", in: pk.String() + "more\n", wantErr: "expected 1 or 2 lines, got 3"},
+		{name: "bad base64", in: "not base64!", wantErr: "decoding public key"},
+		{name: "too short", in: base64.StdEncoding.EncodeToString([]byte("Ed1234")), wantErr: "invalid length 6"},
+		{name: "wrong algorithm", in: base64.StdEncoding.EncodeToString(wrongAlg), wantErr: `unsupported public key algorithm "ED"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePublicKey(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v doesn't contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.KeyID != pk.KeyID || !got.Key.Equal(pk.Key) {
+				t.Errorf("got key %s, want %s", got.KeyID, pk.KeyID)
+			}
+		})
+	}
+}
+
+func TestLoadPublicKey(t *testing.T) {
+	pk := generateKey(t).Public()
+	path := filepath.Join(t.TempDir(), "key.pub")
+	if err := os.WriteFile(path, []byte(pk.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []string{pk.String(), path} {
+		got, err := LoadPublicKey(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.KeyID != pk.KeyID {
+			t.Errorf("LoadPublicKey(%q) has key %s, want %s", in, got.KeyID, pk.KeyID)
+		}
+	}
+	if _, err := LoadPublicKey(filepath.Join(t.TempDir(), "missing.pub")); err == nil {
+		t.Error("want an error for a missing file")
+	}
+}
+
+func TestSecretKeyRoundTrip(t *testing.T) {
+	sk := generateKey(t)
+	s, err := sk.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := func() ([]byte, error) {
+		t.Fatal("password asked for an unencrypted key")
+		return nil, nil
+	}
+	got, err := ParseSecretKey(s, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.KeyID != sk.KeyID || !got.Key.Equal(sk.Key) {
+		t.Errorf("got key %s, want %s", got.KeyID, sk.KeyID)
+	}
+
+	// flip a bit of the private key, which the checksum catches
+	lines := strings.Split(s, "\n")
+	raw, _ := base64.StdEncoding.DecodeString(lines[1])
+	raw[54+8] ^= 1
+	lines[1] = base64.StdEncoding.EncodeToString(raw)
+	if _, err := ParseSecretKey(strings.Join(lines, "\n"), password); err == nil || !strings.Contains(err.Error(), "checksum doesn't match") {
+		t.Errorf("corrupted key: error %v, want a checksum mismatch", err)
+	}
+}
+
+func TestScryptParams(t *testing.T) {
+	// what libsodium picks for minisign's limits
+	logN, r, p := scryptParams(scryptOpsLimit, scryptMemLimit)
+	if logN != 20 || r != 8 || p != 1 {
+		t.Errorf("scryptParams() = %d, %d, %d, want 20, 8, 1", logN, r, p)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	sk := generateKey(t)
+	content := "some release archive"
+	sig, err := sk.Sign(strings.NewReader(content), "timestamp:1\tfile:archive.tar.gz\thashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSignature(sig.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != sig.String() {
+		t.Errorf("signature doesn't round trip:\n%s\nwant:\n%s", parsed, sig)
+	}
+
+	// minisign's legacy mode signs the content itself
+	pure := &Signature{
+		Algorithm:      algPure,
+		KeyID:          sk.KeyID,
+		Signature:      ed25519.Sign(sk.Key, []byte(content)),
+		TrustedComment: "legacy",
+	}
+	pure.GlobalSignature = ed25519.Sign(sk.Key, append(append([]byte{}, pure.Signature...), pure.TrustedComment...))
+
+	tampered := *parsed
+	tampered.TrustedComment = "timestamp:2\tfile:other.tar.gz\thashed"
+
+	tests := []struct {
+		name    string
+		pk      *PublicKey
+		content string
+		sig     *Signature
+		wantErr string
+	}{
+		{name: "valid", pk: sk.Public(), content: content, sig: parsed},
+		{name: "valid legacy", pk: sk.Public(), content: content, sig: pure},
+		{name: "other content", pk: sk.Public(), content: content + ".", sig: parsed, wantErr: "invalid signature"},
+		{name: "other content legacy", pk: sk.Public(), content: content + ".", sig: pure, wantErr: "invalid signature"},
+		{name: "trusted comment tampered with", pk: sk.Public(), content: content, sig: &tampered, wantErr: "invalid global signature"},
+		{name: "other key", pk: generateKey(t).Public(), content: content, sig: parsed, wantErr: "signature was made with key " + sk.KeyID.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.pk, strings.NewReader(tt.content), tt.sig)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("error %v doesn't contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	sig, err := generateKey(t).Sign(strings.NewReader("content"), "comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(sig.String()), "\n")
+	with := func(i int, line string) string {
+		out := append([]string{}, lines...)
+		out[i] = line
+		return strings.Join(out, "\n")
+	}
+	raw, _ := base64.StdEncoding.DecodeString(lines[1])
+	raw[0], raw[1] = 'X', 'X'
+
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{name: "valid", in: sig.String()},
+		{name: "crlf", in: strings.ReplaceAll(sig.String(), "\n", "\r\n")},
+		{name: "missing lines", in: strings.Join(lines[:3], "\n"), wantErr: "should have 4 lines, has 3"},
+		{name: "no untrusted comment", in: with(0, "comment"), wantErr: "doesn't start with an untrusted comment"},
+		{name: "bad base64", in: with(1, "not base64!"), wantErr: "decoding signature"},
+		{name: "too short", in: with(1, base64.StdEncoding.EncodeToString([]byte("ED"))), wantErr: "invalid length 2"},
+		{name: "unsupported algorithm", in: with(1, base64.StdEncoding.EncodeToString(raw)), wantErr: `unsupported signature algorithm "XX"`},
+		{name: "no trusted comment", in: with(2, "comment"), wantErr: "has no trusted comment"},
+		{name: "bad global signature", in: with(3, "not base64!"), wantErr: "decoding global signature"},
+		{name: "short global signature", in: with(3, base64.StdEncoding.EncodeToString([]byte("sig"))), wantErr: "global signature has invalid length 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSignature(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v doesn't contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.TrustedComment != "comment" || got.KeyID != sig.KeyID {
+				t.Errorf("got %+v, want %+v", got, sig)
+			}
+		})
+	}
+}
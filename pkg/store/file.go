@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/humanlogio/apictl/pkg/bucket"
+)
+
+// FileStore keeps objects as files in a directory, meant to be served over
+// HTTP at PublicURL.
+type FileStore struct {
+	Dir       string
+	PublicURL string
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), readerWithContext(ctx, opts.Progress.Reader(r)))
+	if err != nil {
+		return fmt.Errorf("writing %q: %w", key, err)
+	}
+	if opts.Size >= 0 && n != opts.Size {
+		return fmt.Errorf("got %d bytes for %q instead of %d", n, key, opts.Size)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); opts.Sha256 != "" && got != opts.Sha256 {
+		return fmt.Errorf("content of %q hashes to %s instead of %s", key, got, opts.Sha256)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if opts.IfAbsent {
+		// unlike renames, links don't replace existing files
+		if err := os.Link(tmp.Name(), dst); errors.Is(err, fs.ErrExist) {
+			return ErrExists
+		} else if err != nil {
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrNotExist
+	} else if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		f.Close()
+		if err == nil {
+			err = ErrNotExist
+		}
+		return nil, nil, err
+	}
+	return f, &Object{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  bucket.ContentType(key),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+func (s *FileStore) Head(ctx context.Context, key string) (*Object, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, ErrNotExist
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("hashing %q: %w", key, err)
+	}
+	return &Object{
+		Key:          key,
+		Size:         fi.Size(),
+		Sha256:       hex.EncodeToString(h.Sum(nil)),
+		ContentType:  bucket.ContentType(key),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	var out []Object
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, Object{Key: key, Size: fi.Size(), LastModified: fi.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return out, err
+}
+
+func (s *FileStore) URL(key string) string {
+	return joinURL(s.PublicURL, key)
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func readerWithContext(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, r: r}
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	st := &FileStore{Dir: filepath.Join(t.TempDir(), "bins")}
+	testStore(t, st)
+
+	ctx := context.Background()
+	if obj, err := st.Head(ctx, "0.1.0/linux.tar.gz"); err != nil || obj.Sha256 != sha256Hex("linux archive") {
+		t.Errorf("got head %+v, %v", obj, err)
+	}
+	for _, tt := range []struct {
+		key, content string
+		opts         PutOptions
+		wantErr      string
+	}{
+		{key: "../escape.tar.gz", content: "x", opts: PutOptions{Size: 1}, wantErr: `invalid key "../escape.tar.gz"`},
+		{key: "a//b.tar.gz", content: "x", opts: PutOptions{Size: 1}, wantErr: "invalid key"},
+		{key: "short.tar.gz", content: "x", opts: PutOptions{Size: 2}, wantErr: "got 1 bytes"},
+		{key: "bad.tar.gz", content: "x", opts: PutOptions{Size: 1, Sha256: sha256Hex("y")}, wantErr: "hashes to"},
+	} {
+		if err := st.Put(ctx, tt.key, strings.NewReader(tt.content), tt.opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("put %q: error %v, want %q", tt.key, err, tt.wantErr)
+		}
+	}
+	// failed puts leave nothing behind, not even temporary files
+	entries, err := os.ReadDir(st.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			t.Errorf("left %q behind", e.Name())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(st.Dir), "escape.tar.gz")); err == nil {
+		t.Error("put a file outside of the store")
+	}
+}
@@ -0,0 +1,261 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPStore keeps objects on a server that accepts PUT, like WebDAV servers
+// do. Listing relies on WebDAV's PROPFIND.
+type HTTPStore struct {
+	BaseURL   string
+	PublicURL string
+	Token     string
+	Client    *http.Client
+}
+
+func (s *HTTPStore) do(ctx context.Context, method, key string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.BaseURL+"/"+escapeKey(key), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	return s.Client.Do(req)
+}
+
+func (s *HTTPStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	// WebDAV servers need the collections to exist, other servers will
+	// just refuse MKCOL
+	dir := ""
+	for _, part := range strings.Split(path.Dir(key), "/") {
+		if part == "." {
+			break
+		}
+		dir = path.Join(dir, part)
+		res, err := s.do(ctx, "MKCOL", dir+"/", nil, nil)
+		if err != nil {
+			return fmt.Errorf("creating collection %q: %w", dir, err)
+		}
+		res.Body.Close()
+	}
+
+	header := http.Header{}
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	if opts.CacheControl != "" {
+		header.Set("Cache-Control", opts.CacheControl)
+	}
+	if opts.IfAbsent {
+		header.Set("If-None-Match", "*")
+	}
+	if raw, err := hex.DecodeString(opts.Sha256); err == nil && len(raw) == sha256.Size {
+		header.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(raw))
+	}
+	h := sha256.New()
+	body := &hashingReader{r: opts.Progress.Reader(r), h: h}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.BaseURL+"/"+escapeKey(key), body)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	if opts.Size >= 0 {
+		req.ContentLength = opts.Size
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("putting %q: %w", key, err)
+	}
+	defer res.Body.Close()
+	if opts.IfAbsent && res.StatusCode == http.StatusPreconditionFailed {
+		return ErrExists
+	} else if res.StatusCode/100 != 2 {
+		return fmt.Errorf("putting %q: %s", key, res.Status)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); opts.Sha256 != "" && got != opts.Sha256 {
+		err := fmt.Errorf("content of %q hashes to %s instead of %s", key, got, opts.Sha256)
+		if derr := s.Delete(ctx, key); derr != nil {
+			err = fmt.Errorf("%w, and deleting it failed: %v", err, derr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *HTTPStore) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting %q: %w", key, err)
+	}
+	obj, err := objectOf(key, res)
+	if err != nil {
+		res.Body.Close()
+		return nil, nil, err
+	}
+	return res.Body, obj, nil
+}
+
+func (s *HTTPStore) Head(ctx context.Context, key string) (*Object, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting %q: %w", key, err)
+	}
+	res.Body.Close()
+	return objectOf(key, res)
+}
+
+func objectOf(key string, res *http.Response) (*Object, error) {
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, ErrNotExist
+	case res.StatusCode/100 != 2:
+		return nil, fmt.Errorf("getting %q: %s", key, res.Status)
+	}
+	obj := &Object{Key: key, Size: res.ContentLength, ContentType: res.Header.Get("Content-Type")}
+	if lm, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		obj.LastModified = lm
+	}
+	return obj, nil
+}
+
+func (s *HTTPStore) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return fmt.Errorf("deleting %q: %w", key, err)
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrNotExist
+	case res.StatusCode/100 != 2:
+		return fmt.Errorf("deleting %q: %s", key, res.Status)
+	}
+	return nil
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"DAV: href"`
+		Prop struct {
+			ResourceType struct {
+				Collection *struct{} `xml:"DAV: collection"`
+			} `xml:"DAV: resourcetype"`
+			ContentLength string `xml:"DAV: getcontentlength"`
+			LastModified  string `xml:"DAV: getlastmodified"`
+		} `xml:"DAV: propstat>prop"`
+	} `xml:"DAV: response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+// List walks the collections of the server with PROPFIND, one level at a
+// time since many servers refuse infinite depth.
+func (s *HTTPStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	base, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	basePath := strings.TrimSuffix(base.Path, "/") + "/"
+	var (
+		out  []Object
+		walk func(dir string) error
+	)
+	walk = func(dir string) error {
+		res, err := s.do(ctx, "PROPFIND", dir, strings.NewReader(propfindBody), http.Header{
+			"Depth":        {"1"},
+			"Content-Type": {"application/xml"},
+		})
+		if err != nil {
+			return fmt.Errorf("listing %q: %w", dir, err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		if res.StatusCode != http.StatusMultiStatus {
+			return fmt.Errorf("listing %q: %s, is this a WebDAV server?", dir, res.Status)
+		}
+		ms := new(multistatus)
+		if err := xml.NewDecoder(res.Body).Decode(ms); err != nil {
+			return fmt.Errorf("decoding listing of %q: %w", dir, err)
+		}
+		for _, r := range ms.Responses {
+			href, err := url.Parse(r.Href)
+			if err != nil {
+				return fmt.Errorf("listing %q: invalid href %q", dir, r.Href)
+			}
+			key, ok := strings.CutPrefix(href.Path, basePath)
+			if !ok {
+				continue
+			}
+			if r.Prop.ResourceType.Collection != nil {
+				key = strings.TrimSuffix(key, "/")
+				if key == strings.TrimSuffix(dir, "/") {
+					continue
+				}
+				if p := strings.TrimSuffix(prefix, "/"); !strings.HasPrefix(key, p) && !strings.HasPrefix(p, key) {
+					continue
+				}
+				if err := walk(key + "/"); err != nil {
+					return err
+				}
+				continue
+			}
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			obj := Object{Key: key}
+			obj.Size, _ = strconv.ParseInt(r.Prop.ContentLength, 10, 64)
+			obj.LastModified, _ = time.Parse(http.TimeFormat, r.Prop.LastModified)
+			out = append(out, obj)
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *HTTPStore) URL(key string) string {
+	if s.PublicURL != "" {
+		return joinURL(s.PublicURL, key)
+	}
+	return s.BaseURL + "/" + escapeKey(key)
+}
+
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	return n, err
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// davHandler is just enough of WebDAV to store objects in a directory under
+// /dav/.
+type davHandler struct {
+	dir   string
+	token string
+}
+
+func (h *davHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+h.token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rel, ok := strings.CutPrefix(r.URL.Path, "/dav/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	p := filepath.Join(h.dir, filepath.FromSlash(rel))
+	switch r.Method {
+	case "MKCOL":
+		if err := os.Mkdir(p, 0o755); errors.Is(err, os.ErrExist) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodPut:
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if r.Header.Get("If-None-Match") == "*" {
+			flags |= os.O_EXCL
+		}
+		f, err := os.OpenFile(p, flags, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		defer f.Close()
+		io.Copy(f, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if fi, err := os.Stat(p); err != nil || fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, p)
+	case http.MethodDelete:
+		if err := os.Remove(p); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:">`)
+		fmt.Fprintf(w, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop></D:propstat></D:response>`, r.URL.EscapedPath())
+		for _, e := range entries {
+			href := (&url.URL{Path: path.Join("/dav", rel, e.Name())}).EscapedPath()
+			if e.IsDir() {
+				fmt.Fprintf(w, `<D:response><D:href>%s/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop></D:propstat></D:response>`, href)
+				continue
+			}
+			fi, _ := e.Info()
+			fmt.Fprintf(w, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontentlength>%d</D:getcontentlength><D:getlastmodified>%s</D:getlastmodified></D:prop></D:propstat></D:response>`,
+				href, fi.Size(), fi.ModTime().UTC().Format(http.TimeFormat))
+		}
+		fmt.Fprint(w, `</D:multistatus>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPStore(t *testing.T) {
+	h := &davHandler{dir: t.TempDir(), token: "secret"}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	st, err := Open(srv.URL+"/dav/", Options{Token: "secret", HTTPClient: srv.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, st)
+	if _, err := os.Stat(filepath.Join(h.dir, "0.1.0", "linux.tar.gz")); err != nil {
+		t.Errorf("object isn't in the collection: %v", err)
+	}
+	if got, want := st.URL("0.1.0/linux amd64.tar.gz"), srv.URL+"/dav/0.1.0/linux%20amd64.tar.gz"; got != want {
+		t.Errorf("url %q, want %q", got, want)
+	}
+
+	// the server may only find out about a bad upload once it has it all
+	err = st.Put(context.Background(), "bad.tar.gz", strings.NewReader("archive"), PutOptions{Size: 7, Sha256: sha256Hex("other")})
+	if err == nil || !strings.Contains(err.Error(), "hashes to") {
+		t.Errorf("error %v, want a hash mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(h.dir, "bad.tar.gz")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("bad upload wasn't deleted: %v", err)
+	}
+
+	unauthorized := &HTTPStore{BaseURL: srv.URL + "/dav", Client: srv.Client()}
+	if _, err := unauthorized.Head(context.Background(), "0.1.0/linux.tar.gz"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("error %v, want a 401", err)
+	}
+}
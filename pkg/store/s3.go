@@ -0,0 +1,181 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/humanlogio/apictl/pkg/bucket"
+)
+
+// S3Store keeps objects in a bucket, under a prefix.
+type S3Store struct {
+	Client    *s3.Client
+	Bucket    string
+	Prefix    string
+	ACL       string
+	PublicURL string
+	PartSize  int64
+	// PartConcurrency is how many parts of a file are uploaded at once,
+	// 4 if zero.
+	PartConcurrency int
+	// StatePath is where multipart progress of a local file is saved,
+	// bucket.StatePathFor if nil.
+	StatePath func(path string) string
+}
+
+func (s *S3Store) objectKey(key string) string {
+	if s.Prefix == "" {
+		return key
+	}
+	return path.Join(s.Prefix, key)
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	putter := &bucket.Putter{
+		Client:          s.Client,
+		Bucket:          s.Bucket,
+		ACL:             s.ACL,
+		CacheControl:    opts.CacheControl,
+		ContentType:     opts.ContentType,
+		PartSize:        s.PartSize,
+		PartConcurrency: cmp.Or(s.PartConcurrency, 4),
+		StatePath:       s.StatePath,
+		Progress:        opts.Progress,
+		Sha256:          opts.Sha256,
+	}
+	if putter.StatePath == nil {
+		putter.StatePath = bucket.StatePathFor
+	}
+	if f, ok := r.(*os.File); ok {
+		// local files can be uploaded in parallel and resumed
+		put := putter.Put
+		if opts.IfAbsent {
+			put = putter.PutIfAbsent
+		}
+		res, err := put(ctx, f.Name(), s.objectKey(key))
+		if errors.As(err, new(*bucket.ObjectConflictError)) {
+			return errors.Join(ErrExists, err)
+		} else if err != nil {
+			return err
+		}
+		if res.Existed {
+			return ErrExists
+		}
+		return nil
+	}
+	input := putter.Input(key, s.objectKey(key))
+	if opts.Sha256 != "" {
+		input.Metadata = map[string]string{bucket.Sha256MetadataKey: opts.Sha256}
+	}
+	if opts.IfAbsent {
+		input.IfNoneMatch = aws.String("*")
+	}
+	size, checksum, err := bucket.PutStream(ctx, s.Client, input, opts.Progress.Reader(r), s.PartSize, opts.Sha256)
+	if opts.IfAbsent && bucket.IsPreconditionFailed(err) {
+		return ErrExists
+	} else if err != nil {
+		return err
+	}
+	return bucket.VerifyObject(ctx, s.Client, s.Bucket, s.objectKey(key), size, checksum)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	res, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	if bucket.IsNotFound(err) {
+		return nil, nil, ErrNotExist
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("getting object %q: %w", key, err)
+	}
+	return res.Body, &Object{
+		Key:          key,
+		Size:         aws.ToInt64(res.ContentLength),
+		Sha256:       res.Metadata[bucket.Sha256MetadataKey],
+		ContentType:  aws.ToString(res.ContentType),
+		LastModified: aws.ToTime(res.LastModified),
+	}, nil
+}
+
+func (s *S3Store) Head(ctx context.Context, key string) (*Object, error) {
+	head, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(s.Bucket),
+		Key:          aws.String(s.objectKey(key)),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if bucket.IsNotFound(err) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("getting object %q: %w", key, err)
+	}
+	obj := &Object{
+		Key:          key,
+		Size:         aws.ToInt64(head.ContentLength),
+		ContentType:  aws.ToString(head.ContentType),
+		LastModified: aws.ToTime(head.LastModified),
+		Sha256:       bucket.ObjectSha256(head),
+	}
+	return obj, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if _, err := s.Head(ctx, key); err != nil {
+		return err
+	}
+	_, err := s.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("deleting object %q: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	listPrefix := prefix
+	if s.Prefix != "" {
+		listPrefix = s.Prefix + "/" + prefix
+	}
+	objects, err := bucket.ListObjects(ctx, s.Client, s.Bucket, listPrefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Object, 0, len(objects))
+	for _, obj := range objects {
+		key := aws.ToString(obj.Key)
+		if s.Prefix != "" {
+			key = strings.TrimPrefix(key, s.Prefix+"/")
+		}
+		out = append(out, Object{
+			Key:          key,
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+	return out, nil
+}
+
+func (s *S3Store) URL(key string) string {
+	return joinURL(s.PublicURL, key)
+}
+
+// Presign returns a URL to GET an object, valid for `expiry`.
+func (s *S3Store) Presign(ctx context.Context, key string, expiry time.Duration) (string, time.Time, error) {
+	return bucket.Presign(ctx, s.Client, s.Bucket, s.objectKey(key), expiry)
+}
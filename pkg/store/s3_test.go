@@ -0,0 +1,185 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/humanlogio/apictl/pkg/bucket"
+)
+
+const testBucket = "bins"
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeS3 keeps whole objects of a path style bucket, without multipart
+// uploads.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+	calls    []string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *s3.Client) {
+	f := &fakeS3{objects: make(map[string][]byte), metadata: make(map[string]map[string]string)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		Retryer:      aws.NopRetryer{},
+		HTTPClient:   srv.Client(),
+	})
+}
+
+func (f *fakeS3) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n int
+	for _, c := range f.calls {
+		if c == op {
+			n++
+		}
+	}
+	return n
+}
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, code string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket)
+	if !ok {
+		fail(http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key = strings.TrimPrefix(key, "/")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fail(http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		f.calls = append(f.calls, "ListObjectsV2")
+		type content struct {
+			Key          string
+			Size         int
+			LastModified string
+		}
+		var res struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []content
+		}
+		prefix := r.URL.Query().Get("prefix")
+		for k, data := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				res.Contents = append(res.Contents, content{Key: k, Size: len(data), LastModified: "2025-10-17T12:00:00.000Z"})
+			}
+		}
+		sort.Slice(res.Contents, func(i, j int) bool { return res.Contents[i].Key < res.Contents[j].Key })
+		xml.NewEncoder(w).Encode(res)
+
+	case r.Method == http.MethodPut:
+		f.calls = append(f.calls, "PutObject")
+		if _, exists := f.objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+			fail(http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		if sum := r.Header.Get("X-Amz-Checksum-Sha256"); sum != checksumOf(body) {
+			fail(http.StatusBadRequest, "BadDigest")
+			return
+		}
+		f.objects[key] = body
+		f.metadata[key] = make(map[string]string)
+		for k := range r.Header {
+			if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok {
+				f.metadata[key][name] = r.Header.Get(k)
+			}
+		}
+		f.metadata[key]["content-type"] = r.Header.Get("Content-Type")
+
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		f.calls = append(f.calls, "GetObject")
+		data, ok := f.objects[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				fail(http.StatusNotFound, "NoSuchKey")
+			}
+			return
+		}
+		for k, v := range f.metadata[key] {
+			if k != "content-type" {
+				w.Header().Set("X-Amz-Meta-"+k, v)
+			}
+		}
+		if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" {
+			w.Header().Set("X-Amz-Checksum-Sha256", checksumOf(data))
+		}
+		w.Header().Set("Content-Type", f.metadata[key]["content-type"])
+		w.Header().Set("Last-Modified", "Fri, 17 Oct 2025 12:00:00 GMT")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+
+	case r.Method == http.MethodDelete:
+		f.calls = append(f.calls, "DeleteObject")
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		fail(http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	fake, client := newFakeS3(t)
+	st := &S3Store{Client: client, Bucket: testBucket, Prefix: "apictl", PartSize: bucket.MinPartSize}
+	testStore(t, st)
+	if _, ok := fake.objects["apictl/0.1.0/linux.tar.gz"]; !ok {
+		t.Errorf("objects aren't under the prefix: %v", fake.objects)
+	}
+	if obj, err := st.Head(context.Background(), "0.1.0/linux.tar.gz"); err != nil || obj.Sha256 != sha256Hex("linux archive") || obj.ContentType != "application/gzip" {
+		t.Errorf("got head %+v, %v", obj, err)
+	}
+
+	// the content is checked against the expected sha256 before it's put
+	err := st.Put(context.Background(), "bad.tar.gz", bytes.NewReader([]byte("archive")), PutOptions{Size: 7, Sha256: sha256Hex("other")})
+	if err == nil || !strings.Contains(err.Error(), "hashes to") {
+		t.Errorf("error %v, want a hash mismatch", err)
+	}
+	if _, ok := fake.objects["apictl/bad.tar.gz"]; ok {
+		t.Error("put an object with the wrong content")
+	}
+}
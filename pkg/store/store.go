@@ -0,0 +1,274 @@
+// Package store abstracts where artifacts are uploaded to.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/humanlogio/apictl/pkg/bucket"
+	"github.com/humanlogio/apictl/pkg/progress"
+)
+
+// ErrNotExist is returned when an object isn't in the store.
+var ErrNotExist = errors.New("object does not exist")
+
+// ErrExists is returned by puts with IfAbsent set when an object is already
+// at the key.
+var ErrExists = errors.New("object already exists")
+
+// Object describes an object of a store.
+type Object struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	// Sha256 is the hex encoded sha256 of the object, if the store knows
+	// it.
+	Sha256       string    `json:"sha256,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+type PutOptions struct {
+	// Size of the content, or -1 if unknown.
+	Size int64 `json:"size"`
+	// Sha256 is the hex encoded sha256 the content must hash to, if known.
+	Sha256       string `json:"sha256,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	CacheControl string `json:"cache_control,omitempty"`
+	// Progress counts the bytes sent, if set.
+	Progress *progress.Reporter `json:"-"`
+	// IfAbsent makes the put fail with ErrExists rather than overwrite an
+	// object.
+	IfAbsent bool `json:"if_absent,omitempty"`
+}
+
+// ArtifactStore holds artifacts under keys.
+type ArtifactStore interface {
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error
+	// Get opens an object for reading, or returns ErrNotExist.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Head describes an object, or returns ErrNotExist.
+	Head(ctx context.Context, key string) (*Object, error)
+	// Delete removes an object, or returns ErrNotExist.
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// URL is where an object can be downloaded from, or "" if unknown.
+	URL(key string) string
+}
+
+// S3Config is what the query of an `s3://` store URL can override of the
+// default S3 configuration.
+type S3Config struct {
+	Profile   string
+	Region    string
+	Endpoint  string
+	PathStyle bool
+}
+
+// Options configure the stores that Open creates.
+type Options struct {
+	// PublicURL is where objects are served from. HTTP stores default to
+	// their own URL.
+	PublicURL string
+	// S3Client is called to get a client for `s3://` stores.
+	S3Client func(S3Config) (*s3.Client, error)
+	ACL      string
+	PartSize int64
+	// PartConcurrency and StatePath configure multipart uploads to S3
+	// stores, see S3Store.
+	PartConcurrency int
+	StatePath       func(path string) string
+	// Token is sent as a bearer token to HTTP stores.
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Open creates the store a URL designates:
+//
+//   - `s3://<bucket>/<prefix>` for an S3 bucket, optionally with a `profile`,
+//     `region`, `endpoint` or `path_style` query,
+//   - `file://<dir>` for a local directory, e.g. served by `apictl store serve`,
+//   - `http(s)://<url>` for a server accepting PUT, HEAD, DELETE and WebDAV's
+//     PROPFIND.
+func Open(rawURL string, opts Options) (ArtifactStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing store url: %w", err)
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("store url %q has no bucket", rawURL)
+		}
+		q := u.Query()
+		cfg := S3Config{
+			Profile:  q.Get("profile"),
+			Region:   q.Get("region"),
+			Endpoint: q.Get("endpoint"),
+		}
+		if ps := q.Get("path_style"); ps != "" {
+			if cfg.PathStyle, err = strconv.ParseBool(ps); err != nil {
+				return nil, fmt.Errorf("store url %q: invalid path_style: %w", rawURL, err)
+			}
+		}
+		client, err := opts.S3Client(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &S3Store{
+			Client:          client,
+			Bucket:          u.Host,
+			Prefix:          strings.Trim(u.Path, "/"),
+			ACL:             opts.ACL,
+			PublicURL:       opts.PublicURL,
+			PartSize:        opts.PartSize,
+			PartConcurrency: opts.PartConcurrency,
+			StatePath:       opts.StatePath,
+		}, nil
+	case "file":
+		dir := u.Path
+		if u.Host != "" {
+			// `file://relative/dir`
+			dir = u.Host + u.Path
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("store url %q has no directory", rawURL)
+		}
+		return &FileStore{Dir: dir, PublicURL: opts.PublicURL}, nil
+	case "http", "https":
+		client := opts.HTTPClient
+		if client == nil {
+			client = http.DefaultClient
+		}
+		return &HTTPStore{
+			BaseURL:   strings.TrimSuffix(rawURL, "/"),
+			PublicURL: opts.PublicURL,
+			Token:     opts.Token,
+			Client:    client,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported store scheme %q, want s3, file, http or https", u.Scheme)
+}
+
+// PutIfAbsent uploads the content of `r` to `key`, unless an object with the
+// same content is already there, in which case it returns true. An object
+// with other content is never overwritten, even by a concurrent put: an
+// *bucket.ObjectConflictError is returned instead.
+func PutIfAbsent(ctx context.Context, st ArtifactStore, key string, r io.Reader, opts PutOptions) (bool, error) {
+	if same, err := sameObject(ctx, st, key, opts); same || err != nil {
+		return same, err
+	}
+	opts.IfAbsent = true
+	err := st.Put(ctx, key, r, opts)
+	if errors.Is(err, ErrExists) {
+		same, err := sameObject(ctx, st, key, opts)
+		if same {
+			log.Printf("%q was uploaded concurrently, with the same content", key)
+		}
+		return same, err
+	}
+	return false, err
+}
+
+func sameObject(ctx context.Context, st ArtifactStore, key string, opts PutOptions) (bool, error) {
+	obj, err := st.Head(ctx, key)
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("checking existing object %q: %w", key, err)
+	}
+	conflict := &bucket.ObjectConflictError{Key: key, HaveSha256: obj.Sha256, WantSha256: opts.Sha256, HaveSize: obj.Size, WantSize: opts.Size}
+	switch {
+	case obj.Sha256 != "" && opts.Sha256 != "":
+		if obj.Sha256 != opts.Sha256 {
+			return false, conflict
+		}
+	case opts.Size >= 0 && obj.Size != opts.Size:
+		return false, conflict
+	default:
+		log.Printf("can't tell the sha256 of existing object %q, assuming it's the same since it has the same size", key)
+	}
+	return true, nil
+}
+
+// KeyForURL maps a URL at which a store serves an object to the key of the
+// object. Paths are compared unescaped and queries are ignored. Presigned URLs
+// of S3 stores are recognized too.
+func KeyForURL(st ArtifactStore, rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	if base, err := url.Parse(st.URL("")); err == nil && base.Host != "" && strings.EqualFold(u.Host, base.Host) {
+		if key, ok := strings.CutPrefix(u.Path, strings.TrimSuffix(base.Path, "/")+"/"); ok && key != "" {
+			return key, true
+		}
+	}
+	s3Store, ok := st.(*S3Store)
+	if !ok {
+		return "", false
+	}
+	presigned, ok := bucket.ParsePresignedURL(rawURL, s3Store.Bucket)
+	if !ok {
+		return "", false
+	}
+	if s3Store.Prefix == "" {
+		return presigned.Key, true
+	}
+	if key, ok := strings.CutPrefix(presigned.Key, s3Store.Prefix+"/"); ok {
+		return key, true
+	}
+	return "", false
+}
+
+// Serves tells if a URL points at the host a store serves objects from, or
+// is an S3 URL of its bucket. Such URLs that KeyForURL can't map are
+// suspicious, unlike URLs of other hosts like GitHub release assets.
+func Serves(st ArtifactStore, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if base, err := url.Parse(st.URL("")); err == nil && base.Host != "" && strings.EqualFold(u.Host, base.Host) {
+		return true
+	}
+	s3Store, ok := st.(*S3Store)
+	if !ok {
+		return false
+	}
+	return strings.HasPrefix(u.Host, s3Store.Bucket+".") ||
+		(u.Query().Has("X-Amz-Signature") && strings.HasPrefix(u.Path, "/"+s3Store.Bucket+"/"))
+}
+
+func joinURL(base, key string) string {
+	if base == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/") + "/" + escapeKey(key)
+}
+
+// escapeKey escapes the segments of a key for use in a URL path.
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+func cleanKey(key string) (string, error) {
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return clean, nil
+}
@@ -0,0 +1,439 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/humanlogio/apictl/pkg/bucket"
+)
+
+const presignQuery = "?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Date=20251017T120000Z&X-Amz-Expires=3600&X-Amz-Signature=abc"
+
+func TestKeyForURL(t *testing.T) {
+	s3Store := &S3Store{Bucket: "releases", PublicURL: "https://dl.example.com/apictl/"}
+	prefixed := &S3Store{Bucket: "releases", Prefix: "apictl", PublicURL: "https://dl.example.com/apictl"}
+	fileStore := &FileStore{Dir: "/srv/bins", PublicURL: "http://127.0.0.1:8090"}
+	httpStore := &HTTPStore{BaseURL: "https://dav.example.com/bins"}
+	tests := []struct {
+		name      string
+		st        ArtifactStore
+		url       string
+		wantKey   string
+		wantOK    bool
+		wantServe bool
+	}{
+		{
+			name:    "public url",
+			st:      s3Store,
+			url:     "https://dl.example.com/apictl/0.1.0/linux.tar.gz",
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			// prune used to cut the public URL off the raw URL, so
+			// these were left in the bucket
+			name:    "escaped characters",
+			st:      s3Store,
+			url:     "https://dl.example.com/apictl/0.1.0%2Bbuild/linux%20amd64.tar.gz",
+			wantKey: "0.1.0+build/linux amd64.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name:    "query",
+			st:      s3Store,
+			url:     "https://dl.example.com/apictl/0.1.0/linux.tar.gz?download=1",
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name:    "host case",
+			st:      s3Store,
+			url:     "https://DL.example.com/apictl/0.1.0/linux.tar.gz",
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name:    "presigned, virtual host style",
+			st:      s3Store,
+			url:     "https://releases.s3.us-east-1.amazonaws.com/0.1.0/linux.tar.gz" + presignQuery,
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name:    "presigned, path style",
+			st:      s3Store,
+			url:     "https://s3.us-east-1.amazonaws.com/releases/0.1.0/linux.tar.gz" + presignQuery,
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name:    "presigned with a prefix",
+			st:      prefixed,
+			url:     "https://releases.s3.amazonaws.com/apictl/0.1.0/linux.tar.gz" + presignQuery,
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name:      "presigned outside of the prefix",
+			st:        prefixed,
+			url:       "https://releases.s3.amazonaws.com/other/0.1.0/linux.tar.gz" + presignQuery,
+			wantServe: true,
+		},
+		{
+			name:      "bucket url that isn't presigned",
+			st:        s3Store,
+			url:       "https://releases.s3.amazonaws.com/0.1.0/linux.tar.gz",
+			wantServe: true,
+		},
+		{
+			name:      "outside of the public url",
+			st:        s3Store,
+			url:       "https://dl.example.com/other/0.1.0/linux.tar.gz",
+			wantServe: true,
+		},
+		{
+			name:      "public url itself",
+			st:        s3Store,
+			url:       "https://dl.example.com/apictl/",
+			wantServe: true,
+		},
+		{
+			name: "other host",
+			st:   s3Store,
+			url:  "https://github.com/humanlogio/apictl/releases/download/v0.1.0/linux.tar.gz",
+		},
+		{
+			name: "other bucket",
+			st:   s3Store,
+			url:  "https://archive.s3.amazonaws.com/0.1.0/linux.tar.gz" + presignQuery,
+		},
+		{
+			name:    "file store",
+			st:      fileStore,
+			url:     "http://127.0.0.1:8090/0.1.0/linux.tar.gz",
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name: "file store, other port",
+			st:   fileStore,
+			url:  "http://127.0.0.1:8091/0.1.0/linux.tar.gz",
+		},
+		{
+			name: "file store without a public url",
+			st:   &FileStore{Dir: "/srv/bins"},
+			url:  "file:///srv/bins/0.1.0/linux.tar.gz",
+		},
+		{
+			name:    "http store",
+			st:      httpStore,
+			url:     "https://dav.example.com/bins/0.1.0/linux.tar.gz",
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name:      "http store, outside of the base url",
+			st:        httpStore,
+			url:       "https://dav.example.com/other/0.1.0/linux.tar.gz",
+			wantServe: true,
+		},
+		{
+			name:    "http store with a public url",
+			st:      &HTTPStore{BaseURL: "https://dav.example.com/bins", PublicURL: "https://dl.example.com"},
+			url:     "https://dl.example.com/0.1.0/linux.tar.gz",
+			wantKey: "0.1.0/linux.tar.gz", wantOK: true, wantServe: true,
+		},
+		{
+			name: "unparsable",
+			st:   s3Store,
+			url:  "https://dl.example.com/%zz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := KeyForURL(tt.st, tt.url)
+			if key != tt.wantKey || ok != tt.wantOK {
+				t.Errorf("KeyForURL = %q, %v, want %q, %v", key, ok, tt.wantKey, tt.wantOK)
+			}
+			if serves := Serves(tt.st, tt.url); serves != tt.wantServe {
+				t.Errorf("Serves = %v, want %v", serves, tt.wantServe)
+			}
+		})
+	}
+}
+
+func TestURLRoundTrip(t *testing.T) {
+	stores := map[string]ArtifactStore{
+		"s3":                       &S3Store{Bucket: "releases", PublicURL: "https://dl.example.com/apictl/"},
+		"s3 with a prefix":         &S3Store{Bucket: "releases", Prefix: "apictl", PublicURL: "https://dl.example.com/apictl"},
+		"file":                     &FileStore{Dir: "/srv/bins", PublicURL: "http://127.0.0.1:8090"},
+		"http":                     &HTTPStore{BaseURL: "https://dav.example.com/bins"},
+		"http with a public url":   &HTTPStore{BaseURL: "https://dav.example.com/bins", PublicURL: "https://dl.example.com/"},
+		"http at the root of host": &HTTPStore{BaseURL: "http://127.0.0.1:8080"},
+	}
+	keys := []string{
+		"apictl_0.1.0_linux_amd64.tar.gz",
+		"0.1.0/linux.tar.gz",
+		"0.1.0+build.1/linux amd64.tar.gz",
+		"odd/100%/#1?.zip",
+		"sha256/ab/abcdef.tar.gz",
+	}
+	for name, st := range stores {
+		for _, key := range keys {
+			u := st.URL(key)
+			if got, ok := KeyForURL(st, u); !ok || got != key {
+				t.Errorf("%s: %q from %q maps to %q, %v", name, key, u, got, ok)
+			}
+			if !Serves(st, u) {
+				t.Errorf("%s: doesn't serve %q", name, u)
+			}
+		}
+	}
+	if u := (&FileStore{Dir: "/srv/bins"}).URL("a.tar.gz"); u != "" {
+		t.Errorf("file store without a public url serves %q", u)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var gotConfig S3Config
+	opts := Options{
+		PublicURL: "https://dl.example.com",
+		S3Client: func(cfg S3Config) (*s3.Client, error) {
+			gotConfig = cfg
+			return s3.New(s3.Options{Region: "us-east-1"}), nil
+		},
+		ACL:   "public-read",
+		Token: "secret",
+	}
+	tests := []struct {
+		url     string
+		check   func(t *testing.T, st ArtifactStore)
+		wantErr string
+	}{
+		{
+			url: "s3://releases/apictl/bins/?profile=ci&region=eu-west-1&endpoint=https://minio:9000&path_style=true",
+			check: func(t *testing.T, st ArtifactStore) {
+				s, ok := st.(*S3Store)
+				if !ok || s.Bucket != "releases" || s.Prefix != "apictl/bins" || s.ACL != "public-read" || s.PublicURL != "https://dl.example.com" {
+					t.Errorf("got %#v", st)
+				}
+				if want := (S3Config{Profile: "ci", Region: "eu-west-1", Endpoint: "https://minio:9000", PathStyle: true}); gotConfig != want {
+					t.Errorf("got config %+v, want %+v", gotConfig, want)
+				}
+			},
+		},
+		{
+			url: "s3://releases",
+			check: func(t *testing.T, st ArtifactStore) {
+				if s := st.(*S3Store); s.Prefix != "" || gotConfig != (S3Config{}) {
+					t.Errorf("got %#v with config %+v", s, gotConfig)
+				}
+			},
+		},
+		{
+			url: "file:///srv/bins",
+			check: func(t *testing.T, st ArtifactStore) {
+				if s, ok := st.(*FileStore); !ok || s.Dir != "/srv/bins" || s.PublicURL != "https://dl.example.com" {
+					t.Errorf("got %#v", st)
+				}
+			},
+		},
+		{
+			url: "file://relative/bins",
+			check: func(t *testing.T, st ArtifactStore) {
+				if s, ok := st.(*FileStore); !ok || s.Dir != "relative/bins" {
+					t.Errorf("got %#v", st)
+				}
+			},
+		},
+		{
+			url: "https://dav.example.com/bins/",
+			check: func(t *testing.T, st ArtifactStore) {
+				s, ok := st.(*HTTPStore)
+				if !ok || s.BaseURL != "https://dav.example.com/bins" || s.Token != "secret" || s.Client == nil {
+					t.Errorf("got %#v", st)
+				}
+			},
+		},
+		{url: "s3:///apictl", wantErr: "has no bucket"},
+		{url: "s3://releases?path_style=maybe", wantErr: "invalid path_style"},
+		{url: "file://", wantErr: "has no directory"},
+		{url: "gs://releases", wantErr: `unsupported store scheme "gs"`},
+		{url: "://", wantErr: "parsing store url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			gotConfig = S3Config{}
+			st, err := Open(tt.url, opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, st)
+		})
+	}
+
+	opts.S3Client = func(S3Config) (*s3.Client, error) { return nil, errors.New("no credentials") }
+	if _, err := Open("s3://releases", opts); err == nil || err.Error() != "no credentials" {
+		t.Errorf("error %v, want the client's", err)
+	}
+}
+
+// racingStore hides objects from its first Head, as if they were put
+// concurrently.
+type racingStore struct {
+	*FileStore
+	heads int
+}
+
+func (s *racingStore) Head(ctx context.Context, key string) (*Object, error) {
+	if s.heads++; s.heads == 1 {
+		return nil, ErrNotExist
+	}
+	return s.FileStore.Head(ctx, key)
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	put := func(st ArtifactStore, content string, opts PutOptions) (bool, error) {
+		opts.Size = int64(len(content))
+		return PutIfAbsent(ctx, st, "0.1.0/linux.tar.gz", strings.NewReader(content), opts)
+	}
+	fs := &FileStore{Dir: t.TempDir()}
+
+	if existed, err := put(fs, "archive", PutOptions{Sha256: sha256Hex("archive")}); existed || err != nil {
+		t.Fatalf("first put: %v, %v", existed, err)
+	}
+	if existed, err := put(fs, "archive", PutOptions{Sha256: sha256Hex("archive")}); !existed || err != nil {
+		t.Errorf("same content: %v, %v, want it to exist", existed, err)
+	}
+	// without a sha256, the sizes are compared
+	if existed, err := put(fs, "archive", PutOptions{}); !existed || err != nil {
+		t.Errorf("same size: %v, %v, want it to exist", existed, err)
+	}
+
+	var conflict *bucket.ObjectConflictError
+	_, err := put(fs, "changed", PutOptions{Sha256: sha256Hex("changed")})
+	if !errors.As(err, &conflict) || conflict.HaveSha256 != sha256Hex("archive") || conflict.WantSha256 != sha256Hex("changed") {
+		t.Errorf("error %v, want a conflict", err)
+	}
+	if _, err := put(fs, "bigger archive", PutOptions{}); !errors.As(err, &conflict) || conflict.HaveSize != 7 || conflict.WantSize != 14 {
+		t.Errorf("error %v, want a size conflict", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(fs.Dir, "0.1.0", "linux.tar.gz")); err != nil || string(data) != "archive" {
+		t.Errorf("object became %q, %v", data, err)
+	}
+
+	// a concurrent put of the same content is fine, but not of another one
+	if existed, err := put(&racingStore{FileStore: fs}, "archive", PutOptions{Sha256: sha256Hex("archive")}); !existed || err != nil {
+		t.Errorf("concurrent put of the same content: %v, %v", existed, err)
+	}
+	if _, err := put(&racingStore{FileStore: fs}, "changed", PutOptions{Sha256: sha256Hex("changed")}); !errors.As(err, &conflict) {
+		t.Errorf("concurrent put of another content: error %v, want a conflict", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(fs.Dir, "0.1.0", "linux.tar.gz")); string(data) != "archive" {
+		t.Errorf("object became %q", data)
+	}
+}
+
+func TestPutIfAbsentS3(t *testing.T) {
+	fake, client := newFakeS3(t)
+	st := &S3Store{Client: client, Bucket: testBucket, Prefix: "apictl", PartSize: bucket.MinPartSize}
+	ctx := context.Background()
+	put := func(content string) (bool, error) {
+		return PutIfAbsent(ctx, st, "linux.tar.gz", bytes.NewReader([]byte(content)), PutOptions{Size: int64(len(content)), Sha256: sha256Hex(content)})
+	}
+	if existed, err := put("archive"); existed || err != nil {
+		t.Fatalf("first put: %v, %v", existed, err)
+	}
+	if existed, err := put("archive"); !existed || err != nil {
+		t.Errorf("same content: %v, %v, want it to exist", existed, err)
+	}
+	if _, err := put("changed"); !errors.As(err, new(*bucket.ObjectConflictError)) {
+		t.Errorf("error %v, want a conflict", err)
+	}
+	if data := fake.objects["apictl/linux.tar.gz"]; string(data) != "archive" {
+		t.Errorf("object became %q", data)
+	}
+	if puts := fake.count("PutObject"); puts != 1 {
+		t.Errorf("put %d times, want once", puts)
+	}
+}
+
+// testStore exercises an empty store.
+func testStore(t *testing.T, st ArtifactStore) {
+	t.Helper()
+	ctx := context.Background()
+	put := func(key, content string, opts PutOptions) error {
+		opts.Size = int64(len(content))
+		opts.Sha256 = sha256Hex(content)
+		return st.Put(ctx, key, strings.NewReader(content), opts)
+	}
+	if _, err := st.Head(ctx, "0.1.0/linux.tar.gz"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("head of a missing object: %v", err)
+	}
+	if _, _, err := st.Get(ctx, "0.1.0/linux.tar.gz"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("get of a missing object: %v", err)
+	}
+	if err := st.Delete(ctx, "0.1.0/linux.tar.gz"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("delete of a missing object: %v", err)
+	}
+	if objects, err := st.List(ctx, ""); err != nil || len(objects) != 0 {
+		t.Fatalf("got %v, %v, want an empty store", objects, err)
+	}
+
+	if err := put("0.1.0/linux.tar.gz", "linux archive", PutOptions{ContentType: "application/gzip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("0.1.0/darwin.tar.gz", "darwin archive", PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("0.2.0/linux.tar.gz", "newer archive", PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("0.1.0/linux.tar.gz", "linux archive", PutOptions{IfAbsent: true}); !errors.Is(err, ErrExists) {
+		t.Errorf("put if absent of an existing object: %v", err)
+	}
+
+	obj, err := st.Head(ctx, "0.1.0/linux.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HTTP servers don't tell the sha256 of objects
+	if obj.Key != "0.1.0/linux.tar.gz" || obj.Size != 13 || (obj.Sha256 != "" && obj.Sha256 != sha256Hex("linux archive")) || obj.LastModified.IsZero() {
+		t.Errorf("got head %+v", obj)
+	}
+	rc, obj, err := st.Get(ctx, "0.1.0/linux.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != "linux archive" || obj.Size != 13 {
+		t.Errorf("got %q, %v with %+v", data, err, obj)
+	}
+
+	objects, err := st.List(ctx, "0.1.0/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "0.1.0/darwin.tar.gz,0.1.0/linux.tar.gz" {
+		t.Errorf("listed %q", keys)
+	}
+
+	if err := st.Delete(ctx, "0.1.0/darwin.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Head(ctx, "0.1.0/darwin.tar.gz"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("head of a deleted object: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package versions
+
+import (
+	"fmt"
+	"strconv"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Bump is a semver increment.
+type Bump string
+
+const (
+	BumpMajor      Bump = "major"
+	BumpMinor      Bump = "minor"
+	BumpPatch      Bump = "patch"
+	BumpPrerelease Bump = "prerelease"
+)
+
+func ParseBump(s string) (Bump, error) {
+	switch b := Bump(s); b {
+	case BumpMajor, BumpMinor, BumpPatch, BumpPrerelease:
+		return b, nil
+	}
+	return "", fmt.Errorf("invalid bump %q, want major, minor, patch or prerelease", s)
+}
+
+// Bumper applies bumps one after the other, as semver means them:
+//
+//   - major, minor and patch increment their field and reset the lower
+//     ones, or just drop the prereleases of a version that is a prerelease
+//     of what they would produce, e.g. 1.3.0-rc.2 bumps to 1.3.0 with minor,
+//   - prerelease increments the last numeric identifier of the prereleases,
+//     e.g. rc.1 to rc.2, or starts at `<Preid>.1` if there are none or they
+//     don't start with Preid. A release gets its patch bumped first, unless a
+//     major, minor or patch bump was already applied, so that `minor
+//     prerelease` gives the first prerelease of the next minor. If that bump
+//     only dropped the prereleases, they are the ones incremented, e.g.
+//     1.3.0-rc.2 bumps to 1.3.0-rc.3 with `minor prerelease`.
+//
+// Build metadata is dropped.
+type Bumper struct {
+	// Preid is the identifier of new prereleases, e.g. `rc`.
+	Preid string
+
+	bumped bool
+	// released are the prereleases dropped by the last bump, if it didn't
+	// increment anything.
+	released []string
+}
+
+// Bump returns the version `v` bumps to.
+func (b *Bumper) Bump(v *typesv1.Version, bump Bump) (*typesv1.Version, error) {
+	out := proto.Clone(v).(*typesv1.Version)
+	out.Build = ""
+	isPre := len(out.Prereleases) > 0
+	released := out.Prereleases
+	switch bump {
+	case BumpMajor:
+		if !isPre || out.Minor != 0 || out.Patch != 0 {
+			out.Major++
+			out.Minor, out.Patch = 0, 0
+			released = nil
+		}
+		out.Prereleases = nil
+	case BumpMinor:
+		if !isPre || out.Patch != 0 {
+			out.Minor++
+			out.Patch = 0
+			released = nil
+		}
+		out.Prereleases = nil
+	case BumpPatch:
+		if !isPre {
+			out.Patch++
+		}
+		out.Prereleases = nil
+	case BumpPrerelease:
+		pre := out.Prereleases
+		if !isPre {
+			pre = b.released
+		}
+		pre, err := b.nextPrerelease(pre)
+		if err != nil {
+			return nil, err
+		}
+		if !isPre && !b.bumped {
+			out.Patch++
+		}
+		out.Prereleases = pre
+		b.released = nil
+		return out, nil
+	default:
+		return nil, fmt.Errorf("invalid bump %q", bump)
+	}
+	b.bumped = true
+	b.released = released
+	return out, nil
+}
+
+func (b *Bumper) nextPrerelease(pre []string) ([]string, error) {
+	if len(pre) == 0 || (b.Preid != "" && pre[0] != b.Preid) {
+		if b.Preid == "" {
+			return nil, fmt.Errorf("need a prerelease identifier to start a prerelease, e.g. rc")
+		}
+		return []string{b.Preid, "1"}, nil
+	}
+	out := append([]string(nil), pre...)
+	for i := len(out) - 1; i >= 0; i-- {
+		n, err := strconv.ParseUint(out[i], 10, 64)
+		if err != nil {
+			continue
+		}
+		out[i] = strconv.FormatUint(n+1, 10)
+		return out, nil
+	}
+	return append(out, "1"), nil
+}
@@ -0,0 +1,105 @@
+package versions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBumperBump(t *testing.T) {
+	tests := []struct {
+		version string
+		preid   string
+		bumps   []Bump
+		want    string
+		wantErr string
+	}{
+		{version: "1.2.3", bumps: []Bump{BumpMajor}, want: "2.0.0"},
+		{version: "1.2.3", bumps: []Bump{BumpMinor}, want: "1.3.0"},
+		{version: "1.2.3", bumps: []Bump{BumpPatch}, want: "1.2.4"},
+		{version: "1.2.3+build.5", bumps: []Bump{BumpPatch}, want: "1.2.4"},
+
+		// prereleases of what the bump produces are released
+		{version: "2.0.0-rc.1", bumps: []Bump{BumpMajor}, want: "2.0.0"},
+		{version: "2.1.0-rc.1", bumps: []Bump{BumpMajor}, want: "3.0.0"},
+		{version: "1.3.0-rc.2", bumps: []Bump{BumpMinor}, want: "1.3.0"},
+		{version: "1.3.1-rc.2", bumps: []Bump{BumpMinor}, want: "1.4.0"},
+		{version: "1.3.1-rc.2", bumps: []Bump{BumpPatch}, want: "1.3.1"},
+
+		{version: "1.2.3", preid: "rc", bumps: []Bump{BumpPrerelease}, want: "1.2.4-rc.1"},
+		{version: "1.2.4-rc.1", preid: "rc", bumps: []Bump{BumpPrerelease}, want: "1.2.4-rc.2"},
+		{version: "1.2.4-rc.9", bumps: []Bump{BumpPrerelease}, want: "1.2.4-rc.10"},
+		{version: "1.2.4-rc.1.devel", bumps: []Bump{BumpPrerelease}, want: "1.2.4-rc.2.devel"},
+		{version: "1.2.4-rc", bumps: []Bump{BumpPrerelease}, want: "1.2.4-rc.1"},
+		{version: "1.2.4-beta.3", preid: "rc", bumps: []Bump{BumpPrerelease}, want: "1.2.4-rc.1"},
+		{version: "1.2.3", bumps: []Bump{BumpPrerelease}, wantErr: "need a prerelease identifier"},
+
+		// chains
+		{version: "1.2.3", preid: "rc", bumps: []Bump{BumpMinor, BumpPrerelease}, want: "1.3.0-rc.1"},
+		{version: "1.2.3", preid: "rc", bumps: []Bump{BumpMajor, BumpPrerelease}, want: "2.0.0-rc.1"},
+		{version: "1.2.3", preid: "rc", bumps: []Bump{BumpPatch, BumpPrerelease}, want: "1.2.4-rc.1"},
+		{version: "1.3.0-rc.2", preid: "rc", bumps: []Bump{BumpMinor, BumpPrerelease}, want: "1.3.0-rc.3"},
+		{version: "1.3.0-rc.2", bumps: []Bump{BumpPatch, BumpPrerelease}, want: "1.3.0-rc.3"},
+		{version: "1.3.1-rc.2", preid: "rc", bumps: []Bump{BumpMinor, BumpPrerelease}, want: "1.4.0-rc.1"},
+		{version: "2.0.0-beta.2", preid: "rc", bumps: []Bump{BumpMajor, BumpPrerelease}, want: "2.0.0-rc.1"},
+		{version: "1.3.0-rc.2", bumps: []Bump{BumpPrerelease, BumpPrerelease}, want: "1.3.0-rc.4"},
+		{version: "1.2.3", preid: "rc", bumps: []Bump{BumpPrerelease, BumpPrerelease}, want: "1.2.4-rc.2"},
+		{version: "1.2.3", bumps: []Bump{BumpMinor, BumpPatch}, want: "1.3.1"},
+
+		{version: "1.2.3", bumps: []Bump{"micro"}, wantErr: `invalid bump "micro"`},
+	}
+	for _, tt := range tests {
+		var names []string
+		for _, b := range tt.bumps {
+			names = append(names, string(b))
+		}
+		name := tt.version + " " + strings.Join(names, " ")
+		t.Run(name, func(t *testing.T) {
+			v, err := Parse(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := &Bumper{Preid: tt.preid}
+			for _, bump := range tt.bumps {
+				if v, err = b.Bump(v, bump); err != nil {
+					break
+				}
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := String(v); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBumperBumpDoesntModifyInput(t *testing.T) {
+	v, err := Parse("1.3.0-rc.2+build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(Bumper).Bump(v, BumpPrerelease); err != nil {
+		t.Fatal(err)
+	}
+	if got := String(v); got != "1.3.0-rc.2+build" {
+		t.Errorf("input became %s", got)
+	}
+}
+
+func TestParseBump(t *testing.T) {
+	for _, s := range []string{"major", "minor", "patch", "prerelease"} {
+		if b, err := ParseBump(s); err != nil || string(b) != s {
+			t.Errorf("ParseBump(%q) = %q, %v", s, b, err)
+		}
+	}
+	if _, err := ParseBump("Major"); err == nil {
+		t.Error("ParseBump is case sensitive")
+	}
+}
@@ -0,0 +1,59 @@
+package versions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+// ParseAny reads a version either as semver or as the JSON of a
+// typesv1.Version.
+func ParseAny(s string) (*typesv1.Version, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		v, err := Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		return v, nil
+	}
+	out := new(typesv1.Version)
+	if err := json.Unmarshal([]byte(s), out); err != nil {
+		return nil, fmt.Errorf("decoding version JSON: %w", err)
+	}
+	if _, err := out.AsSemver(); err != nil {
+		return nil, fmt.Errorf("invalid version %s: %w", s, err)
+	}
+	return out, nil
+}
+
+// Compare orders versions by semver precedence, ignoring build metadata. It
+// returns -1, 0 or 1.
+func Compare(a, b *typesv1.Version) (int, error) {
+	sa, err := a.AsSemver()
+	if err != nil {
+		return 0, err
+	}
+	sb, err := b.AsSemver()
+	if err != nil {
+		return 0, err
+	}
+	return sa.Compare(sb), nil
+}
+
+// Satisfies tells if a version is in a range such as `>=0.7.0 <0.8.0`, where
+// spaces mean and, and `||` means or.
+func Satisfies(v *typesv1.Version, rangeStr string) (bool, error) {
+	r, err := semver.ParseRange(rangeStr)
+	if err != nil {
+		return false, fmt.Errorf("parsing range %q: %w", rangeStr, err)
+	}
+	sv, err := v.AsSemver()
+	if err != nil {
+		return false, err
+	}
+	return r(sv), nil
+}
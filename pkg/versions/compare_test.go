@@ -0,0 +1,118 @@
+package versions
+
+import (
+	"strings"
+	"testing"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+func mustParse(t *testing.T, s string) *typesv1.Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.2.3", b: "1.2.3", want: 0},
+		{a: "1.2.3", b: "1.2.4", want: -1},
+		{a: "1.10.0", b: "1.9.0", want: 1},
+		{a: "2.0.0", b: "1.99.99", want: 1},
+		{a: "1.3.0-rc.1", b: "1.3.0", want: -1},
+		{a: "1.3.0-rc.2", b: "1.3.0-rc.10", want: -1},
+		{a: "1.3.0-rc.1", b: "1.3.0-rc.1.devel.3", want: -1},
+		{a: "1.3.0-beta.5", b: "1.3.0-rc.1", want: -1},
+		{a: "1.3.0-rc.1", b: "1.3.0-rc", want: 1},
+		{a: "1.2.3+build.1", b: "1.2.3+build.2", want: 0},
+		{a: "v1.2.3", b: "1.2.3", want: 0},
+	}
+	for _, tt := range tests {
+		got, err := Compare(mustParse(t, tt.a), mustParse(t, tt.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		// the order is antisymmetric
+		if got, _ := Compare(mustParse(t, tt.b), mustParse(t, tt.a)); got != -tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version string
+		rng     string
+		want    bool
+		wantErr string
+	}{
+		{version: "0.7.3", rng: ">=0.7.0 <0.8.0", want: true},
+		{version: "0.8.0", rng: ">=0.7.0 <0.8.0", want: false},
+		{version: "0.6.9", rng: ">=0.7.0 <0.8.0", want: false},
+		{version: "1.0.0", rng: "<0.8.0 || >=1.0.0", want: true},
+		{version: "0.9.0", rng: "<0.8.0 || >=1.0.0", want: false},
+		{version: "1.2.3", rng: "1.2.3", want: true},
+		{version: "1.2.3", rng: "!1.2.3", want: false},
+		// prereleases are compared by precedence, unlike npm's ranges
+		{version: "0.8.0-rc.1", rng: ">=0.7.0 <0.8.0", want: true},
+		{version: "0.8.0-rc.1", rng: ">=0.8.0-rc.1", want: true},
+		{version: "1.2.3+build", rng: "=1.2.3", want: true},
+		{version: "1.2.3", rng: "~>1.2", wantErr: `parsing range "~>1.2"`},
+		{version: "1.2.3", rng: "", wantErr: `parsing range ""`},
+	}
+	for _, tt := range tests {
+		got, err := Satisfies(mustParse(t, tt.version), tt.rng)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Satisfies(%s, %q): error %v, want %q", tt.version, tt.rng, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Satisfies(%s, %q) = %v, want %v", tt.version, tt.rng, got, tt.want)
+		}
+	}
+}
+
+func TestParseAny(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "1.2.3", want: "1.2.3"},
+		{in: " v1.2.3-rc.1+build\n", want: "1.2.3-rc.1+build"},
+		{in: `{"major":1,"minor":3,"prereleases":["rc","2"]}`, want: "1.3.0-rc.2"},
+		{in: `{"major":1,"minor":3,"build":"abc"}`, want: "1.3.0+abc"},
+		{in: "1.2", wantErr: `invalid version "1.2"`},
+		{in: `{"major":"one"}`, wantErr: "decoding version JSON"},
+		{in: `{"major":1,"prereleases":["r c"]}`, wantErr: "invalid version"},
+	}
+	for _, tt := range tests {
+		got, err := ParseAny(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseAny(%q): error %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := String(got); s != tt.want {
+			t.Errorf("ParseAny(%q) = %s, want %s", tt.in, s, tt.want)
+		}
+	}
+}
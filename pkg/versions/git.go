@@ -0,0 +1,142 @@
+package versions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+// GitInfo is where HEAD stands relative to the nearest version tag. It's
+// what prerelease and build schemes can refer to.
+type GitInfo struct {
+	// Tag is empty if no tag matched.
+	Tag string
+	// Count is the number of commits since Tag, or since the root commit.
+	Count           int
+	ShortCommit     string
+	CommitTimestamp int64
+	// CommitDate and Date are the day of the commit and of today, in UTC,
+	// formatted as YYYYMMDD.
+	CommitDate string
+	Date       string
+}
+
+// ReadGit describes HEAD in the repository at `dir`, considering the tags
+// matching the glob `match`.
+func ReadGit(ctx context.Context, dir, match string) (*GitInfo, error) {
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+		stderr := new(bytes.Buffer)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+			}
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	commit, err := git("log", "-1", "--format=%h %ct", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	short, ts, _ := strings.Cut(commit, " ")
+	out := &GitInfo{ShortCommit: short, Date: time.Now().UTC().Format("20060102")}
+	if out.CommitTimestamp, err = strconv.ParseInt(ts, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid commit timestamp %q", ts)
+	}
+	out.CommitDate = time.Unix(out.CommitTimestamp, 0).UTC().Format("20060102")
+
+	tag, err := git("describe", "--tags", "--abbrev=0", "--match", match, "HEAD")
+	if err != nil {
+		if !strings.Contains(err.Error(), "No names found") && !strings.Contains(err.Error(), "cannot describe") {
+			return nil, err
+		}
+		// no tag yet, count from the root
+		tag = ""
+	}
+	out.Tag = tag
+	revs := "HEAD"
+	if tag != "" {
+		revs = tag + "..HEAD"
+	}
+	count, err := git("rev-list", "--count", revs)
+	if err != nil {
+		return nil, err
+	}
+	if out.Count, err = strconv.Atoi(count); err != nil {
+		return nil, fmt.Errorf("invalid commit count %q", count)
+	}
+	return out, nil
+}
+
+// GitScheme derives versions from where HEAD stands:
+//
+//   - on a tag, the version is the tag's,
+//   - past a release tag, it's the tag bumped by Bump, with the prereleases
+//     rendered by Pre, e.g. 0.7.0 and `devel.{{.Count}}` give 0.7.1-devel.3,
+//   - past a prerelease tag, the prereleases rendered by Pre are appended to
+//     the tag's, e.g. 0.8.0-rc.1.devel.3, so that it sorts after the tag.
+//
+// Build is rendered in all cases. Pre and Build are templates of GitInfo.
+type GitScheme struct {
+	Bump  Bump
+	Pre   string
+	Build string
+}
+
+// Version returns the version of HEAD.
+func (s *GitScheme) Version(info *GitInfo) (*typesv1.Version, error) {
+	out := new(typesv1.Version)
+	if info.Tag != "" {
+		v, err := Parse(info.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version in tag %q: %w", info.Tag, err)
+		}
+		out = v
+	}
+	out.Build = ""
+	pre, err := render("prerelease", s.Pre, info)
+	if err != nil {
+		return nil, err
+	}
+	if info.Tag == "" || info.Count > 0 {
+		if len(out.Prereleases) == 0 {
+			if out, err = new(Bumper).Bump(out, s.Bump); err != nil {
+				return nil, err
+			}
+		}
+		if pre != "" {
+			out.Prereleases = append(out.Prereleases, strings.Split(pre, ".")...)
+		}
+	}
+	build, err := render("build", s.Build, info)
+	if err != nil {
+		return nil, err
+	}
+	out.Build = build
+	if _, err := out.AsSemver(); err != nil {
+		return nil, fmt.Errorf("invalid version %s: %w", String(out), err)
+	}
+	return out, nil
+}
+
+func render(name, text string, info *GitInfo) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s scheme: %w", name, err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, info); err != nil {
+		return "", fmt.Errorf("rendering %s scheme: %w", name, err)
+	}
+	return buf.String(), nil
+}
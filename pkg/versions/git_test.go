@@ -0,0 +1,183 @@
+package versions
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitSchemeVersion(t *testing.T) {
+	info := func(tag string, count int) *GitInfo {
+		return &GitInfo{
+			Tag:             tag,
+			Count:           count,
+			ShortCommit:     "abc1234",
+			CommitTimestamp: 1760659200,
+			CommitDate:      "20251017",
+			Date:            "20251018",
+		}
+	}
+	tests := []struct {
+		name    string
+		scheme  GitScheme
+		info    *GitInfo
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "on a release tag",
+			scheme: GitScheme{Bump: BumpPatch, Pre: "devel.{{.Count}}"},
+			info:   info("v0.7.0", 0),
+			want:   "0.7.0",
+		},
+		{
+			name:   "on a prerelease tag",
+			scheme: GitScheme{Bump: BumpPatch, Pre: "devel.{{.Count}}"},
+			info:   info("v0.8.0-rc.1", 0),
+			want:   "0.8.0-rc.1",
+		},
+		{
+			name:   "tag build is replaced",
+			scheme: GitScheme{Bump: BumpPatch, Build: "{{.ShortCommit}}"},
+			info:   info("v0.7.0+old", 0),
+			want:   "0.7.0+abc1234",
+		},
+		{
+			name:   "past a release tag",
+			scheme: GitScheme{Bump: BumpPatch, Pre: "devel.{{.Count}}"},
+			info:   info("v0.7.0", 3),
+			want:   "0.7.1-devel.3",
+		},
+		{
+			name:   "past a release tag, minor bump",
+			scheme: GitScheme{Bump: BumpMinor, Pre: "devel.{{.Count}}", Build: "{{.ShortCommit}}"},
+			info:   info("0.7.2", 3),
+			want:   "0.8.0-devel.3+abc1234",
+		},
+		{
+			name:   "past a prerelease tag",
+			scheme: GitScheme{Bump: BumpPatch, Pre: "devel.{{.Count}}"},
+			info:   info("v0.8.0-rc.1", 3),
+			want:   "0.8.0-rc.1.devel.3",
+		},
+		{
+			name:   "past a tag without prereleases",
+			scheme: GitScheme{Bump: BumpPatch},
+			info:   info("v0.7.0", 3),
+			want:   "0.7.1",
+		},
+		{
+			name:   "no tag",
+			scheme: GitScheme{Bump: BumpMinor, Pre: "devel.{{.Count}}"},
+			info:   info("", 12),
+			want:   "0.1.0-devel.12",
+		},
+		{
+			name:   "dates",
+			scheme: GitScheme{Bump: BumpPatch, Pre: "nightly.{{.Date}}", Build: "{{.CommitDate}}.{{.CommitTimestamp}}"},
+			info:   info("v1.0.0", 1),
+			want:   "1.0.1-nightly.20251018+20251017.1760659200",
+		},
+		{
+			name:    "invalid tag",
+			scheme:  GitScheme{Bump: BumpPatch},
+			info:    info("release-1", 1),
+			wantErr: `invalid version in tag "release-1"`,
+		},
+		{
+			name:    "unknown field",
+			scheme:  GitScheme{Bump: BumpPatch, Pre: "{{.Branch}}"},
+			info:    info("v1.0.0", 1),
+			wantErr: "rendering prerelease scheme",
+		},
+		{
+			name:    "unparsable template",
+			scheme:  GitScheme{Bump: BumpPatch, Build: "{{.ShortCommit"},
+			info:    info("v1.0.0", 1),
+			wantErr: "parsing build scheme",
+		},
+		{
+			name:    "invalid prerelease",
+			scheme:  GitScheme{Bump: BumpPatch, Pre: "devel..{{.Count}}"},
+			info:    info("v1.0.0", 1),
+			wantErr: "invalid version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scheme.Version(tt.info)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := String(got); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "tag.gpgSign=false", "-c", "commit.gpgSign=false"}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_COMMITTER_DATE=2025-10-17T12:00:00Z", "GIT_AUTHOR_DATE=2025-10-17T12:00:00Z")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	commit := func() { git("commit", "--allow-empty", "-q", "-m", "commit") }
+	read := func(match string) *GitInfo {
+		t.Helper()
+		info, err := ReadGit(context.Background(), dir, match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	git("init", "-q")
+	commit()
+	commit()
+
+	info := read("v*")
+	if info.Tag != "" || info.Count != 2 {
+		t.Errorf("without tags, got tag %q and count %d, want none and 2", info.Tag, info.Count)
+	}
+	if info.CommitTimestamp != 1760702400 || info.CommitDate != "20251017" {
+		t.Errorf("got commit time %d on %s", info.CommitTimestamp, info.CommitDate)
+	}
+	if info.Date != time.Now().UTC().Format("20060102") || len(info.ShortCommit) < 7 {
+		t.Errorf("got date %s and commit %q", info.Date, info.ShortCommit)
+	}
+
+	git("tag", "v0.1.0")
+	if info := read("v*"); info.Tag != "v0.1.0" || info.Count != 0 {
+		t.Errorf("on a tag, got tag %q and count %d", info.Tag, info.Count)
+	}
+	commit()
+	git("tag", "-a", "-m", "other", "other-1")
+	commit()
+	commit()
+	if info := read("v*"); info.Tag != "v0.1.0" || info.Count != 3 {
+		t.Errorf("past a tag, got tag %q and count %d, want v0.1.0 and 3", info.Tag, info.Count)
+	}
+	if info := read("other-*"); info.Tag != "other-1" || info.Count != 2 {
+		t.Errorf("past an annotated tag, got tag %q and count %d, want other-1 and 2", info.Tag, info.Count)
+	}
+
+	if _, err := ReadGit(context.Background(), t.TempDir(), "v*"); err == nil {
+		t.Error("want an error outside of a repository")
+	}
+}
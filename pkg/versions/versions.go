@@ -0,0 +1,41 @@
+package versions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver"
+	typesv1 "github.com/humanlogio/api/go/types/v1"
+)
+
+// Parse reads a semver string, with or without a leading `v`.
+func Parse(v string) (*typesv1.Version, error) {
+	sv, err := semver.Parse(strings.TrimPrefix(v, "v"))
+	if err != nil {
+		return nil, err
+	}
+	return FromSemver(sv), nil
+}
+
+func FromSemver(sv semver.Version) *typesv1.Version {
+	out := &typesv1.Version{
+		Major: int32(sv.Major),
+		Minor: int32(sv.Minor),
+		Patch: int32(sv.Patch),
+	}
+	for _, pre := range sv.Pre {
+		out.Prereleases = append(out.Prereleases, pre.String())
+	}
+	out.Build = strings.Join(sv.Build, ".")
+	return out
+}
+
+// String formats a version as semver, falling back to its numeric fields if
+// it has invalid prereleases.
+func String(v *typesv1.Version) string {
+	sv, err := v.AsSemver()
+	if err != nil {
+		return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	}
+	return sv.String()
+}